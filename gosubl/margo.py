@@ -24,6 +24,8 @@ class MargoSingleton(object):
 		self.state = State()
 		self.status = []
 		self.output_handler = None
+		# the Fd of the last command that sent output, used as the default target of CmdInput
+		self.cmd_input_fd = ''
 		self._client_actions_handlers = {
 			client_actions.Activate: self._handle_act_activate,
 			client_actions.Restart: self._handle_act_restart,
@@ -98,6 +100,12 @@ class MargoSingleton(object):
 		self.stop()
 
 	def _handle_act_output(self, rs, act):
+		if act.close:
+			if act.fd == self.cmd_input_fd:
+				self.cmd_input_fd = ''
+		elif act.fd:
+			self.cmd_input_fd = act.fd
+
 		h = self.output_handler
 		if h:
 			h(rs, act)
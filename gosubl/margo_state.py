@@ -13,6 +13,8 @@ actions = NS(**{k: {'Name': k} for k in (
 	'QueryIssues',
 	'QueryUserCmds',
 	'QueryTestCmds',
+	'QueryPromptChoices',
+	'QueryDeclarations',
 	'ViewActivated',
 	'ViewModified',
 	'ViewPosChanged',
@@ -21,6 +23,7 @@ actions = NS(**{k: {'Name': k} for k in (
 	'ViewSaved',
 	'ViewLoaded',
 	'RunCmd',
+	'CmdInput',
 )})
 
 client_actions = NS(**{k: k for k in (
@@ -89,8 +92,12 @@ class State(object):
 		self.view = ResView(v=v.get('View') or {})
 		self.completions = [Completion(c) for c in (v.get('Completions') or [])]
 		self.tooltips = [Tooltip(t) for t in (v.get('Tooltips') or [])]
+		sh = v.get('SignatureHelp')
+		self.signature_help = SignatureHelp(sh) if sh else None
 		self.issues = [Issue(l) for l in (v.get('Issues') or [])]
 		self.user_cmds = [UserCmd(c) for c in (v.get('UserCmds') or [])]
+		self.prompt_choices = [PromptChoice(c) for c in (v.get('PromptChoices') or [])]
+		self.declarations = [Declaration(d) for d in (v.get('Declarations') or [])]
 		self.hud = HUD(v=v.get('HUD') or {})
 
 		self.client_actions = []
@@ -156,6 +163,19 @@ class Completion(object):
 	def __repr__(self):
 		return repr(self.__dict__)
 
+class Declaration(object):
+	def __init__(self, v):
+		self.name = v.get('Name') or ''
+		self.kind = v.get('Kind') or ''
+		self.detail = v.get('Detail') or ''
+		self.path = v.get('Path') or ''
+		self.row = v.get('Row') or 0
+		self.col = v.get('Col') or 0
+		self.children = [Declaration(d) for d in (v.get('Children') or [])]
+
+	def __repr__(self):
+		return repr(self.__dict__)
+
 class Tooltip(object):
 	def __init__(self, v):
 		self.content = v.get('Content') or ''
@@ -163,6 +183,36 @@ class Tooltip(object):
 	def __repr__(self):
 		return repr(self.__dict__)
 
+class SignatureHelp(object):
+	def __init__(self, v):
+		self.signatures = [Signature(s) for s in (v.get('Signatures') or [])]
+		self.active_signature = v.get('ActiveSignature') or 0
+		self.active_parameter = v.get('ActiveParameter')
+		if self.active_parameter is None:
+			self.active_parameter = -1
+
+	def __repr__(self):
+		return repr(self.__dict__)
+
+class Signature(object):
+	def __init__(self, v):
+		self.label = v.get('Label') or ''
+		self.name = v.get('Name') or ''
+		self.params = [SignatureParam(p) for p in (v.get('Params') or [])]
+		self.results = [SignatureParam(p) for p in (v.get('Results') or [])]
+		self.doc = v.get('Doc') or ''
+
+	def __repr__(self):
+		return repr(self.__dict__)
+
+class SignatureParam(object):
+	def __init__(self, v):
+		self.name = v.get('Name') or ''
+		self.type = v.get('Type') or ''
+
+	def __repr__(self):
+		return repr(self.__dict__)
+
 class PathName(object):
 	def __init__(self, *, path, name):
 		self.path = path or ''
@@ -233,7 +283,52 @@ class UserCmd(object):
 		self.name = v.get('Name') or ''
 		self.args = v.get('Args') or []
 		self.dir = v.get('Dir') or ''
-		self.prompts = v.get('Prompts') or []
+		# Limits is passed back as-is to RunCmd
+		self.limits = v.get('Limits') or {}
+		self.parse_ansi = v.get('ParseANSI') or False
+		typed = v.get('TypedPrompts') or []
+		if typed:
+			self.prompts = [Prompt(p) for p in typed]
+		else:
+			self.prompts = [Prompt({'Title': s}) for s in (v.get('Prompts') or [])]
+
+class PromptChoice(object):
+	def __init__(self, v={}):
+		self.value = v.get('Value') or ''
+		self.title = v.get('Title') or self.value
+		self.desc = v.get('Desc') or ''
+
+class Prompt(object):
+	def __init__(self, v={}):
+		self.data = v
+		self.title = v.get('Title') or ''
+		self.type = v.get('Type') or 'string'
+		self.default = v.get('Default') or ''
+		self.choices = [PromptChoice(c) for c in (v.get('Choices') or [])]
+		self.query = v.get('Query') or ''
+		self.pattern = v.get('Pattern') or ''
+
+	def validate(self, s):
+		'''validate s using the same rules as mg.Prompt.Validate
+
+		the values are validated again by the agent before the command is run
+		'''
+
+		if self.type == 'bool' and s not in ('true', 'false'):
+			return '%s: `%s` is not a boolean' % (self.title, s)
+
+		# queried choices are not known to the agent so they're not validated
+		if self.type == 'choice' and not self.query and s not in [c.value for c in self.choices]:
+			return '%s: `%s` is not one of the choices' % (self.title, s)
+
+		if self.pattern:
+			try:
+				if not re.search(self.pattern, s):
+					return '%s: `%s` does not match the pattern `%s`' % (self.title, s, self.pattern)
+			except re.error as e:
+				return '%s: invalid pattern `%s`: %s' % (self.title, self.pattern, e)
+
+		return ''
 
 class HUD(object):
 	def __init__(self, v={}):
@@ -286,7 +381,8 @@ def _view_props(view, wd=''):
 	if view is None:
 		return {}
 
-	pos = gs.sel(view).begin()
+	sel = gs.sel(view)
+	pos = sel.begin()
 	scope, lang, fn, props = _view_header(view, pos)
 	wd = wd or gs.getwd() or gs.basedir_or_cwd(fn)
 	src = _view_src(view, lang)
@@ -294,6 +390,8 @@ def _view_props(view, wd=''):
 	props.update({
 		'Wd': wd,
 		'Pos': pos,
+		'SelStart': sel.begin(),
+		'SelEnd': sel.end(),
 		'Dirty': view.is_dirty(),
 		'Src': src,
 	})
@@ -2,7 +2,7 @@ from . import _dbg
 from . import gs
 from .margo import mg
 from .margo_render import render_src
-from .margo_state import actions, ViewPathName
+from .margo_state import actions, ViewPathName, PromptChoice
 import os
 import sublime
 import sublime_plugin
@@ -55,23 +55,67 @@ class MargoUserCmdsCommand(sublime_plugin.TextCommand):
 			self._on_done_call(win=win, cmd=cmd, prompts=prompts)
 			return
 
+		p = cmd.prompts[len(prompts)]
+		title = '%d/%d %s' % (len(prompts) + 1, len(cmd.prompts), p.title)
+
 		def on_done(s):
+			err = p.validate(s)
+			if err:
+				sublime.status_message(err)
+				self._on_done(win=win, cmd=cmd, prompts=prompts)
+				return
+
 			prompts.append(s)
 			self._on_done(win=win, cmd=cmd, prompts=prompts)
 
-		win.show_input_panel('%d/%d %s' % (
-			len(prompts) + 1,
-			len(cmd.prompts),
-			cmd.prompts[len(prompts)-1],
-		), '', on_done, None, None)
+		if p.query or p.type == 'package':
+			act = actions.QueryPromptChoices.copy()
+			act['Data'] = {'Prompt': p.data}
+			mg.send(view=self.view, actions=[act], cb=lambda rs: self._show_prompt(
+				win=win, p=p, title=title, choices=p.choices + rs.state.prompt_choices, on_done=on_done,
+			))
+			return
+
+		self._show_prompt(win=win, p=p, title=title, choices=p.choices, on_done=on_done)
+
+	def _show_prompt(self, *, win, p, title, choices, on_done):
+		if p.type == 'bool':
+			choices = [PromptChoice({'Value': 'true'}), PromptChoice({'Value': 'false'})]
+
+		if p.type in ('bool', 'choice', 'package') and choices:
+			selected = 0
+			for i, c in enumerate(choices):
+				if c.value == p.default:
+					selected = i
+
+			def on_select(i):
+				if i >= 0 and i < len(choices):
+					on_done(choices[i].value)
+
+			items = [[c.title, c.desc or title] for c in choices]
+			win.show_quick_panel(items, on_select, sublime.MONOSPACE_FONT, selected, None)
+			return
+
+		initial = p.default
+		if not initial and p.type == 'file':
+			initial = gs.active_wd(win=win) + os.sep
+
+		win.show_input_panel(title, initial, on_done, None, None)
 
 	def _on_done_call(self, *, win, cmd, prompts):
+		action_data = {
+			'Prompts': prompts,
+			'TypedPrompts': [p.data for p in cmd.prompts],
+			'Dir': cmd.dir,
+		}
+		if cmd.limits:
+			action_data['Limits'] = cmd.limits
+		if cmd.parse_ansi:
+			action_data['ParseANSI'] = True
+
 		win.run_command('gs9o_win_open', {
 			'run': [cmd.name] + cmd.args,
-			'action_data': {
-				'Prompts': prompts,
-				'Dir': cmd.dir,
-			},
+			'action_data': action_data,
 			'save_hist': False,
 			'focus_view': False,
 			'show_view': True,
@@ -194,6 +238,79 @@ def show_issues(view, issues):
 
 	view.window().show_quick_panel(items or ['No Issues'], on_done, flags, selected, on_highlight)
 
+class margo_declarations(sublime_plugin.TextCommand):
+	def enabled(self):
+		return mg.enabled(self.view)
+
+	def run(self, edit, package=False):
+		act = actions.QueryDeclarations.copy()
+		act['Data'] = {'Package': package}
+		mg.send(view=self.view, actions=[act], cb=self._cb)
+
+	def _cb(self, rs):
+		view = self.view
+		vp = ViewPathName(view)
+		index = []
+
+		def flatten(decls, depth):
+			for d in decls:
+				index.append((depth, d))
+				flatten(d.children, depth + 1)
+
+		flatten(rs.state.declarations, 0)
+
+		items = []
+		for depth, d in index:
+			fn = os.path.basename(d.path or vp.name)
+			items.append(['%s%s %s' % ('    ' * depth, d.kind, d.name), '%s:%d %s' % (fn, d.row + 1, d.detail)])
+
+		def on_done(i):
+			if i >= 0 and i < len(index):
+				d = index[i][1]
+				gs.focus(d.path or vp.name or vp.path, row=d.row, col=d.col, win=view.window(), focus_pat='')
+
+		view.window().show_quick_panel(items or ['No declarations'], on_done, sublime.MONOSPACE_FONT)
+
+class margo_cmd_input(sublime_plugin.TextCommand):
+	'''send data to the stdin of a command started with RunCmd.Interactive
+
+	if neither fd nor cancel_id is set, the command that last sent output is used.
+	if data is None, the user is prompted for a line of input.
+	'''
+
+	def run(self, edit, fd='', cancel_id='', data=None, close=False):
+		fd = fd or ('' if cancel_id else mg.cmd_input_fd)
+		if not fd and not cancel_id:
+			sublime.status_message('margo: no running command to send input to')
+			return
+
+		if data is not None:
+			self._send(fd=fd, cancel_id=cancel_id, data=data, close=close)
+			return
+
+		win = self.view.window() or sublime.active_window()
+		win.show_input_panel(
+			'Input to %s' % (cancel_id or fd),
+			'',
+			lambda s: self._send(fd=fd, cancel_id=cancel_id, data=s + '\n', close=close),
+			None,
+			None,
+		)
+
+	def _send(self, *, fd, cancel_id, data, close):
+		act = actions.CmdInput.copy()
+		act['Data'] = {
+			'Fd': fd,
+			'CancelID': cancel_id,
+			'Data': data,
+			'Close': close,
+		}
+		mg.send(view=self.view, actions=[act], cb=self._cb)
+
+	def _cb(self, rs):
+		if rs.error:
+			sublime.status_message('margo: %s' % rs.error)
+
 class MargoFmtCommand(sublime_plugin.TextCommand):
 	def run(self, edit):
 		if mg.enabled(self.view):
@@ -2,6 +2,7 @@ package bolt
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	bolt "github.com/coreos/bbolt"
 	"github.com/ugorji/go/codec"
@@ -14,6 +15,9 @@ import (
 )
 
 var (
+	// ErrNotFound is returned by DataStore.Load if the key doesn't exist
+	ErrNotFound = errors.New("key not found")
+
 	DS = func() *DataStore {
 		dir := os.Getenv("MARGO_DATA_DIR")
 		if dir == "" {
@@ -94,9 +98,12 @@ func (ds *DataStore) Load(key, ptr interface{}) error {
 	return ds.view(func(tx *bolt.Tx) error {
 		bck := tx.Bucket(ds.Bucket)
 		if bck == nil {
-			return bolt.ErrBucketNotFound
+			return ErrNotFound
 		}
 		s := bck.Get(k)
+		if s == nil {
+			return ErrNotFound
+		}
 		return ds.decodeVal(s, ptr)
 	})
 }
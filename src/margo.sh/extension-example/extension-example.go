@@ -11,6 +11,10 @@ func Margo(m mg.Args) {
 	// See the documentation for `mg.Reducer`
 	// comments beginning with `gs:` denote features that replace old GoSublime settings
 
+	// set default resource limits for commands run from the 9o panel or UserCmds
+	// the key is the command name, optionally followed by its first arg
+	// mg.CmdLimits["go test"] = mg.ProcLimits{Timeout: 10 * time.Minute, AddressSpace: 8 << 30}
+
 	// add our reducers (margo plugins) to the store
 	// they are run in the specified order
 	// and should ideally not block for more than a couple milliseconds
@@ -77,6 +81,8 @@ func Margo(m mg.Args) {
 		// golang.GoFmt,
 		// or
 		// golang.GoImports,
+		// or, to add and remove imports without installing `goimports`
+		// golang.OrganizeImports,
 
 		// Configure general auto-completion behaviour
 		&golang.MarGocodeCtl{
@@ -115,11 +121,63 @@ func Margo(m mg.Args) {
 		// gs: this replaces the `calltips` setting
 		&golang.GocodeCalltips{},
 
-		// use guru for goto-definition
+		// goto-definition, resolved in-process using the unsaved src of the current view
 		// new commands `goto.definition` and `guru.definition` are defined
+		// `goto.type-definition` goes to the declaration of the type of the identifier instead
 		// gs: by default `goto.definition` is bound to ctrl+.,ctrl+g or cmd+.,cmd+g
+		//
+		// `goto.implementation` lists the types that implement the interface under the cursor,
+		// or the interfaces implemented by the type (or method) under the cursor
+		// it's also called when right-clicking on an identifier
 		&golang.Guru{},
 
+		// find all references to the identifier under the cursor
+		// new commands `goto.references` and `.refs` are defined
+		// the results are listed in the HUD and output panel
+		&golang.References{},
+
+		// rename the identifier under the cursor and all references to it
+		// a new command `go.rename <newName>` is defined
+		// conflicts e.g. shadowing, are reported as issues and nothing is renamed
+		&golang.Rename{},
+
+		// show the signature, package and documentation of the identifier under the mouse
+		// when hovering over it
+		&golang.Tooltips{},
+
+		// list the declarations in the current file (or package) as a tree
+		// a new command `go.outline [-pkg]` is defined
+		// the declarations are also available to the editor through the QueryDeclarations action
+		&golang.Outline{},
+
+		// search the declarations in the current module (or repository) and its dependencies
+		// a new command `.symbols [-unexported] <query>` is defined
+		// packages are indexed when first searched, and re-indexed when their files are saved
+		&golang.Symbols{
+			// index unexported declarations as well
+			// Unexported: true,
+		},
+
+		// list the callers and callees of the function under the cursor as a tree
+		// new commands `go.callers [-depth N]` and `go.callees [-depth N]` are defined
+		// calls through interfaces are listed as possible calls
+		&golang.CallHierarchy{},
+
+		// extract the selection into a new function or variable
+		// new commands `go.extract-func [name]` and `go.extract-var [name]` are defined
+		&golang.Extract{},
+
+		// generate code in the current view
+		// new commands `go.fill-struct` and `go.impl <iface>` are defined
+		&golang.CodeGen{},
+
+		// manage the tags of the struct under the cursor, or the selected fields
+		// a new command `go.tags add|remove|clear [-transform snake|camel|kebab] [-omitempty] [keys...]` is defined
+		&golang.StructTags{
+			// the default naming transform
+			// Transform: "camel",
+		},
+
 		// add some default context aware-ish snippets
 		// gs: this replaces the `autocomplete_snippets` and `default_snippets` settings
 		golang.Snippets,
@@ -192,6 +250,15 @@ func Margo(m mg.Args) {
 		//
 		// You will need to `import "margo.sh/web/nodejs"`
 		// &nodejs.PackageScripts{},
+
+		// Makefile, Taskfile and Magefile add UserCmd entries for each target defined
+		// in the closest Makefile, Taskfile.yml and magefile.go respectively.
+		// Errors in the output of the targets are reported as issues.
+		//
+		// You will need to `import "margo.sh/taskrunner"`
+		// &taskrunner.Makefile{},
+		// &taskrunner.Taskfile{},
+		// &taskrunner.Magefile{},
 	)
 }
 
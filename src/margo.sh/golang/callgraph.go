@@ -0,0 +1,326 @@
+package golang
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"margo.sh/golang/gopkg"
+	"margo.sh/mg"
+	"sort"
+)
+
+// goCall is a call from one function to another
+type goCall struct {
+	Caller *types.Func
+	Callee *types.Func
+	// Pos is the position of the call expression
+	Pos token.Pos
+	// Dynamic is true if Callee is an interface method
+	Dynamic bool
+}
+
+// callNode is a call in a call hierarchy
+type callNode struct {
+	// Fn is the caller or callee
+	Fn *types.Func
+	// Pos is the position of the call
+	Pos token.Position
+	// Possible is true if the call is through an interface
+	// and it's not known statically whether Fn is called
+	Possible bool
+	Children []*callNode
+}
+
+// callGraph is the static call graph of a list of packages.
+//
+// Calls in func literals are attributed to the function that declares them.
+// Calls in the initializers of package-level vars are ignored.
+type callGraph struct {
+	sc    *srcChecker
+	calls []goCall
+	named []*types.TypeName
+}
+
+// checkRoot type-checks all the packages under root, including their tests.
+// Packages are checked after the packages they import, so objects are shared between them.
+func (sc *srcChecker) checkRoot(root string) []*srcPkg {
+	bps := map[string]*build.Package{}
+	dirs := []string{}
+	walkPkgDirs(sc.bld, root, func(bp *build.Package) {
+		bps[bp.Dir] = bp
+		dirs = append(dirs, bp.Dir)
+	})
+
+	pkgs := []*srcPkg{}
+	visited := map[string]bool{}
+	var visit func(dir string)
+	visit = func(dir string) {
+		if visited[dir] {
+			return
+		}
+		visited[dir] = true
+		bp := bps[dir]
+		for _, l := range [][]string{bp.Imports, bp.TestImports} {
+			for _, ipath := range l {
+				if pp, err := gopkg.FindPkg(sc.mx, ipath, dir); err == nil && bps[pp.Dir] != nil {
+					visit(pp.Dir)
+				}
+			}
+		}
+		if sp, err := sc.checkDir(dir, false); err == nil {
+			pkgs = append(pkgs, sp)
+		}
+	}
+	for _, dir := range dirs {
+		visit(dir)
+	}
+	for _, dir := range dirs {
+		if sp, err := sc.checkDir(dir, true); err == nil {
+			pkgs = append(pkgs, sp)
+		}
+	}
+	return pkgs
+}
+
+// newCallGraph returns the call graph of the packages in pkgs
+func newCallGraph(sc *srcChecker, pkgs []*srcPkg) *callGraph {
+	cg := &callGraph{sc: sc}
+	tpkgs := make([]*types.Package, len(pkgs))
+	for i, sp := range pkgs {
+		tpkgs[i] = sp.Pkg
+		for _, af := range sp.Files {
+			for _, d := range af.Decls {
+				fd, ok := d.(*ast.FuncDecl)
+				if !ok || fd.Body == nil {
+					continue
+				}
+				caller, _ := sp.Info.Defs[fd.Name].(*types.Func)
+				if caller == nil {
+					continue
+				}
+				cg.addCalls(sp.Info, caller, fd.Body)
+			}
+		}
+	}
+	cg.named = implTypeNames(tpkgs)
+	return cg
+}
+
+func (cg *callGraph) addCalls(info *types.Info, caller *types.Func, body *ast.BlockStmt) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if callee, dynamic := calleeOf(info, call); callee != nil {
+			cg.calls = append(cg.calls, goCall{
+				Caller:  caller,
+				Callee:  funcOrigin(callee),
+				Pos:     call.Lparen,
+				Dynamic: dynamic,
+			})
+		}
+		return true
+	})
+}
+
+// calleeOf returns the function called by call.
+// dynamic is true if it's a call to an interface method.
+func calleeOf(info *types.Info, call *ast.CallExpr) (fn *types.Func, dynamic bool) {
+	x := call.Fun
+	for {
+		switch f := x.(type) {
+		case *ast.ParenExpr:
+			x = f.X
+		case *ast.IndexExpr:
+			x = f.X
+		case *ast.Ident:
+			fn, _ = info.Uses[f].(*types.Func)
+			return fn, false
+		case *ast.SelectorExpr:
+			sel := info.Selections[f]
+			if sel == nil {
+				// a qualified identifier e.g. pkg.Func
+				fn, _ = info.Uses[f.Sel].(*types.Func)
+				return fn, false
+			}
+			fn, _ = sel.Obj().(*types.Func)
+			return fn, sel.Kind() == types.MethodVal && types.IsInterface(sel.Recv())
+		default:
+			if x = indexListX(x); x == nil {
+				return nil, false
+			}
+		}
+	}
+}
+
+// callers returns the calls to fn.
+// If fn is a method, calls to interface methods that it implements are possible callers.
+func (cg *callGraph) callers(fn *types.Func, depth int) []*callNode {
+	return cg.tree(fn, depth, map[*types.Func]bool{}, cg.callersOf)
+}
+
+// callees returns the calls made by fn.
+// Calls to interface methods are expanded to the methods that implement them.
+func (cg *callGraph) callees(fn *types.Func, depth int) []*callNode {
+	return cg.tree(fn, depth, map[*types.Func]bool{}, cg.calleesOf)
+}
+
+func (cg *callGraph) tree(fn *types.Func, depth int, seen map[*types.Func]bool, f func(*types.Func) []*callNode) []*callNode {
+	if depth <= 0 || seen[fn] {
+		return nil
+	}
+	seen[fn] = true
+	defer delete(seen, fn)
+
+	l := f(fn)
+	for _, nd := range l {
+		nd.Children = cg.tree(nd.Fn, depth-1, seen, f)
+	}
+	return l
+}
+
+func (cg *callGraph) callersOf(fn *types.Func) []*callNode {
+	l := []*callNode{}
+	for _, c := range cg.calls {
+		switch {
+		case c.Callee == fn:
+			l = append(l, &callNode{Fn: c.Caller, Pos: cg.sc.fset.Position(c.Pos)})
+		case c.Dynamic && c.Callee.Name() == fn.Name() && cg.implementsMethod(fn, c.Callee):
+			l = append(l, &callNode{Fn: c.Caller, Pos: cg.sc.fset.Position(c.Pos), Possible: true})
+		}
+	}
+	sortCallNodes(l)
+	return l
+}
+
+func (cg *callGraph) calleesOf(fn *types.Func) []*callNode {
+	l := []*callNode{}
+	for _, c := range cg.calls {
+		if c.Caller != fn {
+			continue
+		}
+		pos := cg.sc.fset.Position(c.Pos)
+		l = append(l, &callNode{Fn: c.Callee, Pos: pos, Possible: c.Dynamic})
+		if !c.Dynamic {
+			continue
+		}
+		impls, _ := methodImpls(c.Callee, cg.named)
+		for _, im := range impls {
+			if m, ok := im.Obj.(*types.Func); ok {
+				l = append(l, &callNode{Fn: m, Pos: pos, Possible: true})
+			}
+		}
+	}
+	sortCallNodes(l)
+	return l
+}
+
+// implementsMethod returns true if the concrete method fn implements the interface method im
+func (cg *callGraph) implementsMethod(fn, im *types.Func) bool {
+	recv := fn.Type().(*types.Signature).Recv()
+	irecv := im.Type().(*types.Signature).Recv()
+	if recv == nil || irecv == nil {
+		return false
+	}
+	t := recv.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	iface, ok := irecv.Type().Underlying().(*types.Interface)
+	if !ok || types.IsInterface(t) {
+		return false
+	}
+	return implements(t, iface) != nil
+}
+
+func sortCallNodes(l []*callNode) {
+	sort.SliceStable(l, func(i, j int) bool {
+		p, q := l[i].Pos, l[j].Pos
+		if p.Filename != q.Filename {
+			return p.Filename < q.Filename
+		}
+		return p.Offset < q.Offset
+	})
+}
+
+// funcDesc returns the name of fn qualified by its package name and receiver type e.g. `*a.T.Get`
+func funcDesc(fn *types.Func) string {
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		return qualifiedName(recv.Type()) + "." + fn.Name()
+	}
+	if fn.Pkg() == nil {
+		return fn.Name()
+	}
+	return fn.Pkg().Name() + "." + fn.Name()
+}
+
+// findCallGraph type-checks the packages in the module (or repository) of the current view
+// and returns their call graph and the function under the cursor.
+//
+// The function is the one whose name is under the cursor e.g. in a call,
+// or the function declaration that encloses the cursor.
+func findCallGraph(sc *srcChecker) (*callGraph, *types.Func, error) {
+	cg, err := buildCallGraph(sc)
+	if err != nil {
+		return nil, nil, err
+	}
+	fn, err := cg.funcAt(sc.mx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cg, fn, nil
+}
+
+// buildCallGraph type-checks the packages in the module (or repository) of the current view
+// and returns their call graph
+func buildCallGraph(sc *srcChecker) (*callGraph, error) {
+	var pkgs []*srcPkg
+	v := sc.mx.View
+	if v.Path != "" {
+		pkgs = sc.checkRoot(searchRoot(sc.mx, v.Dir()))
+	}
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, err
+	}
+	if sc.srcPkgOf(sp.Pkg) == nil || v.Path == "" {
+		// the view is not part of any checked package
+		pkgs = append(pkgs, sp)
+	}
+	return newCallGraph(sc, pkgs), nil
+}
+
+// funcAt returns the function under the cursor in mx.View.
+// The view must be the one the graph was built for, but the cursor might have moved.
+func (cg *callGraph) funcAt(mx *mg.Ctx) (*types.Func, error) {
+	sc := cg.sc
+	sc.mx = mx
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, err
+	}
+
+	v := mx.View
+	cx := NewViewCursorCtx(mx)
+	if nm, _ := cx.FuncDeclName(); nm == "" {
+		// it's not the name of a declaration, so it might be a call, or a reference to a function
+		if _, obj := sp.identAt(sc.fset, v.Filename(), v.Pos); obj != nil {
+			if fn, ok := obj.(*types.Func); ok {
+				return funcOrigin(fn), nil
+			}
+		}
+	}
+	var fd *ast.FuncDecl
+	if !cx.Set(&fd) || fd.Name == nil {
+		return nil, fmt.Errorf("no function under the cursor")
+	}
+	_, obj := sp.identAt(sc.fset, v.Filename(), cx.TokenFile.Offset(fd.Name.Pos()))
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("cannot find the declaration of `%s`", fd.Name.Name)
+	}
+	return funcOrigin(fn), nil
+}
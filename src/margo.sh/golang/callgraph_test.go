@@ -0,0 +1,142 @@
+package golang
+
+import (
+	"fmt"
+	"margo.sh/mg"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCallGraph(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": `package a
+
+type Getter interface{ Get() int }
+
+type T struct{ N int }
+
+func (t *T) Get() int { return t.N }
+
+func New(n int) *T { return &T{N: n} }
+
+func Use(g Getter) int { return g.Get() }
+`,
+		"ex/b/b.go": `package b
+
+import "ex/a"
+
+func F() int {
+	t := a.New(1)
+	return a.Use(t) + t.Get()
+}
+
+func G() int { return F() }
+`,
+	})
+	defer cleanup()
+
+	str := func(nodes []*callNode) string {
+		var f func(indent string, nodes []*callNode) string
+		f = func(indent string, nodes []*callNode) string {
+			s := ""
+			for _, nd := range nodes {
+				possible := ""
+				if nd.Possible {
+					possible = "possible "
+				}
+				fn := filepath.Base(filepath.Dir(nd.Pos.Filename)) + "/" + filepath.Base(nd.Pos.Filename)
+				s += fmt.Sprintf("%s%s%s %s:%d\n", indent, possible, funcDesc(nd.Fn), fn, nd.Pos.Line)
+				s += f(indent+"\t", nd.Children)
+			}
+			return s
+		}
+		return strings.TrimSpace(f("", nodes))
+	}
+
+	cases := []struct {
+		name    string
+		fn      string
+		src     string
+		callers bool
+		depth   int
+		exp     string
+	}{
+		{
+			name:    "callers of method",
+			fn:      "ex/a/a.go",
+			src:     "package a\n\ntype Getter interface{ Get() int }\n\ntype T struct{ N int }\n\nfunc (t *T) G‸et() int { return t.N }\n\nfunc New(n int) *T { return &T{N: n} }\n\nfunc Use(g Getter) int { return g.Get() }\n",
+			callers: true,
+			depth:   2,
+			exp: `
+possible a.Use a/a.go:11
+	b.F b/b.go:7
+b.F b/b.go:7
+	b.G b/b.go:10`,
+		},
+		{
+			name:  "callees in unsaved src",
+			fn:    "ex/b/b.go",
+			src:   "package b\n\nimport \"ex/a\"\n\nfunc F() int {\n\tt := a.New(1)\n\treturn a.Use(t)‸\n}\n",
+			depth: 2,
+			exp: `
+a.New b/b.go:6
+a.Use b/b.go:7
+	possible a.Getter.Get a/a.go:11
+	possible *a.T.Get a/a.go:11`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := newCtx(c.fn, c.src)
+			defer mx.Cancel()
+
+			cg, fn, err := findCallGraph(newSrcChecker(mx))
+			if err != nil {
+				t.Fatalf("findCallGraph() failed: %s", err)
+			}
+			nodes := cg.callees(fn, c.depth)
+			if c.callers {
+				nodes = cg.callers(fn, c.depth)
+			}
+			if s, exp := str(nodes), strings.TrimSpace(c.exp); s != exp {
+				t.Errorf("expected:\n%s\ngot:\n%s", exp, s)
+			}
+		})
+	}
+}
+
+func TestCallHierarchyCache(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": "package a\n\nfunc New() int { return 1 }\n\nfunc F() int {\n\treturn New()\n}\n",
+	})
+	defer cleanup()
+
+	ctx := func(hash, src string) *mg.Ctx {
+		mx := newCtx("ex/a/a.go", src)
+		return mx.SetView(mx.View.Copy(func(v *mg.View) { v.Hash = hash }))
+	}
+	ch := &CallHierarchy{}
+	cg, fn, err := ch.callGraph(ctx("1", "package a\n\nfunc New() int { return 1 }\n\nfunc F() int {\n\t‸return New()\n}\n"))
+	if err != nil {
+		t.Fatalf("callGraph() failed: %s", err)
+	}
+	if fn.Name() != "F" {
+		t.Errorf("expected the enclosing function `F`, got `%s`", fn.Name())
+	}
+
+	cg2, fn, err := ch.callGraph(ctx("1", "package a\n\nfunc New() int { return 1 }\n\nfunc F() int {\n\treturn Ne‸w()\n}\n"))
+	if err != nil {
+		t.Fatalf("callGraph() failed: %s", err)
+	}
+	if cg2 != cg {
+		t.Errorf("the graph was not reused while the view was unchanged")
+	}
+	if fn.Name() != "New" {
+		t.Errorf("expected the called function `New`, got `%s`", fn.Name())
+	}
+
+	if cg3, _, _ := ch.callGraph(ctx("2", "")); cg3 == cg {
+		t.Errorf("the graph was reused after the view changed")
+	}
+}
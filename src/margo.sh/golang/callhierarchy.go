@@ -0,0 +1,164 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"sync"
+)
+
+// CallHierarchy adds the builtin commands `go.callers` and `go.callees`
+// that list the incoming and outgoing calls of the function under the cursor.
+//
+// The call graph is built from all the packages in the current module (or repository),
+// using the unsaved src of the current view.
+// The graph is reused by later searches until the view changes.
+// Calls through interfaces are marked as possible calls.
+// The results are written to the output panel and listed as a tree in the HUD.
+// Use `-depth N` to list the callers of callers (or callees of callees) up to N levels deep.
+type CallHierarchy struct {
+	mg.ReducerType
+
+	hud linksHUD
+
+	// mu serialises the searches, because they share the graph.
+	// cg is the call graph of the last search, and cgKey identifies the view it was built for.
+	mu    sync.Mutex
+	cg    *callGraph
+	cgKey string
+}
+
+func (ch *CallHierarchy) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (ch *CallHierarchy) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State
+	switch mx.Action.(type) {
+	case mg.QueryUserCmds:
+		st = st.AddUserCmds(
+			mg.UserCmd{
+				Title: "Go Callers",
+				Name:  "go.callers",
+				Desc:  "list the calls to the function under the cursor",
+			},
+			mg.UserCmd{
+				Title: "Go Callees",
+				Name:  "go.callees",
+				Desc:  "list the calls made by the function under the cursor",
+			},
+		)
+	case mg.RunCmd:
+		st = st.AddBuiltinCmds(
+			mg.BuiltinCmd{Name: "go.callers", Desc: "List the calls to the function under the cursor. Usage: go.callers [-depth N]", Run: ch.runCallers},
+			mg.BuiltinCmd{Name: "go.callees", Desc: "List the calls made by the function under the cursor. Usage: go.callees [-depth N]", Run: ch.runCallees},
+		)
+	}
+	return ch.hud.reduce(mx, st, "Call Hierarchy")
+}
+
+func (ch *CallHierarchy) runCallers(cx *mg.CmdCtx) *mg.State {
+	go ch.hierarchy(cx, true)
+	return cx.State
+}
+
+func (ch *CallHierarchy) runCallees(cx *mg.CmdCtx) *mg.State {
+	go ch.hierarchy(cx, false)
+	return cx.State
+}
+
+func (ch *CallHierarchy) hierarchy(cx *mg.CmdCtx, callers bool) {
+	defer cx.Output.Close()
+	defer cx.Begin(mg.Task{Title: "Go/" + cx.Name, ShowNow: true}).Done()
+
+	depth := cx.IntFlag("depth", 1)
+	if depth < 1 {
+		fmt.Fprintln(cx.Output, "Error: depth must be a positive number")
+		return
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	cg, fn, err := ch.callGraph(cx.Ctx)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
+		return
+	}
+	title := "calls made by `" + funcDesc(fn) + "`"
+	nodes := cg.callees(fn, depth)
+	if callers {
+		title = "calls to `" + funcDesc(fn) + "`"
+		nodes = cg.callers(fn, depth)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%d %s\n", len(nodes), title)
+	ch.printTree(buf, cx, cg, nodes, "\t")
+	cx.Output.Write(buf.Bytes())
+
+	hud := htm.Div(nil, htm.Textf("%d %s", len(nodes), title), ch.hudTree(cx, cg, nodes))
+	ch.hud.set(cx.Ctx, hud)
+}
+
+// callGraph returns the call graph for the view in mx, and the function under the cursor.
+// The graph of the last search is reused if the view hasn't changed since.
+// ch.mu must be held.
+func (ch *CallHierarchy) callGraph(mx *mg.Ctx) (*callGraph, *types.Func, error) {
+	v := mx.View
+	k := v.Filename() + "\x00" + v.Hash
+	if ch.cg == nil || ch.cgKey != k || v.Hash == "" {
+		cg, err := buildCallGraph(newSrcChecker(mx))
+		if err != nil {
+			return nil, nil, err
+		}
+		ch.cg = cg
+		ch.cgKey = k
+	}
+	fn, err := ch.cg.funcAt(mx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch.cg, fn, nil
+}
+
+func (ch *CallHierarchy) printTree(buf *bytes.Buffer, cx *mg.CmdCtx, cg *callGraph, nodes []*callNode, indent string) {
+	for _, nd := range nodes {
+		possible := ""
+		if nd.Possible {
+			possible = "possible: "
+		}
+		fn := mgutil.ShortFn(nd.Pos.Filename, cx.Env)
+		fmt.Fprintf(buf, "%s%s:%d:%d: %s%s\n", indent, fn, nd.Pos.Line, nd.Pos.Column, possible, funcDesc(nd.Fn))
+		ch.printTree(buf, cx, cg, nd.Children, indent+"\t")
+	}
+}
+
+func (ch *CallHierarchy) hudTree(cx *mg.CmdCtx, cg *callGraph, nodes []*callNode) htm.Element {
+	items := make([]htm.Element, 0, len(nodes))
+	for _, nd := range nodes {
+		els := []htm.Element{}
+		if nd.Possible {
+			els = append(els, htm.EmText("possible "))
+		}
+		// link the name to the declaration, and the position to the call
+		if pos, err := cg.sc.declPos(nd.Fn); err == nil {
+			els = append(els, htm.A(&htm.AAttrs{Action: posActivate(cx.View, pos)}, htm.Text(funcDesc(nd.Fn))))
+		} else {
+			els = append(els, htm.Text(funcDesc(nd.Fn)))
+		}
+		fn := mgutil.ShortFn(nd.Pos.Filename, cx.Env)
+		els = append(els,
+			htm.Text(" "),
+			htm.A(&htm.AAttrs{Action: posActivate(cx.View, nd.Pos)}, htm.Textf("%s:%d", fn, nd.Pos.Line)),
+		)
+		if len(nd.Children) != 0 {
+			els = append(els, ch.hudTree(cx, cg, nd.Children))
+		}
+		items = append(items, htm.Li(nil, els...))
+	}
+	return htm.Ul(nil, items...)
+}
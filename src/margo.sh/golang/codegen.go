@@ -0,0 +1,389 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"margo.sh/mg"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type codeGenAct struct {
+	mg.ActionType
+	fn   string
+	hash string
+	src  []byte
+}
+
+// CodeGen adds builtin commands that generate code in the current view.
+//
+// `go.fill-struct` sets all the missing fields of the composite literal under the cursor to their zero value.
+//
+// `go.impl <iface>` adds stubs for the methods of the interface iface, that are missing from the type under the cursor.
+// The interface is named by its package e.g. `io.Reader` or `net/http.Handler`,
+// or by the import path and name as separate args e.g. `go.impl net/http Handler`.
+//
+// Imports required by the generated code are added, and the result is formatted with gofmt.
+type CodeGen struct {
+	mg.ReducerType
+}
+
+func (cg *CodeGen) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (cg *CodeGen) Reduce(mx *mg.Ctx) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(
+			mg.UserCmd{
+				Title: "Fill Struct",
+				Name:  "go.fill-struct",
+				Desc:  "set the missing fields of the struct literal under the cursor to their zero value",
+			},
+			mg.UserCmd{
+				Title: "Implement Interface",
+				Name:  "go.impl",
+				Desc:  "add stubs for the methods of an interface to the type under the cursor",
+				Args:  []string{"{{index .Prompts 0}}", "{{index .Prompts 1}}"},
+				TypedPrompts: []mg.Prompt{
+					{Title: "Package", Type: mg.PromptTypePackage},
+					{Title: "Interface"},
+				},
+			},
+		)
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(
+			mg.BuiltinCmd{
+				Name: "go.fill-struct",
+				Desc: "Set the missing fields of the struct literal under the cursor to their zero value",
+				Run:  cg.runFillStruct,
+			},
+			mg.BuiltinCmd{
+				Name: "go.impl",
+				Desc: "Add stubs for the methods of an interface to the type under the cursor e.g. `go.impl io.Reader`",
+				Run:  cg.runImpl,
+			},
+		)
+	case codeGenAct:
+		v := mx.View
+		if v.Filename() == act.fn && v.Hash == act.hash {
+			return mx.SetViewSrc(act.src)
+		}
+	}
+	return mx.State
+}
+
+func (cg *CodeGen) runFillStruct(cx *mg.CmdCtx) *mg.State {
+	go cg.gen(cx, func(sc *srcChecker) ([]byte, error) {
+		return fillStruct(sc)
+	})
+	return cx.State
+}
+
+func (cg *CodeGen) runImpl(cx *mg.CmdCtx) *mg.State {
+	var path, name string
+	switch len(cx.Args) {
+	case 1:
+		name = cx.Args[0]
+		if i := strings.LastIndexByte(name, '.'); i > strings.LastIndexByte(name, '/') {
+			path, name = name[:i], name[i+1:]
+		}
+	case 2:
+		path, name = cx.Args[0], cx.Args[1]
+	default:
+		defer cx.Output.Close()
+		fmt.Fprintln(cx.Output, "usage: go.impl <iface> e.g. `go.impl io.Reader`")
+		return cx.State
+	}
+	go cg.gen(cx, func(sc *srcChecker) ([]byte, error) {
+		return implStubs(sc, path, name)
+	})
+	return cx.State
+}
+
+func (cg *CodeGen) gen(cx *mg.CmdCtx, f func(sc *srcChecker) ([]byte, error)) {
+	defer cx.Output.Close()
+
+	src, err := f(newSrcChecker(cx.Ctx))
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
+		return
+	}
+	v := cx.View
+	cx.Store.Dispatch(codeGenAct{fn: v.Filename(), hash: v.Hash, src: src})
+}
+
+// viewFile type-checks the current view and returns its package, file and the position of the cursor
+func viewFile(sc *srcChecker) (*srcPkg, *ast.File, token.Pos, error) {
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, nil, token.NoPos, err
+	}
+	v := sc.mx.View
+	af := sp.file(sc.fset, v.Filename())
+	if af == nil {
+		return nil, nil, token.NoPos, fmt.Errorf("cannot parse %s", v.Basename())
+	}
+	tf := sc.fset.File(af.Pos())
+	if v.Pos < 0 || v.Pos > tf.Size() {
+		return nil, nil, token.NoPos, fmt.Errorf("the cursor is outside the file")
+	}
+	return sp, af, tf.Pos(v.Pos), nil
+}
+
+// fillStruct returns the src of the current view with the missing fields
+// of the composite literal under the cursor set to their zero value
+func fillStruct(sc *srcChecker) ([]byte, error) {
+	sp, af, pos, err := viewFile(sc)
+	if err != nil {
+		return nil, err
+	}
+	var lit *ast.CompositeLit
+	ast.Inspect(af, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos > n.End() {
+			return false
+		}
+		if x, ok := n.(*ast.CompositeLit); ok {
+			if t := sp.Info.TypeOf(x); t != nil {
+				if _, ok := t.Underlying().(*types.Struct); ok {
+					lit = x
+				}
+			}
+		}
+		return true
+	})
+	if lit == nil {
+		return nil, fmt.Errorf("the cursor is not in a struct literal")
+	}
+	st := sp.Info.TypeOf(lit).Underlying().(*types.Struct)
+
+	present := map[string]bool{}
+	for _, el := range lit.Elts {
+		kv, ok := el.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("the struct literal has fields without keys")
+		}
+		if id, ok := kv.Key.(*ast.Ident); ok {
+			present[id.Name] = true
+		}
+	}
+
+	var imps impSpecList
+	qual := fileQualifier(af, sp.Pkg, &imps)
+	fields := &bytes.Buffer{}
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if present[f.Name()] || f.Name() == "_" || (!f.Exported() && f.Pkg() != sp.Pkg) {
+			continue
+		}
+		fmt.Fprintf(fields, "%s: %s,\n", f.Name(), zeroValue(f.Type(), qual))
+	}
+	if fields.Len() == 0 {
+		return nil, fmt.Errorf("all the fields are already set")
+	}
+
+	tf := sc.fset.File(af.Pos())
+	src, err := sc.readFile(tf.Name())
+	if err != nil {
+		return nil, err
+	}
+	lbrace, rbrace := tf.Offset(lit.Lbrace), tf.Offset(lit.Rbrace)
+	elts := bytes.TrimSpace(src[lbrace+1 : rbrace])
+	buf := &bytes.Buffer{}
+	buf.Write(src[:lbrace+1])
+	buf.WriteByte('\n')
+	if len(elts) != 0 {
+		buf.Write(elts)
+		if !bytes.HasSuffix(elts, []byte(",")) {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.Write(fields.Bytes())
+	buf.Write(src[rbrace:])
+	return gofmtImports(tf.Name(), buf.Bytes(), imps)
+}
+
+// zeroValue returns an expression for the zero value of t
+func zeroValue(t types.Type, qual types.Qualifier) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		}
+		return "nil"
+	case *types.Struct, *types.Array:
+		return types.TypeString(t, qual) + "{}"
+	case *types.Interface:
+		if isTypeParam(t) {
+			return "*new(" + types.TypeString(t, qual) + ")"
+		}
+	}
+	return "nil"
+}
+
+// implStubs returns the src of the current view with stubs for the methods of the interface name
+// declared in the package path, that are missing from the type under the cursor.
+// If path is empty, the interface is looked up in the view's package.
+func implStubs(sc *srcChecker, path, name string) ([]byte, error) {
+	sp, af, pos, err := viewFile(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	tn, decl := implRecv(sc, sp, af, pos)
+	if tn == nil {
+		return nil, fmt.Errorf("the cursor is not on a type declared in this package")
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok || types.IsInterface(named) {
+		return nil, fmt.Errorf("`%s` is not a concrete type", tn.Name())
+	}
+
+	itn, iface, err := lookupIface(sc, sp, path, name)
+	if err != nil {
+		return nil, err
+	}
+	if itn.Pkg() != sp.Pkg {
+		name = itn.Pkg().Name() + "." + name
+	}
+
+	recvName, ptr := recvStyle(named)
+	var imps impSpecList
+	qual := fileQualifier(af, sp.Pkg, &imps)
+	buf := &bytes.Buffer{}
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, m.Pkg(), m.Name())
+		switch x := obj.(type) {
+		case nil:
+		case *types.Func:
+			if types.Identical(x.Type().(*types.Signature), m.Type().(*types.Signature)) {
+				continue
+			}
+			return nil, fmt.Errorf("`%s` has a method `%s` with a different signature", tn.Name(), m.Name())
+		default:
+			return nil, fmt.Errorf("`%s` has a field named `%s`", tn.Name(), m.Name())
+		}
+		if !m.Exported() && m.Pkg() != sp.Pkg {
+			return nil, fmt.Errorf("`%s` has the unexported method `%s`", name, m.Name())
+		}
+
+		sig := m.Type().(*types.Signature)
+		recv := recvName
+		for j := 0; j < sig.Params().Len(); j++ {
+			if sig.Params().At(j).Name() == recv {
+				recv = ""
+			}
+		}
+		recvType := tn.Name() + typeParamsStr(named)
+		if ptr {
+			recvType = "*" + recvType
+		}
+		if recv != "" {
+			recvType = recv + " " + recvType
+		}
+		fmt.Fprintf(buf, "\n\n// %s implements %s\n", m.Name(), name)
+		fmt.Fprintf(buf, "func (%s) %s", recvType, m.Name())
+		types.WriteSignature(buf, sig, qual)
+		buf.WriteString(" {\n\tpanic(\"not implemented\")\n}")
+	}
+	if buf.Len() == 0 {
+		return nil, fmt.Errorf("`%s` already implements `%s`", tn.Name(), name)
+	}
+
+	tf := sc.fset.File(af.Pos())
+	src, err := sc.readFile(tf.Name())
+	if err != nil {
+		return nil, err
+	}
+	at := len(src)
+	if decl != nil {
+		at = tf.Offset(decl.End())
+	}
+	out := append(append(append([]byte{}, src[:at]...), buf.Bytes()...), src[at:]...)
+	return gofmtImports(tf.Name(), out, imps)
+}
+
+// implRecv returns the type under the cursor, and its declaration if it's in af.
+// The cursor may be on the type's name, or anywhere in its declaration.
+func implRecv(sc *srcChecker, sp *srcPkg, af *ast.File, pos token.Pos) (*types.TypeName, *ast.GenDecl) {
+	var tn *types.TypeName
+	v := sc.mx.View
+	if _, obj := sp.identAt(sc.fset, v.Filename(), v.Pos); obj != nil && obj.Pkg() == sp.Pkg {
+		tn, _ = obj.(*types.TypeName)
+	}
+	for _, d := range af.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			obj, _ := sp.Info.Defs[ts.Name].(*types.TypeName)
+			switch {
+			case obj == nil:
+			case tn == obj:
+				return tn, gd
+			case tn == nil && ts.Pos() <= pos && pos <= ts.End():
+				return obj, gd
+			}
+		}
+	}
+	return tn, nil
+}
+
+// lookupIface returns the interface name declared in the package path
+func lookupIface(sc *srcChecker, sp *srcPkg, path, name string) (*types.TypeName, *types.Interface, error) {
+	pkg := sp.Pkg
+	if path != "" && path != pkg.Path() {
+		dir := sc.mx.View.Dir()
+		var err error
+		pkg, err = sc.ImportFrom(path, dir, 0)
+		if err != nil && !strings.Contains(path, "/") {
+			// it might be a package name e.g. `http` instead of `net/http`
+			if ipath := mctl.importPathByName(path, dir); ipath != "" {
+				pkg, err = sc.ImportFrom(ipath, dir, 0)
+			}
+		}
+		if pkg == nil {
+			return nil, nil, fmt.Errorf("cannot import `%s`: %s", path, err)
+		}
+	}
+	obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil, nil, fmt.Errorf("`%s` is not a type in package %s", name, pkg.Path())
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil, nil, fmt.Errorf("`%s.%s` is not an interface", pkg.Name(), name)
+	}
+	return obj, iface.Complete(), nil
+}
+
+// recvStyle returns the receiver name used by the methods of t, and whether they use a pointer receiver.
+// If t has no methods, a pointer receiver named after the first letter of its name is returned.
+func recvStyle(t *types.Named) (name string, ptr bool) {
+	for i := 0; i < t.NumMethods(); i++ {
+		recv := t.Method(i).Type().(*types.Signature).Recv()
+		_, ptr = recv.Type().(*types.Pointer)
+		if recv.Name() != "" && recv.Name() != "_" {
+			return recv.Name(), ptr
+		}
+	}
+	if t.NumMethods() != 0 {
+		return "", ptr
+	}
+	r, _ := utf8.DecodeRuneInString(t.Obj().Name())
+	return string(unicode.ToLower(r)), true
+}
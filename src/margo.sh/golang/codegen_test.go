@@ -0,0 +1,133 @@
+package golang
+
+import (
+	"strings"
+	"testing"
+)
+
+const codeGenTestSrc = `package a
+
+import "io"
+
+type Opts struct {
+	Name  string
+	N     int
+	OK    bool
+	R     io.Reader
+	Inner struct{ X int }
+	Arr   [2]byte
+	m     map[string]int
+}
+
+type T struct{}
+
+func (t *T) Close() error { return nil }
+
+var X = Opts{N: 1}
+`
+
+func TestFillStruct(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": codeGenTestSrc,
+	})
+	defer cleanup()
+
+	mx := newCtx("ex/a/a.go", strings.Replace(codeGenTestSrc, "Opts{N", "Opts{‸N", 1))
+	defer mx.Cancel()
+
+	src, err := fillStruct(newSrcChecker(mx))
+	if err != nil {
+		t.Fatalf("fillStruct() failed: %s", err)
+	}
+	exp := `var X = Opts{
+	N:     1,
+	Name:  "",
+	OK:    false,
+	R:     nil,
+	Inner: struct{ X int }{},
+	Arr:   [2]byte{},
+	m:     nil,
+}
+`
+	if !strings.HasSuffix(string(src), exp) {
+		t.Errorf("expected result to end with:\n%s\ngot:\n%s", exp, src)
+	}
+}
+
+func TestImplStubs(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": codeGenTestSrc,
+		"ex/b/b.go": `package b
+
+import "bytes"
+
+type Writer interface {
+	Write(p []byte) (int, error)
+	Flush(buf *bytes.Buffer)
+}
+`,
+	})
+	defer cleanup()
+
+	src := strings.Replace(codeGenTestSrc, "type T ", "type T‸ ", 1)
+	cases := []struct {
+		name string
+		path string
+		exp  []string
+		err  string
+	}{
+		{
+			name: "std",
+			path: "io",
+			exp: []string{
+				"type T struct{}\n\n// Read implements io.ReadCloser\nfunc (t *T) Read(p []byte) (n int, err error) {\n\tpanic(\"not implemented\")\n}\n",
+			},
+		},
+		{
+			name: "imports",
+			path: "ex/b",
+			exp: []string{
+				"import (\n\t\"bytes\"\n\t\"io\"\n)\n",
+				"func (t *T) Flush(buf *bytes.Buffer) {",
+				"func (t *T) Write(p []byte) (int, error) {",
+			},
+		},
+		{
+			name: "not an interface",
+			path: "ex/a",
+			err:  "not an interface",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := newCtx("ex/a/a.go", src)
+			defer mx.Cancel()
+
+			name := "ReadCloser"
+			switch c.path {
+			case "ex/b":
+				name = "Writer"
+			case "ex/a":
+				name = "Opts"
+			}
+			out, err := implStubs(newSrcChecker(mx), c.path, name)
+			switch {
+			case c.err != "":
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing `%s`, got `%v`", c.err, err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("implStubs() failed: %s", err)
+			}
+			if strings.Contains(string(out), "func (t *T) Close() error {\n\tpanic") {
+				t.Errorf("the existing method Close was stubbed:\n%s", out)
+			}
+			for _, s := range c.exp {
+				if !strings.Contains(string(out), s) {
+					t.Errorf("expected result to contain:\n%s\ngot:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
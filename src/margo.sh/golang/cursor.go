@@ -22,6 +22,7 @@ const (
 	ReturnScope     = cursor.ReturnScope
 	SelectorScope   = cursor.SelectorScope
 	StringScope     = cursor.StringScope
+	StructTagScope  = cursor.StructTagScope
 	TypeDeclScope   = cursor.TypeDeclScope
 	VarScope        = cursor.VarScope
 )
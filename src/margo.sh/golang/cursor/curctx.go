@@ -206,6 +206,9 @@ func newCurCtx(mx *mg.Ctx, src []byte, pos int) *CurCtx {
 		if cx.ImportSpec != nil {
 			cx.Scope |= ImportPathScope
 		}
+		if f := (*ast.Field)(nil); cx.Set(&f) && f.Tag == lit {
+			cx.Scope |= StructTagScope
+		}
 	}
 
 	// we want to allow `kw`, `kw name`, `kw (\n|\n)`
@@ -23,6 +23,7 @@ const (
 	ReturnScope
 	SelectorScope
 	StringScope
+	StructTagScope
 	TypeDeclScope
 	VarScope
 	curScopesEnd
@@ -46,6 +47,7 @@ var (
 		ReturnScope:     "ReturnScope",
 		SelectorScope:   "SelectorScope",
 		StringScope:     "StringScope",
+		StructTagScope:  "StructTagScope",
 		TypeDeclScope:   "TypeDeclScope",
 		VarScope:        "VarScope",
 	}
@@ -0,0 +1,75 @@
+package golang
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"margo.sh/mg"
+)
+
+// findDefinition returns the object under the cursor and the position of its declaration.
+//
+// If typeDef is true, the declaration of the object's type is returned instead.
+// Pointer, slice, array, map and channel types resolve to their element type.
+func findDefinition(sc *srcChecker, typeDef bool) (types.Object, token.Position, error) {
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, token.Position{}, err
+	}
+	v := sc.mx.View
+	id, obj := sp.identAt(sc.fset, v.Filename(), v.Pos)
+	switch {
+	case id == nil:
+		return nil, token.Position{}, fmt.Errorf("no identifier under the cursor")
+	case obj == nil:
+		return nil, token.Position{}, fmt.Errorf("cannot find the declaration of `%s`", id.Name)
+	}
+	if typeDef {
+		tn, err := typeDefOf(obj)
+		if err != nil {
+			return nil, token.Position{}, err
+		}
+		obj = tn
+	}
+	pos, err := sc.declPos(obj)
+	return obj, pos, err
+}
+
+// typeDefOf returns the declaration of the named type of obj
+func typeDefOf(obj types.Object) (*types.TypeName, error) {
+	if _, ok := obj.(*types.PkgName); ok {
+		return nil, fmt.Errorf("`%s` is a package, it has no type", obj.Name())
+	}
+	t := obj.Type()
+	for {
+		switch x := t.(type) {
+		case *types.Named:
+			return x.Obj(), nil
+		case *types.Pointer:
+			t = x.Elem()
+		case *types.Slice:
+			t = x.Elem()
+		case *types.Array:
+			t = x.Elem()
+		case *types.Map:
+			t = x.Elem()
+		case *types.Chan:
+			t = x.Elem()
+		case *types.Basic:
+			return nil, fmt.Errorf("`%s` has the predeclared type `%s`", obj.Name(), x)
+		default:
+			return nil, fmt.Errorf("`%s` has the unnamed type `%s`", obj.Name(), qualifiedName(t))
+		}
+	}
+}
+
+// posActivate returns an action that activates the view at pos.
+// If pos is in the current view and it's not saved, the view is identified by its name.
+func posActivate(v *mg.View, pos token.Position) mg.Activate {
+	act := mg.Activate{Path: pos.Filename, Row: pos.Line - 1, Col: pos.Column - 1}
+	if v.Path == "" && pos.Filename == v.Filename() {
+		act.Path = ""
+		act.Name = v.Name
+	}
+	return act
+}
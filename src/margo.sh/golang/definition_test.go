@@ -0,0 +1,90 @@
+package golang
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindDefinition(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": `package a
+
+type T struct{ N int }
+
+func (t *T) Get() int { return t.N }
+
+func New(n int) *T { return &T{N: n} }
+`,
+		"ex/b/b.go": `package b
+
+import "ex/a"
+
+var X = a.New(2)
+`,
+	})
+	defer cleanup()
+
+	cases := []struct {
+		name    string
+		fn      string
+		src     string
+		typeDef bool
+		obj     string
+		pos     string
+		err     string
+	}{
+		{
+			name: "imported func",
+			fn:   "ex/b/b.go",
+			src:  "package b\n\nimport \"ex/a\"\n\nvar X = a.Ne‸w(2)\n",
+			obj:  "New",
+			pos:  "a/a.go:7:6",
+		},
+		{
+			name: "imported method in unsaved src",
+			fn:   "ex/b/b.go",
+			src:  "package b\n\nimport \"ex/a\"\n\nvar X = a.New(2)\n\nvar Y = X.G‸et()\n",
+			obj:  "Get",
+			pos:  "a/a.go:5:13",
+		},
+		{
+			name:    "type definition",
+			fn:      "ex/b/b.go",
+			src:     "package b\n\nimport \"ex/a\"\n\nvar X‸ = a.New(2)\n",
+			typeDef: true,
+			obj:     "T",
+			pos:     "a/a.go:3:6",
+		},
+		{
+			name:    "predeclared type",
+			fn:      "ex/b/b.go",
+			src:     "package b\n\nvar X‸ = 1\n",
+			typeDef: true,
+			err:     "predeclared type `int`",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := newCtx(c.fn, c.src)
+			defer mx.Cancel()
+
+			obj, pos, err := findDefinition(newSrcChecker(mx), c.typeDef)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findDefinition() failed: %s", err)
+			}
+			if obj.Name() != c.obj {
+				t.Errorf("expected object `%s`, got `%s`", c.obj, obj.Name())
+			}
+			if s := filepath.ToSlash(pos.String()); !strings.HasSuffix(s, "/"+c.pos) {
+				t.Errorf("expected position %s, got %s", c.pos, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,672 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"margo.sh/mg"
+	"strconv"
+	"strings"
+)
+
+type extractAct struct {
+	mg.ActionType
+	fn   string
+	hash string
+	src  []byte
+}
+
+// Extract adds the builtin commands `go.extract-func [name]` and `go.extract-var [name]`
+// that move the selection into a new function or variable.
+//
+// go.extract-func extracts a list of statements, or an expression into a new function
+// declared after the enclosing function. Local variables used in the selection become its parameters,
+// and variables declared or assigned in the selection that are used elsewhere are returned.
+//
+// go.extract-var extracts an expression into a new variable declared before the enclosing statement.
+//
+// The view is updated in a single edit, so the change can be undone in one step.
+type Extract struct {
+	mg.ReducerType
+}
+
+func (e *Extract) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (e *Extract) Reduce(mx *mg.Ctx) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(
+			mg.UserCmd{
+				Title:   "Extract Function",
+				Name:    "go.extract-func",
+				Desc:    "move the selected statements or expression into a new function",
+				Args:    []string{"{{index .Prompts 0}}"},
+				Prompts: []string{"Function name"},
+			},
+			mg.UserCmd{
+				Title:   "Extract Variable",
+				Name:    "go.extract-var",
+				Desc:    "move the selected expression into a new variable",
+				Args:    []string{"{{index .Prompts 0}}"},
+				Prompts: []string{"Variable name"},
+			},
+		)
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(
+			mg.BuiltinCmd{
+				Name: "go.extract-func",
+				Desc: "Move the selected statements or expression into a new function e.g. `go.extract-func [name]`",
+				Run:  e.runExtractFunc,
+			},
+			mg.BuiltinCmd{
+				Name: "go.extract-var",
+				Desc: "Move the selected expression into a new variable e.g. `go.extract-var [name]`",
+				Run:  e.runExtractVar,
+			},
+		)
+	case extractAct:
+		v := mx.View
+		if v.Filename() == act.fn && v.Hash == act.hash {
+			return mx.SetViewSrc(act.src)
+		}
+	}
+	return mx.State
+}
+
+func (e *Extract) runExtractFunc(cx *mg.CmdCtx) *mg.State {
+	go e.extract(cx, extractFunc)
+	return cx.State
+}
+
+func (e *Extract) runExtractVar(cx *mg.CmdCtx) *mg.State {
+	go e.extract(cx, extractVar)
+	return cx.State
+}
+
+func (e *Extract) extract(cx *mg.CmdCtx, f func(sc *srcChecker, name string) ([]byte, error)) {
+	defer cx.Output.Close()
+
+	name := ""
+	if len(cx.Args) != 0 {
+		name = strings.TrimSpace(cx.Args[0])
+	}
+	src, err := f(newSrcChecker(cx.Ctx), name)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
+		return
+	}
+	v := cx.View
+	cx.Store.Dispatch(extractAct{fn: v.Filename(), hash: v.Hash, src: src})
+}
+
+// extractSel is the selection in the current view
+type extractSel struct {
+	sc   *srcChecker
+	sp   *srcPkg
+	af   *ast.File
+	tf   *token.File
+	src  []byte
+	p, q token.Pos
+	// path is the list of nodes that enclose the selection, the innermost last
+	path []ast.Node
+	fd   *ast.FuncDecl
+}
+
+// newExtractSel type-checks the current view and returns its selection, without surrounding whitespace.
+// The selection must be inside a function body.
+func newExtractSel(sc *srcChecker) (*extractSel, error) {
+	v := sc.mx.View
+	src, start, end := v.SrcSel()
+	for start < end && isSpace(src[start]) {
+		start++
+	}
+	for end > start && isSpace(src[end-1]) {
+		end--
+	}
+	if start == end {
+		return nil, fmt.Errorf("nothing is selected")
+	}
+
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, err
+	}
+	af := sp.file(sc.fset, v.Filename())
+	if af == nil {
+		return nil, fmt.Errorf("cannot parse %s", v.Basename())
+	}
+	tf := sc.fset.File(af.Pos())
+	if end > tf.Size() {
+		return nil, fmt.Errorf("the selection is outside the file")
+	}
+	es := &extractSel{sc: sc, sp: sp, af: af, tf: tf, src: src, p: tf.Pos(start), q: tf.Pos(end)}
+	ast.Inspect(af, func(n ast.Node) bool {
+		if n == nil || es.p < n.Pos() || es.q > n.End() {
+			return false
+		}
+		es.path = append(es.path, n)
+		return true
+	})
+	for _, n := range es.path {
+		if fd, ok := n.(*ast.FuncDecl); ok && fd.Body != nil && es.p > fd.Body.Lbrace && es.q < fd.Body.Rbrace {
+			es.fd = fd
+		}
+	}
+	if es.fd == nil {
+		return nil, fmt.Errorf("the selection is not inside a function body")
+	}
+	return es, nil
+}
+
+// text returns the src of the node n
+func (es *extractSel) text(n ast.Node) string {
+	return string(es.src[es.offset(n.Pos()):es.offset(n.End())])
+}
+
+func (es *extractSel) offset(p token.Pos) int {
+	return es.tf.Offset(p)
+}
+
+// contains returns true if pos is in the selection
+func (es *extractSel) contains(pos token.Pos) bool {
+	return es.p <= pos && pos < es.q
+}
+
+// expr returns the expression that exactly matches the selection
+func (es *extractSel) expr() (ast.Expr, types.TypeAndValue, error) {
+	for i := len(es.path) - 1; i >= 0; i-- {
+		x, ok := es.path[i].(ast.Expr)
+		if !ok || x.Pos() != es.p || x.End() != es.q {
+			continue
+		}
+		tv, ok := es.sp.Info.Types[x]
+		if !ok || !(tv.IsValue() || tv.IsVoid()) {
+			break
+		}
+		if i > 0 {
+			switch p := es.path[i-1].(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range p.Lhs {
+					if lhs == x {
+						return nil, tv, fmt.Errorf("`%s` is assigned to", es.text(x))
+					}
+				}
+			case *ast.IncDecStmt:
+				return nil, tv, fmt.Errorf("`%s` is assigned to", es.text(x))
+			case *ast.UnaryExpr:
+				if p.Op == token.AND {
+					return nil, tv, fmt.Errorf("the address of `%s` is taken", es.text(x))
+				}
+			}
+		}
+		if tv.IsNil() {
+			return nil, tv, fmt.Errorf("`nil` has no type")
+		}
+		return x, tv, nil
+	}
+	return nil, types.TypeAndValue{}, fmt.Errorf("the selection is not an expression")
+}
+
+// isLocal returns true if obj is declared inside the enclosing function
+func (es *extractSel) isLocal(obj types.Object) bool {
+	return obj != nil && obj.Pkg() == es.sp.Pkg && obj.Parent() != es.sp.Pkg.Scope() &&
+		es.fd.Pos() <= obj.Pos() && obj.Pos() < es.fd.End()
+}
+
+// newName returns name if it's not declared in the scope at pos.
+// If name is empty, an unused name based on def is returned instead.
+func (es *extractSel) newName(name, def string, pos token.Pos) (string, error) {
+	scope := es.sp.Pkg.Scope().Innermost(pos)
+	declared := func(nm string) bool {
+		if scope == nil {
+			return es.sp.Pkg.Scope().Lookup(nm) != nil
+		}
+		_, obj := scope.LookupParent(nm, pos)
+		return obj != nil || es.sp.Pkg.Scope().Lookup(nm) != nil
+	}
+	if name != "" {
+		switch {
+		case !token.IsIdentifier(name):
+			return "", fmt.Errorf("`%s` is not a valid identifier", name)
+		case declared(name):
+			return "", fmt.Errorf("`%s` is already declared", name)
+		}
+		return name, nil
+	}
+	name = def
+	for i := 1; declared(name); i++ {
+		name = def + strconv.Itoa(i)
+	}
+	return name, nil
+}
+
+// replace returns the view's src with the selection replaced by repl, and ins inserted at pos
+func (es *extractSel) replace(repl string, pos token.Pos, ins string) []byte {
+	start, end, at := es.offset(es.p), es.offset(es.q), es.offset(pos)
+	buf := &bytes.Buffer{}
+	if at <= start {
+		buf.Write(es.src[:at])
+		buf.WriteString(ins)
+		buf.Write(es.src[at:start])
+		buf.WriteString(repl)
+		buf.Write(es.src[end:])
+	} else {
+		buf.Write(es.src[:start])
+		buf.WriteString(repl)
+		buf.Write(es.src[end:at])
+		buf.WriteString(ins)
+		buf.Write(es.src[at:])
+	}
+	return buf.Bytes()
+}
+
+// extractVar returns the src of the current view with the selected expression
+// replaced by a new variable name, declared before the enclosing statement
+func extractVar(sc *srcChecker, name string) ([]byte, error) {
+	es, err := newExtractSel(sc)
+	if err != nil {
+		return nil, err
+	}
+	x, tv, err := es.expr()
+	if err != nil {
+		return nil, err
+	}
+	if tv.IsVoid() {
+		return nil, fmt.Errorf("`%s` has no value", es.text(x))
+	}
+	if t, ok := tv.Type.(*types.Tuple); ok {
+		return nil, fmt.Errorf("`%s` has %d values", es.text(x), t.Len())
+	}
+
+	// the new variable is declared before the statement in a block that contains the expression
+	var stmt ast.Stmt
+	for i := len(es.path) - 1; i > 0 && stmt == nil; i-- {
+		switch es.path[i].(type) {
+		case *ast.CaseClause, *ast.CommClause:
+			continue
+		}
+		switch es.path[i-1].(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			stmt, _ = es.path[i].(ast.Stmt)
+		}
+	}
+	if stmt == nil {
+		return nil, fmt.Errorf("cannot find the statement that contains the expression")
+	}
+	if fs, ok := stmt.(*ast.ForStmt); ok {
+		for _, n := range []ast.Node{fs.Cond, fs.Post} {
+			if n != nil && n.Pos() <= x.Pos() && x.End() <= n.End() {
+				return nil, fmt.Errorf("`%s` is evaluated on each iteration of the loop", es.text(x))
+			}
+		}
+	}
+	var inner types.Object
+	ast.Inspect(x, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || inner != nil {
+			return inner == nil
+		}
+		if obj := es.sp.Info.Uses[id]; es.isLocal(obj) && stmt.Pos() <= obj.Pos() && obj.Pos() < stmt.End() {
+			inner = obj
+		}
+		return true
+	})
+	if inner != nil {
+		return nil, fmt.Errorf("`%s` uses `%s` which is declared in the enclosing statement", es.text(x), inner.Name())
+	}
+
+	name, err = es.newName(name, "x", stmt.Pos())
+	if err != nil {
+		return nil, err
+	}
+	// keep the indentation of the statement, gofmt will fix it if it's not at the start of the line
+	at := es.offset(stmt.Pos())
+	indent := es.src[bytes.LastIndexByte(es.src[:at], '\n')+1 : at]
+	if len(bytes.TrimSpace(indent)) != 0 {
+		indent = nil
+	}
+	decl := name + " := " + es.text(x) + "\n" + string(indent)
+	return gofmtImports(es.tf.Name(), es.replace(name, stmt.Pos(), decl), nil)
+}
+
+// extractFunc returns the src of the current view with the selected statements or expression
+// moved into a new function, declared after the enclosing function, and replaced with a call to it
+func extractFunc(sc *srcChecker, name string) ([]byte, error) {
+	es, err := newExtractSel(sc)
+	if err != nil {
+		return nil, err
+	}
+	stmts := es.stmts()
+	var x ast.Expr
+	var tv types.TypeAndValue
+	if len(stmts) == 0 {
+		x, tv, err = es.expr()
+		if err != nil {
+			return nil, fmt.Errorf("the selection must be a list of statements, or an expression: %s", err)
+		}
+	} else if err := es.checkFlow(stmts); err != nil {
+		return nil, err
+	}
+
+	name, err = es.newName(name, "extracted", es.p)
+	if err != nil {
+		return nil, err
+	}
+
+	var imps impSpecList
+	qual := fileQualifier(es.af, es.sp.Pkg, &imps)
+	typeStr := func(t types.Type) string {
+		return types.TypeString(types.Default(t), qual)
+	}
+
+	// the local variables used in the selection, in the order they're first used
+	var params []types.Object
+	seen := map[types.Object]bool{}
+	var localType types.Object
+	for _, n := range es.nodes(stmts, x) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := es.sp.Info.Uses[id]
+			if !es.isLocal(obj) || es.contains(obj.Pos()) || seen[obj] {
+				return true
+			}
+			seen[obj] = true
+			switch o := obj.(type) {
+			case *types.Var:
+				if !o.IsField() {
+					params = append(params, obj)
+				}
+			case *types.Const:
+				params = append(params, obj)
+			case *types.TypeName:
+				localType = obj
+			}
+			return true
+		})
+	}
+	if localType != nil {
+		return nil, fmt.Errorf("the selection uses the local type `%s`", localType.Name())
+	}
+
+	var results []types.Object
+	var resultTypes []string
+	call := ""
+	paramList := make([]string, len(params))
+	argList := make([]string, len(params))
+	for i, obj := range params {
+		paramList[i] = obj.Name() + " " + typeStr(obj.Type())
+		argList[i] = obj.Name()
+	}
+	callExpr := name + "(" + strings.Join(argList, ", ") + ")"
+	body := &bytes.Buffer{}
+	if x != nil {
+		call = callExpr
+		if t, ok := tv.Type.(*types.Tuple); ok {
+			for i := 0; i < t.Len(); i++ {
+				resultTypes = append(resultTypes, typeStr(t.At(i).Type()))
+			}
+		} else if !tv.IsVoid() {
+			resultTypes = []string{typeStr(tv.Type)}
+		}
+		if len(resultTypes) != 0 {
+			body.WriteString("return ")
+		}
+		body.WriteString(es.text(x))
+	} else {
+		declared, assigned := es.results(stmts, params)
+		results = append(declared, assigned...)
+		names := make([]string, len(results))
+		for i, obj := range results {
+			names[i] = obj.Name()
+			resultTypes = append(resultTypes, typeStr(obj.Type()))
+		}
+		switch {
+		case len(results) == 0:
+			call = callExpr
+		case len(assigned) == 0:
+			call = strings.Join(names, ", ") + " := " + callExpr
+		default:
+			for _, obj := range declared {
+				call += "var " + obj.Name() + " " + typeStr(obj.Type()) + "\n"
+			}
+			call += strings.Join(names, ", ") + " = " + callExpr
+		}
+		body.Write(es.src[es.offset(es.p):es.offset(es.q)])
+		if len(names) != 0 {
+			body.WriteString("\nreturn " + strings.Join(names, ", "))
+		}
+	}
+
+	fn := &bytes.Buffer{}
+	fmt.Fprintf(fn, "\n\nfunc %s(%s) ", name, strings.Join(paramList, ", "))
+	switch len(resultTypes) {
+	case 0:
+	case 1:
+		fn.WriteString(resultTypes[0] + " ")
+	default:
+		fn.WriteString("(" + strings.Join(resultTypes, ", ") + ") ")
+	}
+	fmt.Fprintf(fn, "{\n%s\n}", body.Bytes())
+	return gofmtImports(es.tf.Name(), es.replace(call, es.fd.End(), fn.String()), imps)
+}
+
+// stmts returns the list of statements that exactly match the selection
+func (es *extractSel) stmts() []ast.Stmt {
+	for i := len(es.path) - 1; i >= 0; i-- {
+		var list []ast.Stmt
+		switch x := es.path[i].(type) {
+		case *ast.BlockStmt:
+			list = x.List
+		case *ast.CaseClause:
+			list = x.Body
+		case *ast.CommClause:
+			list = x.Body
+		default:
+			continue
+		}
+		for j, s := range list {
+			if s.Pos() != es.p {
+				continue
+			}
+			for k := j; k < len(list); k++ {
+				if list[k].End() == es.q {
+					return list[j : k+1]
+				}
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// nodes returns the selected statements or expression as a list of nodes
+func (es *extractSel) nodes(stmts []ast.Stmt, x ast.Expr) []ast.Node {
+	if x != nil {
+		return []ast.Node{x}
+	}
+	l := make([]ast.Node, len(stmts))
+	for i, s := range stmts {
+		l[i] = s
+	}
+	return l
+}
+
+// checkFlow returns an error if the statements contain a return, defer
+// or a jump to a statement outside of the selection
+func (es *extractSel) checkFlow(stmts []ast.Stmt) error {
+	var err error
+	var stack []ast.Node
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			switch x := n.(type) {
+			case *ast.FuncLit:
+				// its statements don't affect the enclosing function
+				return false
+			case *ast.ReturnStmt:
+				err = fmt.Errorf("the selection contains a return statement")
+			case *ast.DeferStmt:
+				err = fmt.Errorf("the selection contains a defer statement")
+			case *ast.BranchStmt:
+				if !es.jumpsInside(x, stack) {
+					err = fmt.Errorf("the selection contains `%s` which jumps outside of it", es.text(x))
+				}
+			}
+			stack = append(stack, n)
+			return err == nil
+		})
+	}
+	return err
+}
+
+// jumpsInside returns true if the target of the branch statement bs is inside the selection.
+// stack is the list of nodes in the selection that enclose bs.
+func (es *extractSel) jumpsInside(bs *ast.BranchStmt, stack []ast.Node) bool {
+	if bs.Label != nil {
+		obj := es.sp.Info.Uses[bs.Label]
+		return obj != nil && es.contains(obj.Pos())
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch stack[i].(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return bs.Tok != token.FALLTHROUGH
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if bs.Tok == token.BREAK {
+				return true
+			}
+		case *ast.CaseClause:
+			if bs.Tok == token.FALLTHROUGH {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// results returns the variables declared in the selection that are used after it,
+// and the variables in params that are assigned in the selection and used outside it
+func (es *extractSel) results(stmts []ast.Stmt, params []types.Object) (declared, assigned []types.Object) {
+	info := es.sp.Info
+	usedOutside := map[types.Object]bool{}
+	usedAfter := map[types.Object]bool{}
+	ast.Inspect(es.fd.Body, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !es.contains(id.Pos()) {
+			obj := info.Uses[id]
+			usedOutside[obj] = true
+			usedAfter[obj] = usedAfter[obj] || id.Pos() >= es.q
+		}
+		return true
+	})
+
+	isParam := map[types.Object]bool{}
+	for _, obj := range params {
+		isParam[obj] = true
+	}
+	isAssigned := map[types.Object]bool{}
+	setAssigned := func(x ast.Expr) {
+		for {
+			px, ok := x.(*ast.ParenExpr)
+			if !ok {
+				break
+			}
+			x = px.X
+		}
+		if id, ok := x.(*ast.Ident); ok {
+			if obj := info.Uses[id]; isParam[obj] {
+				isAssigned[obj] = true
+			}
+		}
+	}
+	for _, s := range stmts {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.Ident:
+				if obj, ok := info.Defs[x].(*types.Var); ok && usedAfter[obj] {
+					declared = append(declared, obj)
+				}
+			case *ast.AssignStmt:
+				for _, lhs := range x.Lhs {
+					setAssigned(lhs)
+				}
+			case *ast.IncDecStmt:
+				setAssigned(x.X)
+			case *ast.RangeStmt:
+				if x.Tok == token.ASSIGN {
+					setAssigned(x.Key)
+					setAssigned(x.Value)
+				}
+			case *ast.UnaryExpr:
+				// the value might be modified through the pointer
+				if x.Op == token.AND {
+					setAssigned(x.X)
+				}
+			}
+			return true
+		})
+	}
+	for _, obj := range params {
+		if isAssigned[obj] && usedOutside[obj] {
+			assigned = append(assigned, obj)
+		}
+	}
+	return declared, assigned
+}
+
+// fileQualifier returns a qualifier that names packages as they're imported in af.
+// Packages that af doesn't import are added to missing.
+func fileQualifier(af *ast.File, pkg *types.Package, missing *impSpecList) types.Qualifier {
+	return func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		for _, spec := range af.Imports {
+			if unquote(spec.Path.Value) != p.Path() {
+				continue
+			}
+			if spec.Name == nil {
+				return p.Name()
+			}
+			switch spec.Name.Name {
+			case "_":
+				continue
+			case ".":
+				return ""
+			}
+			return spec.Name.Name
+		}
+		if imp := (impSpec{Path: p.Path()}); !missing.contains(imp) {
+			*missing = append(*missing, imp)
+		}
+		return p.Name()
+	}
+}
+
+// gofmtImports formats src, after adding the imports in imps
+func gofmtImports(fn string, src []byte, imps impSpecList) ([]byte, error) {
+	if len(imps) != 0 {
+		src, _ = updateImports(fn, src, imps, nil)
+	}
+	out, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot format the result: %s", err)
+	}
+	return out, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
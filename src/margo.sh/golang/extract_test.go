@@ -0,0 +1,137 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"strings"
+	"testing"
+)
+
+const extractTestSrc = `package a
+
+import "strings"
+
+type T struct{ N int }
+
+func F(t T, s string) (int, error) {
+	n := 0
+	for i := 0; i < 3; i++ {
+		«n += t.N * i»
+	}
+	«parts := strings.Split(s, ",")
+	m := len(parts) + n»
+	if m > 10 {
+		return m, nil
+	}
+	return «t.N + 1», nil
+}
+`
+
+func TestExtract(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": strings.NewReplacer("«", "", "»", "").Replace(extractTestSrc),
+	})
+	defer cleanup()
+
+	// sel returns a ctx with the n'th «selection» in extractTestSrc selected
+	sel := func(n int) *mg.Ctx {
+		src := extractTestSrc
+		for i := 0; i < n; i++ {
+			src = strings.Replace(strings.Replace(src, "«", "", 1), "»", "", 1)
+		}
+		start := strings.Index(src, "«")
+		src = strings.Replace(src, "«", "", 1)
+		end := strings.Index(src, "»")
+		src = strings.NewReplacer("«", "", "»", "").Replace(src)
+		mx := newCtx("ex/a/a.go", src)
+		return mx.Copy(func(mx *mg.Ctx) {
+			mx.State = mx.State.SetView(mx.View.Copy(func(v *mg.View) {
+				v.Pos = start
+				v.SelStart = start
+				v.SelEnd = end
+			}))
+		})
+	}
+
+	cases := []struct {
+		name string
+		sel  int
+		fn   func(sc *srcChecker, name string) ([]byte, error)
+		arg  string
+		exp  []string
+		err  string
+	}{
+		{
+			name: "func assigns param",
+			sel:  0,
+			fn:   extractFunc,
+			exp: []string{
+				"\t\tn = extracted(n, t, i)\n",
+				"func extracted(n int, t T, i int) int {\n\tn += t.N * i\n\treturn n\n}\n",
+			},
+		},
+		{
+			name: "func declares results",
+			sel:  1,
+			fn:   extractFunc,
+			arg:  "count",
+			exp: []string{
+				"\tm := count(s, n)\n",
+				"func count(s string, n int) int {\n\tparts := strings.Split(s, \",\")\n\tm := len(parts) + n\n\treturn m\n}\n",
+			},
+		},
+		{
+			name: "func expression",
+			sel:  2,
+			fn:   extractFunc,
+			exp: []string{
+				"\treturn extracted(t), nil\n",
+				"func extracted(t T) int {\n\treturn t.N + 1\n}\n",
+			},
+		},
+		{
+			name: "func name conflict",
+			sel:  2,
+			fn:   extractFunc,
+			arg:  "F",
+			err:  "already declared",
+		},
+		{
+			name: "var",
+			sel:  2,
+			fn:   extractVar,
+			exp: []string{
+				"\tx := t.N + 1\n\treturn x, nil\n",
+			},
+		},
+		{
+			name: "var statement",
+			sel:  0,
+			fn:   extractVar,
+			err:  "not an expression",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := sel(c.sel)
+			defer mx.Cancel()
+
+			src, err := c.fn(newSrcChecker(mx), c.arg)
+			switch {
+			case c.err != "" && err == nil:
+				t.Fatalf("expected error containing `%s`, got:\n%s", c.err, src)
+			case c.err != "":
+				if !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing `%s`, got `%s`", c.err, err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("extract failed: %s", err)
+			}
+			for _, s := range c.exp {
+				if !strings.Contains(string(src), s) {
+					t.Errorf("expected result to contain:\n%s\ngot:\n%s", s, src)
+				}
+			}
+		})
+	}
+}
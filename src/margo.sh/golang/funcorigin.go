@@ -0,0 +1,12 @@
+// +build go1.19
+
+package golang
+
+import (
+	"go/types"
+)
+
+// funcOrigin returns the generic function or method that fn is an instance of, or fn itself
+func funcOrigin(fn *types.Func) *types.Func {
+	return fn.Origin()
+}
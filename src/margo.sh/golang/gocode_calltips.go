@@ -6,11 +6,14 @@ import (
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"kuroku.io/margocode/suggest"
 	"margo.sh/htm"
 	"margo.sh/mg"
 	"margo.sh/mgutil"
 	"margo.sh/sublime"
+	"reflect"
+	"sort"
 	"strings"
 	"unicode"
 )
@@ -24,6 +27,7 @@ type gocodeCtAct struct {
 	mg.ActionType
 	mx     *mg.Ctx
 	status string
+	help   *mg.SignatureHelp
 }
 
 type GocodeCalltips struct {
@@ -39,6 +43,22 @@ type GocodeCalltips struct {
 	q      *mgutil.ChanQ
 	status string
 	hud    htm.Element
+	help   *mg.SignatureHelp
+
+	// declKey and decl cache what's known about the last function that was called,
+	// and sc is the checker of the view identified by scKey.
+	// They're only accessed by the processer goroutine.
+	declKey string
+	decl    calltipDecl
+	sc      *srcChecker
+	scKey   string
+}
+
+// calltipDecl is what's known about the function called at the cursor after type-checking the view's package
+type calltipDecl struct {
+	doc string
+	// alts are the signatures of the methods on other receivers that might be called through an interface method
+	alts []mg.Signature
 }
 
 func (gc *GocodeCalltips) RCond(mx *mg.Ctx) bool {
@@ -62,10 +82,11 @@ func (gc *GocodeCalltips) Reduce(mx *mg.Ctx) *mg.State {
 
 	switch act := mx.Action.(type) {
 	case mg.ViewPosChanged, mg.ViewActivated:
-		gc.q.Put(gocodeCtAct{mx: mx, status: gc.status})
+		gc.q.Put(gocodeCtAct{mx: mx, status: gc.status, help: gc.help})
 	case gocodeCtAct:
 		s := act.status
 		gc.status = s
+		gc.help = act.help
 		i := strings.Index(s, calltipOpenTag)
 		j := strings.Index(s, calltipCloseTag)
 		switch {
@@ -88,6 +109,9 @@ func (gc *GocodeCalltips) Reduce(mx *mg.Ctx) *mg.State {
 	if gc.hud != nil {
 		st = st.AddHUD(htm.Text("Calltips"), gc.hud)
 	}
+	if gc.help != nil {
+		st = st.SetSignatureHelp(gc.help)
+	}
 	return st
 }
 
@@ -100,16 +124,19 @@ func (gc *GocodeCalltips) processer() {
 func (gc *GocodeCalltips) process(act gocodeCtAct) {
 	defer func() { recover() }()
 
-	if s := gc.processStatus(act); s != act.status {
-		act.mx.Store.Dispatch(gocodeCtAct{status: s})
+	s, help := gc.processStatus(act)
+	if s != act.status || !reflect.DeepEqual(help, act.help) {
+		act.mx.Store.Dispatch(gocodeCtAct{status: s, help: help})
 	}
 }
 
-func (gc *GocodeCalltips) processStatus(act gocodeCtAct) string {
+// processStatus returns the status string describing the call at the cursor,
+// and the equivalent signature help, if any.
+func (gc *GocodeCalltips) processStatus(act gocodeCtAct) (string, *mg.SignatureHelp) {
 	mx := act.mx
 	src, srcPos := mx.View.SrcPos()
 	if len(src) == 0 {
-		return ""
+		return "", nil
 	}
 
 	cx := NewCursorCtx(mx, src, srcPos)
@@ -117,37 +144,198 @@ func (gc *GocodeCalltips) processStatus(act gocodeCtAct) string {
 	tokPos := tf.Pos(srcPos)
 	call, assign := gc.findCallExpr(cx.Nodes, tokPos)
 	if call == nil {
-		return ""
+		return "", nil
 	}
 
 	ident := gc.exprIdent(call.Fun)
 	if ident == nil {
-		return ""
+		return "", nil
 	}
 
 	fxName := ident.String()
 	candidate, ok := gc.candidate(mx, src, tf.Position(ident.End()).Offset, fxName)
 	if !ok {
-		return ""
+		return "", nil
 	}
 
 	expr, _ := parser.ParseExpr(candidate.Type)
 	fx, _ := expr.(*ast.FuncType)
 	if fx == nil {
-		return ""
+		return "", nil
 	}
 
 	var highlight ast.Node
+	activeParam := -1
 	switch {
 	case call.Lparen < tokPos && tokPos <= call.Rparen:
 		i := gc.selectedFieldExpr(tf.Offset, src, srcPos, call.Args)
 		highlight = gc.selectedFieldName(fx.Params, i)
+		activeParam = gc.selectedParamIndex(fx.Params, i)
 	case assign != nil:
 		i := gc.selectedFieldExpr(tf.Offset, src, srcPos, assign.Lhs)
 		highlight = gc.selectedFieldName(fx.Results, i)
 	}
 
-	return gc.funcSrc(fx, fxName, highlight)
+	sig := gc.signature(fx, candidate.Name)
+	fun := string(src[tf.Offset(call.Fun.Pos()):tf.Offset(call.Fun.End())])
+	decl := gc.funcDecl(mx, tf.Offset(ident.Pos()), fun+sig.Label)
+	sig.Doc = decl.doc
+	help := &mg.SignatureHelp{
+		Signatures:      append([]mg.Signature{sig}, decl.alts...),
+		ActiveParameter: activeParam,
+	}
+	// the function that's statically called is the one that's most likely being called,
+	// so keep track of it after sorting the signatures
+	sort.SliceStable(help.Signatures, func(i, j int) bool {
+		return help.Signatures[i].Label < help.Signatures[j].Label
+	})
+	for i, s := range help.Signatures {
+		if s.Label == sig.Label {
+			help.ActiveSignature = i
+			break
+		}
+	}
+	return gc.funcSrc(fx, fxName, highlight), help
+}
+
+// signature returns the description of the function fx named funcName
+func (gc *GocodeCalltips) signature(fx *ast.FuncType, funcName string) mg.Signature {
+	fset := token.NewFileSet()
+	params := func(fl *ast.FieldList) []mg.SignatureParam {
+		if fl == nil {
+			return nil
+		}
+		var l []mg.SignatureParam
+		for _, f := range fl.List {
+			buf := &bytes.Buffer{}
+			printer.Fprint(buf, fset, f.Type)
+			typ := buf.String()
+			if len(f.Names) == 0 {
+				l = append(l, mg.SignatureParam{Type: typ})
+			}
+			for _, id := range f.Names {
+				l = append(l, mg.SignatureParam{Name: id.Name, Type: typ})
+			}
+		}
+		return l
+	}
+	return mg.Signature{
+		Label:   gc.funcSrc(fx, funcName, nil),
+		Name:    funcName,
+		Params:  params(fx.Params),
+		Results: params(fx.Results),
+	}
+}
+
+// selectedParamIndex returns the index of the parameter in fl that's passed as the argument at argIndex,
+// taking variadic parameters into account, or -1 if there's no such parameter
+func (gc *GocodeCalltips) selectedParamIndex(fl *ast.FieldList, argIndex int) int {
+	if fl == nil || len(fl.List) == 0 {
+		return -1
+	}
+	n := 0
+	for _, f := range fl.List {
+		if len(f.Names) == 0 {
+			n++
+		} else {
+			n += len(f.Names)
+		}
+	}
+	if argIndex < n {
+		return argIndex
+	}
+	if _, ok := fl.List[len(fl.List)-1].Type.(*ast.Ellipsis); ok {
+		return n - 1
+	}
+	return -1
+}
+
+// funcDecl returns what's known about the function called by the identifier at offset pos in the view.
+//
+// The package is type-checked to find the declaration, so the result is cached
+// until key or the view changes, and the checked package is reused while the view is unchanged.
+func (gc *GocodeCalltips) funcDecl(mx *mg.Ctx, pos int, key string) calltipDecl {
+	v := mx.View
+	scKey := v.Filename() + "\x00" + v.Hash
+	key = scKey + "\x00" + key
+	if key == gc.declKey && v.Hash != "" {
+		return gc.decl
+	}
+
+	gc.declKey = key
+	gc.decl = calltipDecl{}
+	if gc.sc == nil || gc.scKey != scKey || v.Hash == "" {
+		gc.sc = newSrcChecker(mx)
+		gc.scKey = scKey
+	}
+	sc := gc.sc
+	sc.mx = mx
+	sp, err := sc.checkView()
+	if err != nil {
+		return gc.decl
+	}
+	_, obj := sp.identAt(sc.fset, v.Filename(), pos)
+	if obj == nil {
+		return gc.decl
+	}
+	if fn, ok := obj.(*types.Func); ok {
+		gc.decl.alts = methodAlts(sp, fn)
+	}
+	if o, dp, err := sc.declSrc(obj); err == nil {
+		if tf := sc.fset.File(o.Pos()); tf != nil {
+			gc.decl.doc = declDoc(dp.file(sc.fset, tf.Name()), o.Pos())
+		}
+	}
+	return gc.decl
+}
+
+// methodAlts returns the signatures of the methods that might be called through the interface method fn
+// i.e. the methods of the same name on the types that implement its interface,
+// declared in the package sp, or the packages it imports
+func methodAlts(sp *srcPkg, fn *types.Func) []mg.Signature {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil || !types.IsInterface(recv.Type()) {
+		return nil
+	}
+	impls, _ := methodImpls(fn, implTypeNames([]*types.Package{sp.Pkg}))
+	qual := func(p *types.Package) string {
+		if p == sp.Pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	var l []mg.Signature
+	for _, im := range impls {
+		if m, ok := im.Obj.(*types.Func); ok {
+			l = append(l, methodSignature(m, qual))
+		}
+	}
+	return l
+}
+
+// methodSignature returns the description of the method fn,
+// whose name is qualified by its receiver type e.g. `(*T).Get() int`
+func methodSignature(fn *types.Func, qual types.Qualifier) mg.Signature {
+	sig := fn.Type().(*types.Signature)
+	params := func(t *types.Tuple, variadic bool) []mg.SignatureParam {
+		l := make([]mg.SignatureParam, t.Len())
+		for i := range l {
+			v := t.At(i)
+			typ := types.TypeString(v.Type(), qual)
+			if s, ok := v.Type().(*types.Slice); ok && variadic && i == len(l)-1 {
+				typ = "..." + types.TypeString(s.Elem(), qual)
+			}
+			l[i] = mg.SignatureParam{Name: v.Name(), Type: typ}
+		}
+		return l
+	}
+	name := "(" + types.TypeString(sig.Recv().Type(), qual) + ")." + fn.Name()
+	return mg.Signature{
+		Label:   name + strings.TrimPrefix(types.TypeString(sig, qual), "func"),
+		Name:    fn.Name(),
+		Params:  params(sig.Params(), sig.Variadic()),
+		Results: params(sig.Results(), false),
+	}
 }
 
 func (gc *GocodeCalltips) findCallExpr(nodes []ast.Node, pos token.Pos) (*ast.CallExpr, *ast.AssignStmt) {
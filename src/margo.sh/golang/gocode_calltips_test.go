@@ -0,0 +1,91 @@
+package golang
+
+import (
+	"go/ast"
+	"go/parser"
+	"margo.sh/mg"
+	"reflect"
+	"testing"
+)
+
+func TestCalltipsSignature(t *testing.T) {
+	expr, err := parser.ParseExpr(`func(s, sep string, a ...interface{}) (int, error)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fx := expr.(*ast.FuncType)
+	gc := &GocodeCalltips{}
+
+	sig := gc.signature(fx, "F")
+	exp := mg.Signature{
+		Label: "F(s, sep string, a ...interface{}) int, error",
+		Name:  "F",
+		Params: []mg.SignatureParam{
+			{Name: "s", Type: "string"},
+			{Name: "sep", Type: "string"},
+			{Name: "a", Type: "...interface{}"},
+		},
+		Results: []mg.SignatureParam{
+			{Type: "int"},
+			{Type: "error"},
+		},
+	}
+	if !reflect.DeepEqual(sig, exp) {
+		t.Errorf("signature: expected %#v, got %#v", exp, sig)
+	}
+
+	for arg, exp := range map[int]int{0: 0, 1: 1, 2: 2, 5: 2} {
+		if i := gc.selectedParamIndex(fx.Params, arg); i != exp {
+			t.Errorf("selectedParamIndex(%d): expected %d, got %d", arg, exp, i)
+		}
+	}
+	if i := gc.selectedParamIndex(fx.Results, 2); i != -1 {
+		t.Errorf("selectedParamIndex past the end: expected -1, got %d", i)
+	}
+}
+
+func TestCalltipsFuncDecl(t *testing.T) {
+	src := `package a
+
+// Getter gets
+type Getter interface {
+	// Get returns the value
+	Get() int
+}
+
+type T struct{}
+
+func (T) Get() int { return 0 }
+
+type P struct{}
+
+func (*P) Get() int { return 1 }
+
+func F(g Getter) int { return g.G‸et() }
+`
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{"ex/a/a.go": src})
+	defer cleanup()
+
+	mx := newCtx("ex/a/a.go", src)
+	defer mx.Cancel()
+	mx = mx.SetView(mx.View.Copy(func(v *mg.View) { v.Hash = "1" }))
+
+	gc := &GocodeCalltips{}
+	decl := gc.funcDecl(mx, mx.View.Pos, "g.Get")
+	if decl.doc != "Get returns the value\n" {
+		t.Errorf("expected the doc of Getter.Get, got %q", decl.doc)
+	}
+	labels := []string{}
+	for _, s := range decl.alts {
+		labels = append(labels, s.Label)
+	}
+	if exp := []string{"(*P).Get() int", "(T).Get() int"}; !reflect.DeepEqual(labels, exp) {
+		t.Errorf("expected the alternatives %v, got %v", exp, labels)
+	}
+
+	sc := gc.sc
+	gc.funcDecl(mx, mx.View.Pos, "g.Get()")
+	if gc.sc != sc {
+		t.Errorf("the checker was not reused while the view was unchanged")
+	}
+}
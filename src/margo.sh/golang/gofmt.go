@@ -11,6 +11,12 @@ var (
 	GoFmt     mg.Reducer = mg.NewReducer(goFmt)
 	GoImports mg.Reducer = mg.NewReducer(goImports)
 
+	// OrganizeImports is a formatter that adds missing imports, removes unused ones
+	// and groups the standard library imports before the others.
+	// Unlike GoImports, it doesn't run an external command,
+	// but it type-checks the package of the view whenever the view has changed since the last run.
+	OrganizeImports mg.Reducer = &organizeImports{}
+
 	commonFmtLangs   = []mg.Lang{mg.Go}
 	commonFmtActions = []mg.Action{
 		mg.ViewFmt{},
@@ -33,6 +33,11 @@ func (tc *TestCmds) Reduce(mx *mg.Ctx) *mg.State {
 		return tc.queryTestCmds(mx)
 	case mg.RunCmd:
 		return tc.actuateCmd(mx, act)
+	case mg.QueryPromptChoices:
+		if act.Prompt.Query == "go.tests" {
+			return mx.AddPromptChoices(tc.testChoices(mx)...)
+		}
+		return mx.State
 	default:
 		return mx.State
 	}
@@ -94,12 +99,24 @@ func (tc *TestCmds) queryTestCmds(mx *mg.Ctx) *mg.State {
 		return mx.State
 	}
 
-	cl := make(mg.UserCmdList, 0, 4+numCmds)
+	cl := make(mg.UserCmdList, 0, 5+numCmds)
 	cl = append(cl, mg.UserCmd{
 		Name:  "go",
 		Args:  tc.testArgs("."),
 		Title: "Run all Tests and Examples",
 	})
+	if len(cmds["Test"])+len(cmds["Example"]) != 0 {
+		cl = append(cl, mg.UserCmd{
+			Name:  "go",
+			Args:  tc.testArgs("^{{index .Prompts 0}}$"),
+			Title: "Run Test or Example...",
+			TypedPrompts: []mg.Prompt{{
+				Title: "Test or Example",
+				Type:  mg.PromptTypeChoice,
+				Query: "go.tests",
+			}},
+		})
+	}
 	for _, pfx := range []string{"Test", "Benchmark", "Example"} {
 		if len(cmds[pfx]) == 0 {
 			continue
@@ -124,6 +141,33 @@ func (tc *TestCmds) queryTestCmds(mx *mg.Ctx) *mg.State {
 	return mx.AddUserCmds(cl...)
 }
 
+// testChoices returns a PromptChoice for each Test and Example in the view's package
+func (tc *TestCmds) testChoices(mx *mg.Ctx) []mg.PromptChoice {
+	dir := mx.View.Dir()
+	pkg, _ := BuildContext(mx).ImportDir(dir, 0)
+	if pkg == nil {
+		return nil
+	}
+
+	var l []mg.PromptChoice
+	for _, names := range [][]string{pkg.TestGoFiles, pkg.XTestGoFiles} {
+		for _, nm := range names {
+			for _, d := range ParseFile(mx, filepath.Join(dir, nm), nil).AstFile.Decls {
+				fun, ok := d.(*ast.FuncDecl)
+				if !ok || fun.Name == nil || fun.Recv != nil {
+					continue
+				}
+				name, pfx, _, ok := tc.splitName(fun.Name.Name)
+				if ok && pfx != "Benchmark" {
+					l = append(l, mg.PromptChoice{Value: name, Desc: nm})
+				}
+			}
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Value < l[j].Value })
+	return l
+}
+
 func (tc *TestCmds) benchArgs(pat string) []string {
 	return append([]string{"test", "-test.run=none", "-test.bench=" + pat}, tc.BenchArgs...)
 }
@@ -2,68 +2,94 @@ package golang
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"go/ast"
-	"io"
-	"io/ioutil"
-	"margo.sh/cmdpkg/margo/cmdrunner"
+	"margo.sh/htm"
 	"margo.sh/mg"
-	yotsuba "margo.sh/why_would_you_make_yotsuba_cry"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"regexp"
-	"strconv"
-)
-
-var (
-	fnPosPat = regexp.MustCompile(`^(.+):(\d+):(\d+)$`)
+	"margo.sh/mgutil"
 )
 
+// Guru adds the builtin commands `goto.definition` and `guru.definition`,
+// `goto.type-definition` which goes to the declaration of the type of the identifier under the cursor,
+// and `goto.implementation` which lists the types and methods
+// that implement, or are implemented by, the type or method under the cursor.
+//
+// Despite its name, it no longer uses the guru command.
+// Definitions are resolved in-process by type-checking the package of the current view,
+// using its unsaved src.
 type Guru struct {
 	mg.ReducerType
+
+	hud linksHUD
 }
 
 func (g *Guru) RCond(mx *mg.Ctx) bool {
 	return mx.LangIs(mg.Go)
 }
 
-func (g *Guru) RMount(mx *mg.Ctx) {
-	go cmdrunner.Cmd{
-		Name:     "go",
-		Args:     []string{"install", "margo.sh/vendor/golang.org/x/tools/cmd/guru"},
-		Env:      yotsuba.AgentBuildEnv,
-		OutToErr: true,
-	}.Run()
-}
-
 func (g *Guru) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State
 	switch act := mx.Action.(type) {
 	case mg.QueryUserCmds:
-		return mx.AddUserCmds(
+		st = st.AddUserCmds(
 			mg.UserCmd{
 				Title: "Guru Definition",
 				Name:  "guru.definition",
 				Desc:  "show declaration of selected identifier",
 			},
+			mg.UserCmd{
+				Title: "Go to Type Definition",
+				Name:  "goto.type-definition",
+				Desc:  "show declaration of the type of the selected identifier",
+			},
+			mg.UserCmd{
+				Title: "Go to Implementation",
+				Name:  "goto.implementation",
+				Desc:  "list the implementations of the type or method under the cursor",
+			},
 		)
 	case mg.RunCmd:
-		return g.runCmd(mx, act)
-	default:
-		return mx.State
+		st = g.runCmd(mx, act)
 	}
+	return g.hud.reduce(mx, st, "Implementations")
 }
 
 func (g *Guru) runCmd(mx *mg.Ctx, rc mg.RunCmd) *mg.State {
-	if rc.Name == "goto.definition" || rc.Name == "guru.definition" {
+	switch rc.Name {
+	case "goto.definition", "guru.definition":
 		return mx.AddBuiltinCmds(mg.BuiltinCmd{Name: rc.Name, Run: g.runDef})
+	case "goto.type-definition":
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{Name: rc.Name, Run: g.runTypeDef})
+	case "goto.implementation":
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{Name: rc.Name, Run: g.runImpl})
 	}
 
-	if rc.Name != mg.RcActuate || rc.StringFlag("button", "left") != "left" {
+	if rc.Name != mg.RcActuate {
 		return mx.State
 	}
+	switch rc.StringFlag("button", "left") {
+	case "left":
+		return g.actuateDef(mx, rc)
+	case "right":
+		return g.actuateImpl(mx, rc)
+	}
+	return mx.State
+}
+
+func (g *Guru) actuateImpl(mx *mg.Ctx, rc mg.RunCmd) *mg.State {
+	cx := NewViewCursorCtx(mx)
+	var onId *ast.Ident
+	if !cx.Set(&onId) {
+		return mx.State
+	}
+	// test funcs are handled by TestCmds
+	if nm, _ := cx.FuncDeclName(); nm != "" && cx.IsTestFile {
+		return mx.State
+	}
+	return mx.AddBuiltinCmds(mg.BuiltinCmd{Name: rc.Name, Run: g.runImpl})
+}
 
+func (g *Guru) actuateDef(mx *mg.Ctx, rc mg.RunCmd) *mg.State {
 	cx := NewViewCursorCtx(mx)
 	var onId *ast.Ident
 	var onSel *ast.SelectorExpr
@@ -80,120 +106,63 @@ func (g *Guru) runCmd(mx *mg.Ctx, rc mg.RunCmd) *mg.State {
 }
 
 func (g *Guru) runDef(cx *mg.CmdCtx) *mg.State {
-	go g.definition(cx)
+	go g.definition(cx, false)
 	return cx.State
 }
 
-func (g *Guru) definition(bx *mg.CmdCtx) {
-	defer bx.Output.Close()
-	defer bx.Begin(mg.Task{Title: "guru definition", ShowNow: true}).Done()
-
-	v := bx.View
-	dir := v.Dir()
-	fn := v.Filename()
-
-	if v.Path == "" {
-		tmpDir, err := ioutil.TempDir("", "guru")
-		if err == nil {
-			defer os.RemoveAll(tmpDir)
-			fn = filepath.Join(tmpDir, v.Name)
-			src, _ := v.ReadAll()
-			ioutil.WriteFile(fn, src, 0600)
-		}
-	}
+func (g *Guru) runImpl(cx *mg.CmdCtx) *mg.State {
+	go g.implementation(cx)
+	return cx.State
+}
 
-	cmd := exec.Command(
-		"guru",
-		"-json",
-		"-tags", g.wasmTags(bx.Ctx),
-		"-modified",
-		"definition",
-		fmt.Sprintf("%s:#%d", fn, v.Pos),
-	)
-	cmd.Dir = dir
-	buf := &bytes.Buffer{}
-	cmd.Stdout = buf
-	cmd.Stderr = bx.Output
-	cmd.Env = bx.Env.Environ()
-	if v.Dirty {
-		src, _ := v.ReadAll()
-		hdr := &bytes.Buffer{}
-		fmt.Fprintf(hdr, "%s\n%d\n", fn, len(src))
-		cmd.Stdin = io.MultiReader(hdr, bytes.NewReader(src))
-	}
+func (g *Guru) implementation(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+	defer cx.Begin(mg.Task{Title: "Go/Implementation", ShowNow: true}).Done()
 
-	if err := cmd.Run(); err != nil {
-		fmt.Fprintln(bx.Output, "Error:", err)
+	obj, impls, err := findImplementations(newSrcChecker(cx.Ctx))
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
 		return
 	}
 
-	res := struct {
-		ObjPos string `json:"objpos"`
-	}{}
-	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
-		fmt.Fprintln(bx.Output, "cannot decode guru output:", err)
-	}
-
-	m := fnPosPat.FindStringSubmatch(res.ObjPos)
-	if len(m) != 4 {
-		fmt.Fprintln(bx.Output, "cannot parse guru objpos:", res.ObjPos)
+	v := cx.View
+	acts := make([]mg.Activate, len(impls))
+	links := make([]htm.Element, 0, len(impls))
+	buf := &bytes.Buffer{}
+	for i, im := range impls {
+		fn := mgutil.ShortFn(im.Pos.Filename, cx.Env)
+		fmt.Fprintf(buf, "%s:%d:%d: %s\n", fn, im.Pos.Line, im.Pos.Column, im.Desc)
+		act := posActivate(v, im.Pos)
+		acts[i] = act
+		links = append(links, htm.Div(nil,
+			htm.A(&htm.AAttrs{Action: act}, htm.Textf("%s:%d", fn, im.Pos.Line)),
+			htm.Text(" "+im.Desc),
+		))
+	}
+	fmt.Fprintf(buf, "%d implementations of `%s`\n", len(impls), obj.Name())
+	cx.Output.Write(buf.Bytes())
+
+	if len(acts) == 1 && acts[0].Path+acts[0].Name != "" {
+		cx.Store.Dispatch(acts[0])
 		return
 	}
-
-	n := func(s string) int {
-		n, _ := strconv.Atoi(s)
-		if n > 0 {
-			return n - 1
-		}
-		return 0
-	}
-
-	fn = m[1]
-	if v.Path == "" && filepath.Base(fn) == v.Name {
-		fn = v.Name
-	}
-	bx.Store.Dispatch(mg.Activate{
-		Path: fn,
-		Row:  n(m[2]),
-		Col:  n(m[3]),
-	})
+	hud := htm.Div(nil, append([]htm.Element{htm.Textf("%d implementations of `%s`", len(impls), obj.Name())}, links...)...)
+	g.hud.set(cx.Ctx, hud)
 }
 
-func (g *Guru) wasmTags(mx *mg.Ctx) string {
-	tags := "js wasm"
-	sysjs := "syscall/js"
-	v := mx.View
-	src, _ := v.ReadAll()
-	if len(src) == 0 {
-		return ""
-	}
+func (g *Guru) runTypeDef(cx *mg.CmdCtx) *mg.State {
+	go g.definition(cx, true)
+	return cx.State
+}
 
-	pf := ParseFile(mx, v.Filename(), src)
-	for _, spec := range pf.AstFile.Imports {
-		p := spec.Path
-		if p == nil {
-			continue
-		}
-		if s, _ := strconv.Unquote(p.Value); s == sysjs {
-			return tags
-		}
-	}
-	if v.Path == "" {
-		// file doesn't exist, so there's no package
-		return ""
-	}
+func (g *Guru) definition(cx *mg.CmdCtx, typeDef bool) {
+	defer cx.Output.Close()
+	defer cx.Begin(mg.Task{Title: "Go/Definition", ShowNow: true}).Done()
 
-	pkg, _ := BuildContext(mx).ImportDir(mx.View.Dir(), 0)
-	if pkg == nil {
-		return ""
-	}
-	for _, l := range [][]string{pkg.Imports, pkg.TestImports} {
-		for _, s := range l {
-			if s == sysjs {
-				return tags
-			}
-		}
+	_, pos, err := findDefinition(newSrcChecker(cx.Ctx), typeDef)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
+		return
 	}
-
-	return ""
+	cx.Store.Dispatch(posActivate(cx.View, pos))
 }
@@ -0,0 +1,41 @@
+package golang
+
+import (
+	"margo.sh/htm"
+	"margo.sh/mg"
+)
+
+type linksHUDAct struct {
+	mg.ActionType
+	hud *linksHUD
+	el  htm.Element
+}
+
+// linksHUD is a HUD article that lists links to positions in the source e.g. the results of a command.
+//
+// The links are cleared when the view is modified, or another view is activated,
+// because the positions are likely no longer valid.
+type linksHUD struct {
+	el htm.Element
+}
+
+// set dispatches an action that replaces the content of the article with el
+func (lh *linksHUD) set(mx *mg.Ctx, el htm.Element) {
+	mx.Store.Dispatch(linksHUDAct{hud: lh, el: el})
+}
+
+// reduce updates the article for the current action and adds it, if it's not empty, to the HUD with heading title
+func (lh *linksHUD) reduce(mx *mg.Ctx, st *mg.State, title string) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.ViewModified, mg.ViewActivated:
+		lh.el = nil
+	case linksHUDAct:
+		if act.hud == lh {
+			lh.el = act.el
+		}
+	}
+	if lh.el != nil {
+		st = st.AddHUD(htm.Text(title), lh.el)
+	}
+	return st
+}
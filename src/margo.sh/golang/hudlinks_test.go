@@ -0,0 +1,29 @@
+package golang
+
+import (
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"testing"
+)
+
+func TestLinksHUD(t *testing.T) {
+	a, b := &linksHUD{}, &linksHUD{}
+	reduce := func(act mg.Action) {
+		mx := mg.NewTestingCtx(act)
+		defer mx.Cancel()
+		a.reduce(mx, mx.State, "A")
+		b.reduce(mx, mx.State, "B")
+	}
+
+	reduce(linksHUDAct{hud: a, el: htm.Text("links")})
+	if a.el == nil {
+		t.Fatalf("the links were not set")
+	}
+	if b.el != nil {
+		t.Fatalf("the links were set on the wrong article")
+	}
+	reduce(mg.ViewModified{})
+	if a.el != nil {
+		t.Fatalf("the links were not cleared after the view was modified")
+	}
+}
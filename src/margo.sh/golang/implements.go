@@ -0,0 +1,196 @@
+package golang
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// goImpl is a type or method that implements, or is implemented by the object under the cursor
+type goImpl struct {
+	Obj types.Object
+	// Desc describes the relationship e.g. `*T implements I`
+	Desc string
+	Pos  token.Position
+}
+
+// findImplementations returns the list of implementations related to the object under the cursor:
+//
+// * for an interface, the concrete types that implement it
+// * for a concrete type, the interfaces it implements
+// * for an interface method, the methods that implement it
+// * for a concrete method, the interface methods it implements
+//
+// The types considered are those declared in the package of the current view,
+// in the packages that import the package of the object, directly or indirectly,
+// and in all the packages they import.
+func findImplementations(sc *srcChecker) (types.Object, []goImpl, error) {
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, nil, err
+	}
+	v := sc.mx.View
+	id, obj := sp.identAt(sc.fset, v.Filename(), v.Pos)
+	switch {
+	case id == nil:
+		return nil, nil, fmt.Errorf("no identifier under the cursor")
+	case obj == nil:
+		return nil, nil, fmt.Errorf("cannot find the declaration of `%s`", id.Name)
+	}
+
+	pkgs := []*types.Package{sp.Pkg}
+	if sp.XTest {
+		// the dir might only contain the external test package
+		p, err := sc.checkDir(sp.Dir, false)
+		if _, ok := err.(*build.NoGoError); err != nil && !ok {
+			return nil, nil, err
+		}
+		if p != nil {
+			pkgs = append(pkgs, p.Pkg)
+		}
+	}
+	if dir := implSearchDir(sc, sp, obj); dir != "" {
+		if _, checked := sc.pkgs[sc.key(dir, false)]; !checked {
+			// obj was imported through kimporter,
+			// so its package needs to be checked from source before its importers
+			sc = newSrcChecker(sc.mx)
+			pkgs = nil
+		}
+		ipkgs, iobj, err := sc.importersOf(obj, dir, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		obj = iobj
+		for _, p := range ipkgs {
+			pkgs = append(pkgs, p.Pkg)
+		}
+	}
+	named := implTypeNames(pkgs)
+
+	var impls []goImpl
+	switch x := obj.(type) {
+	case *types.TypeName:
+		impls, err = typeImpls(x, named)
+	case *types.Func:
+		impls, err = methodImpls(x, named)
+	default:
+		err = fmt.Errorf("`%s` is not a type or method", obj.Name())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, im := range impls {
+		impls[i].Pos, _ = sc.declPos(im.Obj)
+	}
+	sort.Slice(impls, func(i, j int) bool { return impls[i].Desc < impls[j].Desc })
+	return obj, impls, nil
+}
+
+// implTypeNames returns the non-generic named types declared in pkgs, and all the packages they import
+func implTypeNames(pkgs []*types.Package) []*types.TypeName {
+	named := []*types.TypeName{}
+	for _, tn := range pkgTypeNames(pkgs, true) {
+		if nt, ok := tn.Type().(*types.Named); ok && !isGeneric(nt) {
+			named = append(named, tn)
+		}
+	}
+	return named
+}
+
+// implSearchDir returns the dir of the package whose importers should be searched for implementations of obj,
+// or an empty string if only the package of the current view needs to be searched
+func implSearchDir(sc *srcChecker, sp *srcPkg, obj types.Object) string {
+	if sc.mx.View.Path == "" || obj.Pkg() == nil || isLocalObj(obj) || (sp.XTest && obj.Pkg() == sp.Pkg) {
+		return ""
+	}
+	return sc.pkgDir(obj.Pkg())
+}
+
+// implements returns the type (T or *T) that implements iface, or nil if neither does
+func implements(t types.Type, iface *types.Interface) types.Type {
+	switch {
+	case types.Implements(t, iface):
+		return t
+	case !types.IsInterface(t) && types.Implements(types.NewPointer(t), iface):
+		return types.NewPointer(t)
+	}
+	return nil
+}
+
+// qualifiedName returns the name of t qualified by its package name
+func qualifiedName(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string { return p.Name() })
+}
+
+func typeImpls(tn *types.TypeName, named []*types.TypeName) ([]goImpl, error) {
+	t := tn.Type()
+	iface, isIface := t.Underlying().(*types.Interface)
+	if isIface && iface.NumMethods() == 0 {
+		return nil, fmt.Errorf("`%s` is an empty interface, all types implement it", tn.Name())
+	}
+
+	impls := []goImpl{}
+	for _, x := range named {
+		if x == tn {
+			continue
+		}
+		xiface, ok := x.Type().Underlying().(*types.Interface)
+		switch {
+		case isIface && !ok:
+			if it := implements(x.Type(), iface); it != nil {
+				impls = append(impls, goImpl{Obj: x, Desc: qualifiedName(it) + " implements " + qualifiedName(t)})
+			}
+		case !isIface && ok && xiface.NumMethods() != 0:
+			if it := implements(t, xiface); it != nil {
+				impls = append(impls, goImpl{Obj: x, Desc: qualifiedName(it) + " implements " + qualifiedName(x.Type())})
+			}
+		}
+	}
+	return impls, nil
+}
+
+func methodImpls(fn *types.Func, named []*types.TypeName) ([]goImpl, error) {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return nil, fmt.Errorf("`%s` is not a method", fn.Name())
+	}
+	rt := recv.Type()
+	if p, ok := rt.(*types.Pointer); ok {
+		rt = p.Elem()
+	}
+	iface, isIface := rt.Underlying().(*types.Interface)
+
+	impls := []goImpl{}
+	for _, x := range named {
+		xiface, ok := x.Type().Underlying().(*types.Interface)
+		if x.Type() == rt || ok == isIface {
+			continue
+		}
+		if isIface {
+			it := implements(x.Type(), iface)
+			if it == nil {
+				continue
+			}
+			if m, _, _ := types.LookupFieldOrMethod(it, false, fn.Pkg(), fn.Name()); m != nil {
+				desc := qualifiedName(it) + "." + fn.Name() + " implements " + qualifiedName(rt) + "." + fn.Name()
+				impls = append(impls, goImpl{Obj: m, Desc: desc})
+			}
+			continue
+		}
+		if xiface.NumMethods() == 0 {
+			continue
+		}
+		m, _, _ := types.LookupFieldOrMethod(xiface, false, fn.Pkg(), fn.Name())
+		if m == nil {
+			continue
+		}
+		if it := implements(rt, xiface); it != nil {
+			desc := qualifiedName(it) + "." + fn.Name() + " implements " + qualifiedName(x.Type()) + "." + fn.Name()
+			impls = append(impls, goImpl{Obj: m, Desc: desc})
+		}
+	}
+	return impls, nil
+}
@@ -0,0 +1,116 @@
+package golang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindImplementations(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": implTestSrc,
+		"ex/b/b.go": `package b
+
+import "ex/a"
+
+type R struct{}
+
+func (r *R) Get() int { return 0 }
+
+var _ a.Getter = &R{}
+`,
+		"ex/d/d_test.go": `package d_test
+
+type I interface{ M() }
+
+type X struct{}
+
+func (X) M() {}
+`,
+	})
+	defer cleanup()
+
+	cases := []struct {
+		name  string
+		fn    string
+		src   string
+		obj   string
+		descs []string
+	}{
+		{
+			name:  "interface",
+			fn:    "ex/a/a.go",
+			src:   strings.Replace(implTestSrc, "type Getter", "type Get‸ter", 1),
+			obj:   "Getter",
+			descs: []string{"*b.R implements a.Getter", "a.T implements a.Getter"},
+		},
+		{
+			name:  "concrete type",
+			fn:    "ex/b/b.go",
+			src:   "package b\n\nimport \"ex/a\"\n\ntype R‸ struct{}\n\nfunc (r *R) Get() int { return 0 }\n\nvar _ a.Getter = &R{}\n",
+			obj:   "R",
+			descs: []string{"*b.R implements a.Getter"},
+		},
+		{
+			name:  "interface method",
+			fn:    "ex/a/a.go",
+			src:   strings.Replace(implTestSrc, "{ Get() int }", "{ G‸et() int }", 1),
+			obj:   "Get",
+			descs: []string{"*b.R.Get implements a.Getter.Get", "a.T.Get implements a.Getter.Get"},
+		},
+		{
+			name:  "imported interface",
+			fn:    "ex/b/b.go",
+			src:   "package b\n\nimport \"ex/a\"\n\ntype R struct{}\n\nfunc (r *R) Get() int { return 0 }\n\nvar _ a.Get‸ter = &R{}\n",
+			obj:   "Getter",
+			descs: []string{"*b.R implements a.Getter", "a.T implements a.Getter"},
+		},
+		{
+			name:  "external test package only",
+			fn:    "ex/d/d_test.go",
+			src:   "package d_test\n\ntype I‸ interface{ M() }\n\ntype X struct{}\n\nfunc (X) M() {}\n",
+			obj:   "I",
+			descs: []string{"d_test.X implements d_test.I"},
+		},
+		{
+			name:  "concrete method",
+			fn:    "ex/b/b.go",
+			src:   "package b\n\nimport \"ex/a\"\n\ntype R struct{}\n\nfunc (r *R) G‸et() int { return 0 }\n\nvar _ a.Getter = &R{}\n",
+			obj:   "Get",
+			descs: []string{"*b.R.Get implements a.Getter.Get"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := newCtx(c.fn, c.src)
+			defer mx.Cancel()
+
+			obj, impls, err := findImplementations(newSrcChecker(mx))
+			if err != nil {
+				t.Fatalf("findImplementations() failed: %s", err)
+			}
+			if obj.Name() != c.obj {
+				t.Errorf("expected object `%s`, got `%s`", c.obj, obj.Name())
+			}
+			if len(impls) != len(c.descs) {
+				t.Fatalf("expected %d implementations, got %d: %#v", len(c.descs), len(impls), impls)
+			}
+			for i, im := range impls {
+				if im.Desc != c.descs[i] {
+					t.Errorf("implementation %d: expected %q, got %q", i, c.descs[i], im.Desc)
+				}
+				if !im.Pos.IsValid() {
+					t.Errorf("implementation %d: %q has no position", i, im.Desc)
+				}
+			}
+		})
+	}
+}
+
+const implTestSrc = `package a
+
+type Getter interface{ Get() int }
+
+type T struct{ N int }
+
+func (t T) Get() int { return t.N }
+`
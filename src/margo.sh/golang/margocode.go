@@ -173,7 +173,12 @@ func (mgc *marGocodeCtl) preloadPackages(mx *mg.Ctx) {
 		return
 	}
 
-	defer mx.Begin(mg.Task{Title: "Preloading packages in " + v.ShortFn(mx.Env)}).Done()
+	tsk := mx.Begin(mg.Task{
+		Title:    "Preloading packages in " + v.ShortFn(mx.Env),
+		Priority: mg.TaskPriorityLow,
+		Group:    "Preload",
+	})
+	defer tsk.Done()
 
 	fset := token.NewFileSet()
 	af, _ := parser.ParseFile(fset, v.Filename(), src, parser.ImportsOnly)
@@ -189,8 +194,10 @@ func (mgc *marGocodeCtl) preloadPackages(mx *mg.Ctx) {
 	}
 
 	dir := v.Dir()
-	for _, spec := range af.Imports {
-		importFrom(unquote(spec.Path.Value), dir, 0)
+	for i, spec := range af.Imports {
+		ipath := unquote(spec.Path.Value)
+		tsk.SetProgress(mg.TaskProgress{N: i, Total: len(af.Imports), Status: ipath})
+		importFrom(ipath, dir, 0)
 	}
 }
 
@@ -251,7 +258,7 @@ func newMarGocodeCtl() *marGocodeCtl {
 }
 
 func (mgc *marGocodeCtl) RCond(mx *mg.Ctx) bool {
-	if mx.LangIs(mg.Go) {
+	if mx.LangIs(mg.Go) || mx.ActionIs(mg.QueryPromptChoices{}) {
 		return true
 	}
 	if act, ok := mx.Action.(mg.RunCmd); ok {
@@ -269,9 +276,13 @@ func (mgc *marGocodeCtl) RMount(mx *mg.Ctx) {
 }
 
 func (mgc *marGocodeCtl) Reduce(mx *mg.Ctx) *mg.State {
-	switch mx.Action.(type) {
+	switch act := mx.Action.(type) {
 	case mg.RunCmd:
 		return mx.AddBuiltinCmds(mgc.cmds()...)
+	case mg.QueryPromptChoices:
+		if act.Prompt.Type == mg.PromptTypePackage || act.Prompt.Query == "go.packages" {
+			return mx.AddPromptChoices(mgc.packageChoices(mx)...)
+		}
 	case mg.ViewModified, mg.ViewSaved, mg.ViewActivated:
 		// ViewSaved is probably not required, but saving might result in a `go install`
 		// which results in an updated package.a file
@@ -281,23 +292,58 @@ func (mgc *marGocodeCtl) Reduce(mx *mg.Ctx) *mg.State {
 	return mx.State
 }
 
+// packageChoices returns a PromptChoice for each known package that's importable from the view's dir
+func (mgc *marGocodeCtl) packageChoices(mx *mg.Ctx) []mg.PromptChoice {
+	dir := mx.View.Dir()
+	pkl := mgc.plst.View().List
+	l := make([]mg.PromptChoice, 0, len(pkl))
+	for _, p := range pkl {
+		if !p.Importable(dir) {
+			continue
+		}
+		l = append(l, mg.PromptChoice{
+			Value: p.ImportPath,
+			Desc:  "package " + p.Name,
+		})
+	}
+	return l
+}
+
 func (mgc *marGocodeCtl) scanVFS(mx *mg.Ctx, rootName, rootDir string) {
 	// TODO: (eventually) move this function into plst.Scan
 	// for now, the extra scan at the end is fast enough to not be worth the complexity
 	dir := filepath.Join(rootDir, "src")
-	tsk := mg.Task{Title: "VFS.Scan " + rootName + " ( " + mgutil.ShortFn(rootDir, mx.Env) + " )"}
-	defer mx.Begin(tsk).Done()
+	tsk := mg.Task{
+		Title:    "VFS.Scan " + rootName + " ( " + mgutil.ShortFn(rootDir, mx.Env) + " )",
+		Priority: mg.TaskPriorityLow,
+		Group:    "VFS.Scan",
+	}
+	ticket := mx.Begin(tsk)
+	defer ticket.Done()
 
 	mu := sync.Mutex{}
 	pkgs := 0
+	// dirs found by the scan, and dirs preloaded
+	found, loaded := 0, 0
+	scanning := true
+	// progress must be called with mu held
+	progress := func() {
+		if scanning {
+			ticket.SetProgress(mg.TaskProgress{N: loaded, Status: "scanning"})
+		} else {
+			ticket.SetProgress(mg.TaskProgress{N: loaded, Total: found})
+		}
+	}
 	preload := func(nd *vfs.Node) {
 		_, err := gopkg.ImportDirNd(mx, nd)
-		if err != nil {
-			return
-		}
 		mu.Lock()
-		pkgs++
-		mu.Unlock()
+		defer mu.Unlock()
+
+		loaded++
+		progress()
+		if err == nil {
+			pkgs++
+		}
 	}
 	start := time.Now()
 	wg := &sync.WaitGroup{}
@@ -316,10 +362,20 @@ func (mgc *marGocodeCtl) scanVFS(mx *mg.Ctx, rootName, rootDir string) {
 	}
 	mx.VFS.Scan(dir, vfs.ScanOptions{
 		Filter: gopkg.ScanFilter,
-		Dirs:   func(nd *vfs.Node) { dirs <- nd },
+		Dirs: func(nd *vfs.Node) {
+			mu.Lock()
+			found++
+			mu.Unlock()
+			dirs <- nd
+		},
 	})
+	mu.Lock()
+	scanning = false
+	progress()
+	mu.Unlock()
 	close(dirs)
 	wg.Wait()
+	ticket.SetStatus("indexing packages")
 	mgc.plst.Scan(mx, dir)
 	dur := mgpf.Since(start)
 	mx.Log.Printf("%s: %d packages preloaded in %s\n", tsk.Title, pkgs, dur)
@@ -0,0 +1,310 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"margo.sh/golang/gopkg"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// organizeImports is the reducer behind OrganizeImports
+type organizeImports struct {
+	mg.ReducerType
+
+	// sc is the checker of the last run, and scKey identifies the view it checked.
+	// Type-checking the package is the expensive part, so it's only redone when the view changes.
+	sc    *srcChecker
+	scKey string
+}
+
+func (oi *organizeImports) Reduce(mx *mg.Ctx) *mg.State {
+	return FmtFunc(func(mx *mg.Ctx, src []byte) ([]byte, error) {
+		return organizeImportsSrc(oi.checker(mx), src)
+	}).Reduce(mx)
+}
+
+// checker returns the checker of the last run if the view hasn't changed since, or a new one
+func (oi *organizeImports) checker(mx *mg.Ctx) *srcChecker {
+	v := mx.View
+	k := v.Filename() + "\x00" + v.Hash
+	if oi.sc == nil || oi.scKey != k || v.Hash == "" {
+		oi.sc = newSrcChecker(mx)
+		oi.scKey = k
+	}
+	oi.sc.mx = mx
+	return oi.sc
+}
+
+// organizeImportsSrc returns src, formatted with gofmt, after adding missing imports,
+// removing unused ones and grouping the standard library imports before the others.
+//
+// Missing imports are found by type-checking the package of the current view,
+// and looking up the names of packages that aren't declared in the package list.
+func organizeImportsSrc(sc *srcChecker, src []byte) ([]byte, error) {
+	mx := sc.mx
+	fn := mx.View.Filename()
+	if _, err := parser.ParseFile(token.NewFileSet(), fn, src, 0); err != nil {
+		return nil, err
+	}
+
+	sc.srcMap[fn] = src
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, err
+	}
+	af := sp.file(sc.fset, fn)
+	if af == nil {
+		return nil, fmt.Errorf("cannot parse %s", mx.View.Basename())
+	}
+	add, rem := importChanges(mx, sp, af)
+	if len(add) != 0 || len(rem) != 0 {
+		src, _ = updateImports(fn, src, add, rem)
+	}
+	return format.Source(groupImports(mx, fn, src))
+}
+
+// importChanges returns the list of imports that are missing from af, and the list of unused imports
+func importChanges(mx *mg.Ctx, sp *srcPkg, af *ast.File) (add, rem impSpecList) {
+	info := sp.Info
+	// the names of the imported packages that are used, and those that aren't declared
+	used := map[string]bool{}
+	missing := map[string]bool{}
+	ast.Inspect(af, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		switch obj := info.Uses[id].(type) {
+		case nil:
+			used[id.Name] = true
+			if ast.IsExported(sel.Sel.Name) {
+				missing[id.Name] = true
+			}
+		case *types.PkgName:
+			used[obj.Name()] = true
+		}
+		return true
+	})
+
+	for _, spec := range af.Imports {
+		ipath, _ := strconv.Unquote(spec.Path.Value)
+		imp := impSpec{Path: ipath}
+		name := ""
+		pn, _ := info.Implicits[spec].(*types.PkgName)
+		if spec.Name != nil {
+			imp.Name = spec.Name.Name
+			name = imp.Name
+			pn, _ = info.Defs[spec.Name].(*types.PkgName)
+		} else if pn != nil {
+			name = pn.Name()
+		}
+		// if the package couldn't be imported, go/types makes up a fake, incomplete package,
+		// so its name is only a guess, and uses of its real name appear to be undefined
+		failed := pn == nil || !pn.Imported().Complete()
+		switch {
+		case ipath == "C" || imp.Name == "_" || imp.Name == ".":
+		case failed:
+			// we don't know whether it's used, so it must be kept
+			if imp.Name == "" {
+				delete(missing, assumedPkgName(ipath))
+			}
+		case !used[name]:
+			rem = append(rem, imp)
+		}
+		delete(missing, name)
+	}
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ipath := importPathForName(mx, sp, name)
+		if ipath == "" {
+			continue
+		}
+		imp := impSpec{Path: ipath}
+		if path.Base(ipath) != name {
+			imp.Name = name
+		}
+		add = append(add, imp)
+	}
+	return add, rem
+}
+
+// assumedPkgName returns the likely name of the package imported as ipath
+// e.g. `yaml` for `gopkg.in/yaml.v2` or `mux` for `github.com/gorilla/mux/v2`
+func assumedPkgName(ipath string) string {
+	base := path.Base(ipath)
+	if strings.HasPrefix(base, "v") && strings.Trim(base[1:], "0123456789") == "" && path.Dir(ipath) != "." {
+		// it's a major version suffix
+		base = path.Base(path.Dir(ipath))
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// importPathForName returns the import path of a package named name.
+//
+// Packages imported by other files in the package are preferred,
+// followed by packages in the same module (or repository), and those in the package list.
+func importPathForName(mx *mg.Ctx, sp *srcPkg, name string) string {
+	for _, af := range sp.Files {
+		for _, spec := range af.Imports {
+			pn, _ := sp.Info.Defs[spec.Name].(*types.PkgName)
+			if pn == nil {
+				pn, _ = sp.Info.Implicits[spec].(*types.PkgName)
+			}
+			if pn != nil && pn.Name() == name {
+				return pn.Imported().Path()
+			}
+		}
+	}
+
+	dir := mx.View.Dir()
+	root := searchRoot(mx, dir)
+	for _, p := range mctl.plst.View().ByName[name] {
+		if p.Importable(dir) && (p.Dir == root || mgutil.IsParentDir(root, p.Dir)) {
+			return p.ImportPath
+		}
+	}
+	if ipath := mctl.importPathByName(name, dir); ipath != "" {
+		return ipath
+	}
+	// the package list might not be loaded yet, but most standard library packages are named after their path
+	if pp, err := gopkg.FindPkg(mx, name, dir); err == nil && pp.Goroot {
+		return name
+	}
+	return ""
+}
+
+// groupImports returns src with the imports in each import declaration sorted,
+// and the standard library imports grouped before the others.
+// The other imports keep the groups, separated by blank lines, that they're already in
+// e.g. a group for the packages in the current module.
+// Declarations that contain comments or `import "C"` are left unchanged.
+func groupImports(mx *mg.Ctx, fn string, src []byte) []byte {
+	fset := token.NewFileSet()
+	af, err := parser.ParseFile(fset, fn, src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return src
+	}
+	tf := fset.File(af.Pos())
+	dir := mx.View.Dir()
+
+	type edit struct {
+		start, end int
+		s          string
+	}
+	var edits []edit
+	for _, d := range af.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || !gd.Lparen.IsValid() || len(gd.Specs) < 2 {
+			continue
+		}
+		hasComments := false
+		for _, cg := range af.Comments {
+			if gd.Pos() <= cg.Pos() && cg.End() <= gd.End() {
+				hasComments = true
+			}
+		}
+		var std []string
+		var other [][]string
+		lastLine := 0
+		for _, spec := range gd.Specs {
+			spec := spec.(*ast.ImportSpec)
+			ipath, _ := strconv.Unquote(spec.Path.Value)
+			if ipath == "C" {
+				hasComments = true
+			}
+			s := spec.Path.Value
+			if spec.Name != nil {
+				s = spec.Name.Name + " " + s
+			}
+			line := tf.Line(spec.Pos())
+			if len(other) == 0 || line > lastLine+1 {
+				// a blank line starts a new group
+				other = append(other, nil)
+			}
+			lastLine = tf.Line(spec.End())
+			if isStdImport(mx, ipath, dir) {
+				std = append(std, s)
+			} else {
+				other[len(other)-1] = append(other[len(other)-1], s)
+			}
+		}
+		if hasComments {
+			continue
+		}
+		groups := [][]string{std}
+		for _, l := range other {
+			if len(l) != 0 {
+				groups = append(groups, l)
+			}
+		}
+		buf := &bytes.Buffer{}
+		buf.WriteString("import (\n")
+		sep := ""
+		for _, l := range groups {
+			if len(l) == 0 {
+				continue
+			}
+			sortImports(l)
+			buf.WriteString(sep)
+			for _, s := range l {
+				buf.WriteString("\t" + s + "\n")
+			}
+			sep = "\n"
+		}
+		buf.WriteString(")")
+		edits = append(edits, edit{tf.Offset(gd.Pos()), tf.Offset(gd.End()), buf.String()})
+	}
+
+	buf := &bytes.Buffer{}
+	pos := 0
+	for _, e := range edits {
+		buf.Write(src[pos:e.start])
+		buf.WriteString(e.s)
+		pos = e.end
+	}
+	buf.Write(src[pos:])
+	return buf.Bytes()
+}
+
+// sortImports sorts a list of import specs by their path
+func sortImports(l []string) {
+	ipath := func(s string) string {
+		return unquote(s[strings.IndexAny(s, "\"`"):])
+	}
+	sort.SliceStable(l, func(i, j int) bool { return ipath(l[i]) < ipath(l[j]) })
+}
+
+// isStdImport returns true if ipath is the import path of a standard library package
+func isStdImport(mx *mg.Ctx, ipath, srcDir string) bool {
+	if pp, err := gopkg.FindPkg(mx, ipath, srcDir); err == nil {
+		return pp.Goroot
+	}
+	// packages outside the standard library usually start with a domain name
+	return !strings.Contains(strings.SplitN(ipath, "/", 2)[0], ".")
+}
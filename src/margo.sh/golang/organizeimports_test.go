@@ -0,0 +1,92 @@
+package golang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOrganizeImports(t *testing.T) {
+	src := `package a
+
+import (
+	"ex/b"
+	"os"
+	"fmt"
+)
+
+func F() string {
+	fmt.Println(b.V)
+	return strings.TrimSpace(c.V)
+}
+`
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go":  src,
+		"ex/a/c.go":  "package a\n\nimport c \"ex/cc\"\n\nvar _ = c.V\n",
+		"ex/b/b.go":  "package b\n\nvar V = 1\n",
+		"ex/cc/c.go": "package c\n\nvar V = \"\"\n",
+	})
+	defer cleanup()
+
+	mx := newCtx("ex/a/a.go", src)
+	defer mx.Cancel()
+	res, err := organizeImportsSrc(newSrcChecker(mx), []byte(src))
+	if err != nil {
+		t.Fatalf("organizeImportsSrc failed: %s", err)
+	}
+	exp := "import (\n\t\"fmt\"\n\t\"strings\"\n\n\t\"ex/b\"\n\tc \"ex/cc\"\n)\n"
+	if !strings.Contains(string(res), exp) {
+		t.Fatalf("expected imports:\n%s\ngot:\n%s", exp, res)
+	}
+}
+
+func TestOrganizeImportsGroupsAndFailedImports(t *testing.T) {
+	src := `package a
+
+import (
+	"gopkg.in/yaml.v2"
+	"os"
+
+	"ex/b"
+
+	"ex/local/l"
+	"fmt"
+)
+
+func F() {
+	yaml.Marshal(nil)
+	fmt.Println(b.V, l.V, os.Args)
+}
+`
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go":       src,
+		"ex/b/b.go":       "package b\n\nvar V = 1\n",
+		"ex/local/l/l.go": "package l\n\nvar V = 1\n",
+	})
+	defer cleanup()
+
+	mx := newCtx("ex/a/a.go", src)
+	defer mx.Cancel()
+	res, err := organizeImportsSrc(newSrcChecker(mx), []byte(src))
+	if err != nil {
+		t.Fatalf("organizeImportsSrc failed: %s", err)
+	}
+	// the yaml package can't be imported, so it must not be removed, nor imported again
+	exp := "import (\n\t\"fmt\"\n\t\"os\"\n\n\t\"gopkg.in/yaml.v2\"\n\n\t\"ex/b\"\n\n\t\"ex/local/l\"\n)\n"
+	if !strings.Contains(string(res), exp) {
+		t.Fatalf("expected imports:\n%s\ngot:\n%s", exp, res)
+	}
+}
+
+func TestAssumedPkgName(t *testing.T) {
+	cases := map[string]string{
+		"fmt":                       "fmt",
+		"gopkg.in/yaml.v2":          "yaml",
+		"github.com/gorilla/mux/v2": "mux",
+		"github.com/x/go-sqlite3":   "sqlite3",
+	}
+	for ipath, exp := range cases {
+		if name := assumedPkgName(ipath); name != exp {
+			t.Errorf("assumedPkgName(%s): expected `%s`, got `%s`", ipath, exp, name)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package golang
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Outline lists the symbols declared in the current view, or its package.
+//
+// It responds to the QueryDeclarations action with a tree of declarations
+// (methods are grouped under their receiver type along with its fields),
+// and adds the builtin command `go.outline` that lists them in the HUD.
+// If `go.outline -pkg` is called, the declarations in all files of the package are listed.
+type Outline struct {
+	mg.ReducerType
+
+	hud linksHUD
+}
+
+func (o *Outline) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (o *Outline) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State
+	switch act := mx.Action.(type) {
+	case mg.QueryDeclarations:
+		st = st.AddDeclarations(goDeclarations(mx, act.Package)...)
+	case mg.QueryUserCmds:
+		st = st.AddUserCmds(
+			mg.UserCmd{
+				Title: "Go Outline",
+				Name:  "go.outline",
+				Desc:  "list the declarations in the current file",
+			},
+			mg.UserCmd{
+				Title: "Go Package Outline",
+				Name:  "go.outline",
+				Args:  []string{"-pkg"},
+				Desc:  "list the declarations in the current package",
+			},
+		)
+	case mg.RunCmd:
+		st = st.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "go.outline",
+			Desc: "List the declarations in the current file. Use -pkg to list those in the package.",
+			Run:  o.runOutline,
+		})
+	}
+	return o.hud.reduce(mx, st, "Outline")
+}
+
+func (o *Outline) runOutline(cx *mg.CmdCtx) *mg.State {
+	pkg := false
+	for _, s := range cx.Args {
+		if s == "-pkg" || s == "--pkg" {
+			pkg = true
+		}
+	}
+	go o.outline(cx, pkg)
+	return cx.State
+}
+
+func (o *Outline) outline(cx *mg.CmdCtx, pkg bool) {
+	defer cx.Output.Close()
+
+	decls := goDeclarations(cx.Ctx, pkg)
+	if len(decls) == 0 {
+		cx.Output.Write([]byte("no declarations found\n"))
+		return
+	}
+	o.hud.set(cx.Ctx, outlineHUD(cx.View, decls))
+}
+
+// outlineHUD returns the tree of declarations as a list of Activate links
+func outlineHUD(v *mg.View, decls []mg.Declaration) htm.Element {
+	var items []htm.Element
+	for _, d := range decls {
+		act := mg.Activate{Path: d.Path, Row: d.Row, Col: d.Col}
+		if act.Path == "" {
+			act.Name = v.Name
+		}
+		els := []htm.Element{
+			htm.Text(d.Kind + " "),
+			htm.A(&htm.AAttrs{Action: act}, htm.Text(d.Name)),
+		}
+		if d.Detail != "" {
+			els = append(els, htm.EmText(" "+d.Detail))
+		}
+		if len(d.Children) != 0 {
+			els = append(els, outlineHUD(v, d.Children))
+		}
+		items = append(items, htm.Li(nil, els...))
+	}
+	return htm.Ul(nil, items...)
+}
+
+// goDeclarations returns the tree of declarations in the current view.
+// If pkg is true, the declarations in the other files of its package are included.
+func goDeclarations(mx *mg.Ctx, pkg bool) []mg.Declaration {
+	v := mx.View
+	src, err := v.ReadAll()
+	if err != nil {
+		return nil
+	}
+	fns := []string{v.Filename()}
+	if pkg && v.Path != "" {
+		if bp, err := BuildContext(mx).ImportDir(v.Dir(), 0); err == nil {
+			for _, l := range [][]string{bp.GoFiles, bp.CgoFiles, bp.TestGoFiles} {
+				for _, nm := range l {
+					if fn := filepath.Join(v.Dir(), nm); fn != v.Filename() {
+						fns = append(fns, fn)
+					}
+				}
+			}
+		}
+	}
+
+	ob := &outlineBuilder{
+		types:   map[string]int{},
+		methods: map[string][]mg.Declaration{},
+	}
+	for _, fn := range fns {
+		fsrc := src
+		if fn != v.Filename() {
+			fsrc, err = mx.VFS.ReadBlob(fn).ReadFile()
+			if err != nil {
+				continue
+			}
+		}
+		pf := ParseFile(mx, fn, fsrc)
+		if pf.AstFile == nil || pf.AstFile == NilAstFile {
+			continue
+		}
+		path := fn
+		if fn == v.Filename() && v.Path == "" {
+			path = ""
+		}
+		ob.addFile(pf.Fset, path, pf.AstFile)
+	}
+	return ob.decls()
+}
+
+// outlineBuilder builds a tree of declarations from a list of files
+type outlineBuilder struct {
+	list []mg.Declaration
+	// types maps the names of types to their index in list
+	types map[string]int
+	// methods maps the names of receiver types to their methods
+	methods map[string][]mg.Declaration
+}
+
+func (ob *outlineBuilder) decl(fset *token.FileSet, path string, id *ast.Ident, kind, detail string) mg.Declaration {
+	p := fset.Position(id.Pos())
+	return mg.Declaration{
+		Name:   id.Name,
+		Kind:   kind,
+		Detail: detail,
+		Path:   path,
+		Row:    p.Line - 1,
+		Col:    p.Column - 1,
+	}
+}
+
+func (ob *outlineBuilder) addFile(fset *token.FileSet, path string, af *ast.File) {
+	for _, d := range af.Decls {
+		switch x := d.(type) {
+		case *ast.FuncDecl:
+			ob.addFunc(fset, path, x)
+		case *ast.GenDecl:
+			for _, spec := range x.Specs {
+				ob.addSpec(fset, path, x.Tok, spec)
+			}
+		}
+	}
+}
+
+func (ob *outlineBuilder) addFunc(fset *token.FileSet, path string, fd *ast.FuncDecl) {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		ob.list = append(ob.list, ob.decl(fset, path, fd.Name, "func", strings.TrimPrefix(nodeStr(fset, fd.Type), "func")))
+		return
+	}
+	recv := recvTypeName(fd.Recv.List[0].Type)
+	detail := strings.TrimPrefix(nodeStr(fset, fd.Type), "func")
+	ob.methods[recv] = append(ob.methods[recv], ob.decl(fset, path, fd.Name, "method", detail))
+}
+
+func (ob *outlineBuilder) addSpec(fset *token.FileSet, path string, tok token.Token, spec ast.Spec) {
+	switch x := spec.(type) {
+	case *ast.TypeSpec:
+		d := ob.decl(fset, path, x.Name, "type", typeDetail(fset, x.Type))
+		switch t := x.Type.(type) {
+		case *ast.StructType:
+			d.Children = ob.fields(fset, path, t.Fields, "field")
+		case *ast.InterfaceType:
+			d.Children = ob.fields(fset, path, t.Methods, "method")
+		}
+		ob.types[x.Name.Name] = len(ob.list)
+		ob.list = append(ob.list, d)
+	case *ast.ValueSpec:
+		for i, id := range x.Names {
+			if id.Name == "_" {
+				continue
+			}
+			detail := ""
+			switch {
+			case x.Type != nil:
+				detail = nodeStr(fset, x.Type)
+			case tok == token.CONST && i < len(x.Values):
+				if lit, ok := x.Values[i].(*ast.BasicLit); ok && len(lit.Value) <= 64 {
+					detail = "= " + lit.Value
+				}
+			}
+			ob.list = append(ob.list, ob.decl(fset, path, id, tok.String(), detail))
+		}
+	}
+}
+
+func (ob *outlineBuilder) fields(fset *token.FileSet, path string, fl *ast.FieldList, kind string) []mg.Declaration {
+	var l []mg.Declaration
+	for _, f := range fl.List {
+		detail := nodeStr(fset, f.Type)
+		if ft, ok := f.Type.(*ast.FuncType); ok && kind == "method" {
+			detail = strings.TrimPrefix(nodeStr(fset, ft), "func")
+		}
+		if len(f.Names) == 0 {
+			// embedded field or interface
+			if nm := recvTypeName(f.Type); nm != "" {
+				id := &ast.Ident{NamePos: f.Type.Pos(), Name: nm}
+				l = append(l, ob.decl(fset, path, id, "embedded", detail))
+			}
+			continue
+		}
+		for _, id := range f.Names {
+			l = append(l, ob.decl(fset, path, id, kind, detail))
+		}
+	}
+	return l
+}
+
+// decls returns the tree of declarations, with methods grouped under their receiver type
+func (ob *outlineBuilder) decls() []mg.Declaration {
+	names := make([]string, 0, len(ob.methods))
+	for nm := range ob.methods {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	for _, nm := range names {
+		methods := ob.methods[nm]
+		if i, ok := ob.types[nm]; ok {
+			ob.list[i].Children = append(ob.list[i].Children, methods...)
+			continue
+		}
+		// the type is declared in another file
+		m := methods[0]
+		ob.list = append(ob.list, mg.Declaration{
+			Name:     nm,
+			Kind:     "type",
+			Path:     m.Path,
+			Row:      m.Row,
+			Col:      m.Col,
+			Children: methods,
+		})
+	}
+	return ob.list
+}
+
+// recvTypeName returns the name of the type in a receiver or embedded field expression e.g. `*T[P]` -> `T`
+func recvTypeName(x ast.Expr) string {
+	for {
+		switch t := x.(type) {
+		case *ast.Ident:
+			return t.Name
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.SelectorExpr:
+			return t.Sel.Name
+		case *ast.IndexExpr:
+			x = t.X
+		default:
+			if x = indexListX(x); x == nil {
+				return ""
+			}
+		}
+	}
+}
+
+// typeDetail returns a short description of the type expression x
+func typeDetail(fset *token.FileSet, x ast.Expr) string {
+	switch x.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	s := nodeStr(fset, x)
+	if len(s) > 64 || strings.Contains(s, "\n") {
+		return ""
+	}
+	return s
+}
+
+// nodeStr returns the src of node, as printed by go/printer
+func nodeStr(fset *token.FileSet, node ast.Node) string {
+	buf := &bytes.Buffer{}
+	printer.Fprint(buf, fset, node)
+	return buf.String()
+}
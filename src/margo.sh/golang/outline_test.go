@@ -0,0 +1,81 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"strings"
+	"testing"
+)
+
+func TestGoDeclarations(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": `package a
+
+const Answer = 42
+
+type T struct {
+	N int
+	fmt.Stringer
+}
+
+func New() *T { return &T{} }
+`,
+		"ex/a/b.go": `package a
+
+var X, Y int
+
+func (t *T) Get() int { return t.N }
+
+func (u U) Len() int { return 0 }
+`,
+	})
+	defer cleanup()
+
+	str := func(l []mg.Declaration) string {
+		var f func(indent string, l []mg.Declaration) string
+		f = func(indent string, l []mg.Declaration) string {
+			s := ""
+			for _, d := range l {
+				s += indent + strings.TrimSpace(d.Kind+" "+d.Name+" "+d.Detail) + "\n"
+				s += f(indent+"\t", d.Children)
+			}
+			return s
+		}
+		return strings.TrimSpace(f("", l))
+	}
+
+	file := newCtx("ex/a/b.go", "")
+	defer file.Cancel()
+	exp := strings.TrimSpace(`
+var X int
+var Y int
+type T
+	method Get () int
+type U
+	method Len () int
+`)
+	if s := str(goDeclarations(file, false)); s != exp {
+		t.Errorf("file declarations: expected:\n%s\ngot:\n%s", exp, s)
+	}
+
+	pkg := newCtx("ex/a/a.go", "")
+	defer pkg.Cancel()
+	decls := goDeclarations(pkg, true)
+	exp = strings.TrimSpace(`
+const Answer = 42
+type T struct
+	field N int
+	embedded Stringer fmt.Stringer
+	method Get () int
+func New () *T
+var X int
+var Y int
+type U
+	method Len () int
+`)
+	if s := str(decls); s != exp {
+		t.Errorf("package declarations: expected:\n%s\ngot:\n%s", exp, s)
+	}
+	if d := decls[0]; d.Row != 2 || d.Col != 6 || !strings.HasSuffix(d.Path, "a.go") {
+		t.Errorf("expected Answer to be declared at a.go:2:6, got %s:%d:%d", d.Path, d.Row, d.Col)
+	}
+}
@@ -0,0 +1,255 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"sort"
+)
+
+var (
+	// ReferencesHUDLimit is the maximum number of references listed in the HUD
+	ReferencesHUDLimit = 50
+)
+
+// References adds the builtin commands `goto.references` and `.refs`
+// that list all references to the identifier under the cursor.
+//
+// The package of the current view and all packages in the same module (or repository)
+// that import it are searched, using the unsaved src of the current view.
+// Results are written to the output panel and listed in the HUD as links.
+type References struct {
+	mg.ReducerType
+
+	hud linksHUD
+}
+
+func (r *References) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (r *References) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State
+	switch mx.Action.(type) {
+	case mg.QueryUserCmds:
+		st = st.AddUserCmds(mg.UserCmd{
+			Title: "Find References",
+			Name:  "goto.references",
+			Desc:  "list all references to the identifier under the cursor",
+		})
+	case mg.RunCmd:
+		st = st.AddBuiltinCmds(
+			mg.BuiltinCmd{Name: "goto.references", Desc: "List all references to the identifier under the cursor", Run: r.runRefs},
+			mg.BuiltinCmd{Name: ".refs", Desc: "Alias of goto.references", Run: r.runRefs},
+		)
+	}
+	return r.hud.reduce(mx, st, "References")
+}
+
+func (r *References) runRefs(cx *mg.CmdCtx) *mg.State {
+	go r.refs(cx)
+	return cx.State
+}
+
+func (r *References) refs(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+	defer cx.Begin(mg.Task{Title: "Go/References", ShowNow: true}).Done()
+
+	refs, obj, err := findReferences(cx.Ctx)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
+		return
+	}
+
+	v := cx.View
+	links := make([]htm.Element, 0, len(refs))
+	buf := &bytes.Buffer{}
+	for _, ref := range refs {
+		fn := mgutil.ShortFn(ref.Pos.Filename, cx.Env)
+		fmt.Fprintf(buf, "%s:%d:%d: %s\n", fn, ref.Pos.Line, ref.Pos.Column, ref.Line)
+		if len(links) >= ReferencesHUDLimit {
+			continue
+		}
+		act := posActivate(v, ref.Pos)
+		links = append(links, htm.Div(nil,
+			htm.A(&htm.AAttrs{Action: act}, htm.Textf("%s:%d", fn, ref.Pos.Line)),
+			htm.Text(" "+ref.Line),
+		))
+	}
+	fmt.Fprintf(buf, "%d references to `%s`\n", len(refs), obj.Name())
+	cx.Output.Write(buf.Bytes())
+
+	hud := htm.Div(nil, append([]htm.Element{htm.Textf("%d references to `%s`", len(refs), obj.Name())}, links...)...)
+	r.hud.set(cx.Ctx, hud)
+}
+
+// goRef is a reference to an object
+type goRef struct {
+	Pos token.Position
+	// Def is true if the reference is the object's declaration
+	Def bool
+	// Line is the text of the line on which the reference appears
+	Line string
+}
+
+// findReferences returns the list of references to the object under the cursor, sorted by position
+func findReferences(mx *mg.Ctx) ([]goRef, types.Object, error) {
+	rs, err := newRefSearch(mx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rs.refs(rs.obj), rs.obj, nil
+}
+
+// refSearch is the object under the cursor and the list of packages that may refer to it
+type refSearch struct {
+	sc   *srcChecker
+	id   *ast.Ident
+	obj  types.Object
+	view *srcPkg
+	pkgs []*srcPkg
+}
+
+func newRefSearch(mx *mg.Ctx) (*refSearch, error) {
+	sc := newSrcChecker(mx)
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, err
+	}
+	v := mx.View
+	id, obj := sp.identAt(sc.fset, v.Filename(), v.Pos)
+	switch {
+	case id == nil:
+		return nil, fmt.Errorf("no identifier under the cursor")
+	case obj == nil:
+		return nil, fmt.Errorf("cannot find the declaration of `%s`", id.Name)
+	case obj.Pkg() == nil:
+		return nil, fmt.Errorf("`%s` is predeclared", id.Name)
+	}
+
+	rs := &refSearch{sc: sc, id: id, obj: obj, view: sp, pkgs: []*srcPkg{sp}}
+	if sp.XTest {
+		// the dir might only contain the external test package
+		p, err := sc.checkDir(sp.Dir, false)
+		if _, ok := err.(*build.NoGoError); err != nil && !ok {
+			return nil, err
+		}
+		if p != nil {
+			rs.pkgs = append(rs.pkgs, p)
+		}
+	}
+	if isLocalObj(obj) || v.Path == "" || (sp.XTest && obj.Pkg() == sp.Pkg) {
+		return rs, nil
+	}
+
+	dir := sc.pkgDir(obj.Pkg())
+	if dir == "" {
+		return nil, fmt.Errorf("cannot find the package dir of `%s`", obj.Pkg().Path())
+	}
+	if _, checked := sc.pkgs[sc.key(dir, false)]; !checked {
+		// obj was imported through kimporter,
+		// so its package needs to be checked from source before its importers
+		rs.sc = newSrcChecker(mx)
+		rs.view = nil
+	}
+	if rs.pkgs, rs.obj, err = rs.sc.importersOf(obj, dir, isFieldOrMethod(obj)); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// refs returns the list of references to the objects in objs, sorted by position
+func (rs *refSearch) refs(objs ...types.Object) []goRef {
+	match := func(o types.Object) bool {
+		for _, obj := range objs {
+			if o == obj {
+				return true
+			}
+		}
+		return false
+	}
+	refs := []goRef{}
+	lines := map[string][][]byte{}
+	seen := map[token.Pos]bool{}
+	add := func(p token.Pos, def bool) {
+		// the ident of an embedded field is both a use of the type and the field's definition
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		ref := goRef{Pos: rs.sc.fset.Position(p), Def: def}
+		fn := ref.Pos.Filename
+		if _, ok := lines[fn]; !ok {
+			src, _ := rs.sc.readFile(fn)
+			lines[fn] = bytes.Split(src, []byte{'\n'})
+		}
+		if l := lines[fn]; ref.Pos.Line-1 < len(l) {
+			ref.Line = string(bytes.TrimSpace(l[ref.Pos.Line-1]))
+		}
+		refs = append(refs, ref)
+	}
+	for _, p := range rs.pkgs {
+		for id, o := range p.Info.Defs {
+			if match(o) {
+				add(id.Pos(), true)
+			}
+		}
+		for id, o := range p.Info.Uses {
+			if match(o) {
+				add(id.Pos(), false)
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		p, q := refs[i].Pos, refs[j].Pos
+		if p.Filename != q.Filename {
+			return p.Filename < q.Filename
+		}
+		return p.Offset < q.Offset
+	})
+	return refs
+}
+
+// importersOf checks the package in dir that declares obj and all the packages that import it.
+// It returns the list of packages and the object that corresponds to obj in the package in dir.
+//
+// If transitive is true, packages that import dir indirectly are also checked
+// e.g. fields and methods can be promoted through types declared in other packages.
+func (sc *srcChecker) importersOf(obj types.Object, dir string, transitive bool) ([]*srcPkg, types.Object, error) {
+	sp, err := sc.checkDir(dir, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if obj = lookupObj(obj, sp.Pkg); obj == nil {
+		return nil, nil, fmt.Errorf("cannot find the declaration in %s", dir)
+	}
+
+	dirs := sc.importers(searchRoot(sc.mx, sc.mx.View.Dir()), dir, transitive)
+	// the importers must see each other as checked from source, whatever order they're checked in
+	for _, d := range dirs {
+		sc.fromSrc[d] = true
+	}
+	pkgs := []*srcPkg{sp}
+	for _, d := range dirs {
+		for _, xtest := range []bool{false, true} {
+			if d == dir && !xtest {
+				continue
+			}
+			p, err := sc.checkDir(d, xtest)
+			if _, ok := err.(*build.NoGoError); ok {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs, obj, nil
+}
@@ -0,0 +1,201 @@
+package golang
+
+import (
+	"go/build"
+	"io/ioutil"
+	"margo.sh/mg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestGopath creates a GOPATH containing the files in pkgs, keyed by their path relative to $GOPATH/src.
+// It returns the GOPATH and a function that creates a Ctx whose view is the file fn with the cursor
+// at the first occurrence of `‸` in src, which is removed from src.
+// If src is empty, the file's contents are used instead.
+func newTestGopath(t *testing.T, pkgs map[string]string) (gopath string, newCtx func(fn, src string) *mg.Ctx, cleanup func()) {
+	gopath, err := ioutil.TempDir("", "margo-golang-test")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %s", err)
+	}
+	for fn, src := range pkgs {
+		p := filepath.Join(gopath, "src", filepath.FromSlash(fn))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := ioutil.WriteFile(p, []byte(strings.Replace(src, "‸", "", 1)), 0644); err != nil {
+			t.Fatalf("cannot write %s: %s", p, err)
+		}
+	}
+	// the VFS doesn't rescan dirs whose mtime is the same as when they were first seen,
+	// so make sure they don't appear to have been modified just now
+	old := time.Now().Add(-time.Hour)
+	filepath.Walk(gopath, func(p string, _ os.FileInfo, _ error) error {
+		return os.Chtimes(p, old, old)
+	})
+	newCtx = func(fn, src string) *mg.Ctx {
+		if src == "" {
+			src = pkgs[fn]
+		}
+		pos := strings.Index(src, "‸")
+		src = strings.Replace(src, "‸", "", 1)
+		mx := mg.NewTestingCtx(nil)
+		st := mx.State.SetEnv(mg.EnvMap{
+			"GOROOT":      build.Default.GOROOT,
+			"GOPATH":      gopath,
+			"GO111MODULE": "off",
+		})
+		v := st.View.Copy(func(v *mg.View) {
+			v.Path = filepath.Join(gopath, "src", filepath.FromSlash(fn))
+			v.Name = filepath.Base(v.Path)
+			v.Src = []byte(src)
+			v.Pos = pos
+			v.Lang = mg.Go
+		})
+		return mx.Copy(func(mx *mg.Ctx) { mx.State = st.SetView(v) })
+	}
+	return gopath, newCtx, func() { os.RemoveAll(gopath) }
+}
+
+func TestFindReferences(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": `package a
+
+type T struct{ N int }
+
+func (t T) Get() int { return t.N }
+
+func New‸(n int) T {
+	var local int
+	local = n
+	return T{N: local}
+}
+`,
+		"ex/a/a_test.go": `package a
+
+import "testing"
+
+func TestNew(t *testing.T) { New(1) }
+`,
+		"ex/b/b.go": `package b
+
+import "ex/a"
+
+var X = a.New(2).Get()
+`,
+		"ex/c/c.go": `package c
+
+func New() {}
+`,
+		"ex/d/d_test.go": `package d_test
+
+import "testing"
+
+func helper() {}
+
+func TestD(t *testing.T) { helper() }
+`,
+		"ex/e/e.go": `package e
+
+import "ex/a"
+
+type E struct{ a.T }
+`,
+		"ex/f/f.go": `package f
+
+import "ex/e"
+
+var Y = e.E{}.Get()
+`,
+	})
+	defer cleanup()
+
+	type ref struct {
+		fn   string
+		line int
+		def  bool
+	}
+	cases := []struct {
+		name string
+		fn   string
+		src  string
+		obj  string
+		refs []ref
+	}{
+		{
+			name: "exported func",
+			fn:   "ex/a/a.go",
+			obj:  "New",
+			refs: []ref{{"a/a.go", 7, true}, {"a/a_test.go", 5, false}, {"b/b.go", 5, false}},
+		},
+		{
+			name: "method used in importer",
+			fn:   "ex/b/b.go",
+			src:  "package b\n\nimport \"ex/a\"\n\nvar X = a.New(2).G‸et()\n",
+			obj:  "Get",
+			refs: []ref{{"a/a.go", 5, true}, {"b/b.go", 5, false}, {"f/f.go", 5, false}},
+		},
+		{
+			name: "external test package only",
+			fn:   "ex/d/d_test.go",
+			src:  "package d_test\n\nimport \"testing\"\n\nfunc help‸er() {}\n\nfunc TestD(t *testing.T) { helper() }\n",
+			obj:  "helper",
+			refs: []ref{{"d/d_test.go", 5, true}, {"d/d_test.go", 7, false}},
+		},
+		{
+			name: "unsaved local var",
+			fn:   "ex/a/a.go",
+			src:  "package a\n\ntype T struct{ N int }\n\nfunc New(n int) T {\n\tvar lo‸cal int\n\tlocal = n\n\n\treturn T{N: local}\n}\n",
+			obj:  "local",
+			refs: []ref{{"a/a.go", 6, true}, {"a/a.go", 7, false}, {"a/a.go", 9, false}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := newCtx(c.fn, c.src)
+			defer mx.Cancel()
+
+			refs, obj, err := findReferences(mx)
+			if err != nil {
+				t.Fatalf("findReferences() failed: %s", err)
+			}
+			if obj.Name() != c.obj {
+				t.Errorf("expected object `%s`, got `%s`", c.obj, obj.Name())
+			}
+			if len(refs) != len(c.refs) {
+				t.Fatalf("expected %d references, got %d: %#v", len(c.refs), len(refs), refs)
+			}
+			for i, r := range refs {
+				exp := c.refs[i]
+				fn := filepath.ToSlash(r.Pos.Filename)
+				if !strings.HasSuffix(fn, "/"+exp.fn) || r.Pos.Line != exp.line || r.Def != exp.def {
+					t.Errorf("reference %d: expected %s:%d (def=%v), got %s:%d (def=%v)", i, exp.fn, exp.line, exp.def, fn, r.Pos.Line, r.Def)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchRoot(t *testing.T) {
+	gopath, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"example.com/owner/repo/a/a.go": "package a\n",
+		"example.com/owner/git/b/b.go":  "package b\n",
+		"ex/c/c.go":                     "package c\n",
+	})
+	defer cleanup()
+	os.MkdirAll(filepath.Join(gopath, "src", "example.com", "owner", "git", ".git"), 0755)
+
+	cases := []struct{ fn, root string }{
+		{"example.com/owner/repo/a/a.go", "example.com/owner/repo"},
+		{"example.com/owner/git/b/b.go", "example.com/owner/git"},
+		{"ex/c/c.go", "ex"},
+	}
+	for _, c := range cases {
+		mx := newCtx(c.fn, "")
+		want := filepath.Join(gopath, "src", filepath.FromSlash(c.root))
+		if got := searchRoot(mx, mx.View.Dir()); got != want {
+			t.Errorf("searchRoot(%s) = %s, expected %s", c.fn, got, want)
+		}
+		mx.Cancel()
+	}
+}
@@ -0,0 +1,482 @@
+package golang
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type renameAct struct {
+	mg.ActionType
+	fn   string
+	hash string
+	src  []byte
+	// applied receives true if the view was updated
+	applied chan bool
+}
+
+type renameIssueKey struct{}
+
+// renameViewTimeout is how long to wait for the view to be updated before giving up
+const renameViewTimeout = 5 * time.Second
+
+// Rename adds the builtin command `go.rename <newName>`
+// that renames the identifier under the cursor, and all references to it.
+//
+// The packages searched are the same as for References.
+// The rename is rejected if it would change the meaning of the program e.g.
+// if the new name would shadow, or be shadowed by another declaration,
+// if a type would no longer implement an interface, or if an exported name that's
+// used in other packages would become unexported. Conflicts are reported as issues.
+//
+// The current view is updated in the editor first, all other files are then written to disk.
+// If the view changed in the meantime, the rename is aborted.
+type Rename struct {
+	mg.ReducerType
+}
+
+func (r *Rename) RCond(mx *mg.Ctx) bool {
+	// renameAct must always be answered, even if another view became active
+	return mx.LangIs(mg.Go) || mx.ActionIs(renameAct{})
+}
+
+func (r *Rename) Reduce(mx *mg.Ctx) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(mg.UserCmd{
+			Title:   "Rename",
+			Name:    "go.rename",
+			Desc:    "rename the identifier under the cursor and all references to it",
+			Args:    []string{"{{index .Prompts 0}}"},
+			Prompts: []string{"New name"},
+		})
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "go.rename",
+			Desc: "Rename the identifier under the cursor and all references to it e.g. `go.rename newName`",
+			Run:  r.runRename,
+		})
+	case renameAct:
+		v := mx.View
+		ok := v.Filename() == act.fn && v.Hash == act.hash
+		select {
+		case act.applied <- ok:
+		default:
+		}
+		if ok {
+			return mx.SetViewSrc(act.src)
+		}
+	}
+	return mx.State
+}
+
+func (r *Rename) runRename(cx *mg.CmdCtx) *mg.State {
+	if len(cx.Args) != 1 {
+		defer cx.Output.Close()
+		fmt.Fprintln(cx.Output, "usage: go.rename <newName>")
+		return cx.State
+	}
+	go r.rename(cx, cx.Args[0])
+	return cx.State
+}
+
+func (r *Rename) rename(cx *mg.CmdCtx, newName string) {
+	defer cx.Output.Close()
+	defer cx.Begin(mg.Task{Title: "Go/Rename", ShowNow: true}).Done()
+
+	var issues []mg.Issue
+	defer func() {
+		cx.Store.Dispatch(mg.StoreIssues{
+			IssueKey: mg.IssueKey{Key: renameIssueKey{}},
+			Issues:   issues,
+		})
+	}()
+
+	rn, err := planRename(cx.Ctx, newName)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
+		issues = []mg.Issue{{
+			Path:    cx.View.Path,
+			Name:    cx.View.Name,
+			Row:     cx.View.Row,
+			Col:     cx.View.Col,
+			Label:   "Go/Rename",
+			Tag:     mg.Error,
+			Message: err.Error(),
+		}}
+		return
+	}
+	if len(rn.conflicts) != 0 {
+		for _, c := range rn.conflicts {
+			fmt.Fprintf(cx.Output, "%s:%d:%d: %s\n", mgutil.ShortFn(c.Path, cx.Env), c.Row+1, c.Col+1, c.Message)
+		}
+		fmt.Fprintf(cx.Output, "cannot rename `%s` to `%s`: %d conflicts\n", rn.oldName, newName, len(rn.conflicts))
+		issues = rn.conflicts
+		return
+	}
+
+	// compute all the edits first, so nothing is changed if any of them fail
+	files := rn.files()
+	srcs := make([][]byte, len(files))
+	for i, fn := range files {
+		src, err := rn.apply(fn)
+		if err != nil {
+			fmt.Fprintf(cx.Output, "cannot update %s: %s\n", mgutil.ShortFn(fn, cx.Env), err)
+			fmt.Fprintf(cx.Output, "cannot rename `%s` to `%s`: no files were changed\n", rn.oldName, newName)
+			return
+		}
+		srcs[i] = src
+	}
+
+	// the view is updated first because it's the only edit that can be rejected
+	v := cx.View
+	for i, fn := range files {
+		if fn != v.Filename() {
+			continue
+		}
+		act := renameAct{fn: fn, hash: v.Hash, src: srcs[i], applied: make(chan bool, 1)}
+		cx.Store.Dispatch(act)
+		applied := false
+		select {
+		case applied = <-act.applied:
+		case <-time.After(renameViewTimeout):
+		}
+		if !applied {
+			fmt.Fprintf(cx.Output, "cannot rename `%s` to `%s`: %s changed, no files were changed\n", rn.oldName, newName, v.Name)
+			return
+		}
+		fmt.Fprintf(cx.Output, "%s: %d references\n", mgutil.ShortFn(fn, cx.Env), len(rn.edits[fn]))
+	}
+	failed := 0
+	for i, fn := range files {
+		if fn == v.Filename() {
+			continue
+		}
+		if err := writeFileMode(fn, srcs[i]); err != nil {
+			fmt.Fprintf(cx.Output, "cannot write %s: %s\n", mgutil.ShortFn(fn, cx.Env), err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(cx.Output, "%s: %d references\n", mgutil.ShortFn(fn, cx.Env), len(rn.edits[fn]))
+	}
+	if failed != 0 {
+		fmt.Fprintf(cx.Output, "renamed `%s` to `%s` partially: %d files could not be written\n", rn.oldName, newName, failed)
+		return
+	}
+	fmt.Fprintf(cx.Output, "renamed `%s` to `%s`\n", rn.oldName, newName)
+}
+
+// writeFileMode writes src to the existing file fn, keeping its permissions
+func writeFileMode(fn string, src []byte) error {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, src, fi.Mode())
+}
+
+// renamePlan is the list of edits needed to rename an object
+type renamePlan struct {
+	rs      *refSearch
+	oldName string
+	newName string
+	// objs is the object being renamed, and the embedded fields that are implicitly renamed with it
+	objs []types.Object
+	// edits is the list of offsets of the references in each file
+	edits     map[string][]int
+	conflicts []mg.Issue
+}
+
+// planRename finds all references to the object under the cursor and checks if it can be renamed to newName
+func planRename(mx *mg.Ctx, newName string) (*renamePlan, error) {
+	if !token.IsIdentifier(newName) || newName == "_" {
+		return nil, fmt.Errorf("`%s` is not a valid identifier", newName)
+	}
+	rs, err := newRefSearch(mx)
+	if err != nil {
+		return nil, err
+	}
+	obj := rs.obj
+	rn := &renamePlan{
+		rs:      rs,
+		oldName: obj.Name(),
+		newName: newName,
+		objs:    []types.Object{obj},
+		edits:   map[string][]int{},
+	}
+	switch x := obj.(type) {
+	case *types.PkgName:
+		return nil, fmt.Errorf("renaming imports is not supported")
+	case *types.Label:
+		return nil, fmt.Errorf("renaming labels is not supported")
+	case *types.Var:
+		if x.Embedded() {
+			return nil, fmt.Errorf("`%s` is an embedded field, rename its type instead", x.Name())
+		}
+	case *types.Func:
+		if obj.Parent() == obj.Pkg().Scope() && (obj.Name() == "main" || obj.Name() == "init") {
+			return nil, fmt.Errorf("cannot rename the special function `%s`", obj.Name())
+		}
+	}
+	if obj.Name() == newName {
+		return nil, fmt.Errorf("`%s` is already named `%s`", obj.Name(), newName)
+	}
+	if dir := rs.sc.pkgDir(obj.Pkg()); mx.View.Path != "" && !isLocalObj(obj) {
+		root := searchRoot(mx, mx.View.Dir())
+		if !mgutil.IsParentDir(root, dir) && root != dir {
+			return nil, fmt.Errorf("cannot rename `%s`, it's declared outside of %s", obj.Name(), mgutil.ShortFn(root, mx.Env))
+		}
+	}
+	if tn, ok := obj.(*types.TypeName); ok {
+		rn.objs = append(rn.objs, rn.embeddedFields(tn)...)
+	}
+
+	for _, ref := range rs.refs(rn.objs...) {
+		rn.edits[ref.Pos.Filename] = append(rn.edits[ref.Pos.Filename], ref.Pos.Offset)
+	}
+	rn.checkConflicts()
+	return rn, nil
+}
+
+// embeddedFields returns the list of fields in which tn is embedded
+func (rn *renamePlan) embeddedFields(tn *types.TypeName) []types.Object {
+	l := []types.Object{}
+	for _, p := range rn.rs.pkgs {
+		for id, o := range p.Info.Defs {
+			if v, ok := o.(*types.Var); ok && v.Embedded() && p.Info.Uses[id] == tn {
+				l = append(l, v)
+			}
+		}
+	}
+	return l
+}
+
+// files returns the sorted list of files to edit
+func (rn *renamePlan) files() []string {
+	l := make([]string, 0, len(rn.edits))
+	for fn := range rn.edits {
+		l = append(l, fn)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// apply returns the src of fn after replacing all references with the new name
+func (rn *renamePlan) apply(fn string) ([]byte, error) {
+	src, err := rn.rs.sc.readFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	offsets := append([]int(nil), rn.edits[fn]...)
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	s := append([]byte(nil), src...)
+	for _, i := range offsets {
+		j := i + len(rn.oldName)
+		if j > len(s) || string(s[i:j]) != rn.oldName {
+			return nil, fmt.Errorf("offset %d is not a reference to `%s`", i, rn.oldName)
+		}
+		s = append(s[:i], append([]byte(rn.newName), s[j:]...)...)
+	}
+	return s, nil
+}
+
+func (rn *renamePlan) conflict(pos token.Pos, format string, a ...interface{}) {
+	tp := rn.rs.sc.fset.Position(pos)
+	isu := mg.Issue{
+		Path:    tp.Filename,
+		Row:     tp.Line - 1,
+		Col:     tp.Column - 1,
+		Label:   "Go/Rename",
+		Tag:     mg.Error,
+		Message: fmt.Sprintf(format, a...),
+	}
+	if v := rn.rs.sc.mx.View; v.Path == "" && tp.Filename == v.Filename() {
+		isu.Path = ""
+		isu.Name = v.Name
+	}
+	rn.conflicts = append(rn.conflicts, isu)
+}
+
+// posStr returns the position of obj, relative to the dir of the current view where possible
+func (rn *renamePlan) posStr(obj types.Object) string {
+	if !obj.Pos().IsValid() {
+		return "in the universe scope"
+	}
+	tp := rn.rs.sc.fset.Position(obj.Pos())
+	fn := tp.Filename
+	if s, err := filepath.Rel(rn.rs.sc.mx.View.Dir(), fn); err == nil && !strings.HasPrefix(s, "..") {
+		fn = s
+	}
+	return fmt.Sprintf("at %s:%d:%d", fn, tp.Line, tp.Column)
+}
+
+func (rn *renamePlan) checkConflicts() {
+	obj := rn.rs.obj
+	if isFieldOrMethod(obj) {
+		rn.checkSelections()
+		rn.checkInterfaces()
+	} else {
+		rn.checkScopes()
+	}
+	rn.checkExported()
+}
+
+// isFieldOrMethod returns true if obj is a struct field or a method
+func isFieldOrMethod(obj types.Object) bool {
+	switch x := obj.(type) {
+	case *types.Var:
+		return x.IsField()
+	case *types.Func:
+		return x.Type().(*types.Signature).Recv() != nil
+	}
+	return false
+}
+
+// checkScopes checks that the new name doesn't conflict with other declarations in the lexical scopes
+func (rn *renamePlan) checkScopes() {
+	obj := rn.rs.obj
+	declScope := obj.Parent()
+	if o := declScope.Lookup(rn.newName); o != nil {
+		rn.conflict(obj.Pos(), "`%s` is already declared in this block %s", rn.newName, rn.posStr(o))
+		return
+	}
+	for _, p := range rn.rs.pkgs {
+		if p.Pkg != obj.Pkg() {
+			// other packages refer to it through a qualified identifier
+			continue
+		}
+		if declScope == p.Pkg.Scope() {
+			for _, af := range p.Files {
+				if o := p.Info.Scopes[af].Lookup(rn.newName); o != nil {
+					rn.conflict(o.Pos(), "renaming `%s` to `%s` conflicts with this import", rn.oldName, rn.newName)
+				}
+			}
+		}
+		for id, o := range p.Info.Uses {
+			scope := p.Pkg.Scope().Innermost(id.Pos())
+			if scope == nil {
+				continue
+			}
+			switch {
+			case o == obj:
+				// the new name must not be shadowed at any of the references
+				_, x := scope.LookupParent(rn.newName, id.Pos())
+				if x != nil && x != obj && scopeWithin(x.Parent(), declScope) {
+					rn.conflict(id.Pos(), "`%s` would be shadowed by the declaration of `%s` %s", rn.oldName, rn.newName, rn.posStr(x))
+				}
+			case o.Name() == rn.newName && !isFieldOrMethod(o) && o.Parent() != nil:
+				// references to an outer declaration of the new name must not become references to obj
+				if scopeWithin(scope, declScope) && o.Parent() != declScope && scopeWithin(declScope, o.Parent()) &&
+					(declScope == p.Pkg.Scope() || obj.Pos() < id.Pos()) {
+					rn.conflict(id.Pos(), "this reference to `%s` %s would refer to the renamed `%s`", rn.newName, rn.posStr(o), rn.oldName)
+				}
+			}
+		}
+	}
+}
+
+// scopeWithin returns true if s is the same scope as, or nested within outer
+func scopeWithin(s, outer *types.Scope) bool {
+	for ; s != nil; s = s.Parent() {
+		if s == outer {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSelections checks that the new field or method name doesn't conflict
+// with other fields or methods of the types through which it's selected
+func (rn *renamePlan) checkSelections() {
+	obj := rn.rs.obj
+	if owner := objOwner(obj); owner != nil {
+		if o, _, _ := types.LookupFieldOrMethod(owner.Type(), true, obj.Pkg(), rn.newName); o != nil {
+			rn.conflict(obj.Pos(), "`%s` already has a field or method named `%s` %s", owner.Name(), rn.newName, rn.posStr(o))
+			return
+		}
+	}
+	for _, p := range rn.rs.pkgs {
+		for sel, s := range p.Info.Selections {
+			if s.Obj() != obj {
+				continue
+			}
+			if o, _, _ := types.LookupFieldOrMethod(s.Recv(), true, p.Pkg, rn.newName); o != nil {
+				rn.conflict(sel.Sel.Pos(), "`%s` would refer to the field or method `%s` %s", rn.newName, rn.newName, rn.posStr(o))
+			}
+		}
+	}
+}
+
+// checkInterfaces checks that renaming a method doesn't change which interfaces are implemented
+func (rn *renamePlan) checkInterfaces() {
+	fn, ok := rn.rs.obj.(*types.Func)
+	if !ok {
+		return
+	}
+	pkgs := make([]*types.Package, len(rn.rs.pkgs))
+	for i, p := range rn.rs.pkgs {
+		pkgs[i] = p.Pkg
+	}
+	// types that implement the interface can be declared in any of the packages' dependencies
+	named := pkgTypeNames(pkgs, true)
+	recv := fn.Type().(*types.Signature).Recv().Type()
+	if p, ok := recv.(*types.Pointer); ok {
+		recv = p.Elem()
+	}
+	if iface, ok := recv.Underlying().(*types.Interface); ok {
+		// renaming an interface method: no type that implements it must exist
+		for _, tn := range named {
+			t := tn.Type()
+			if types.IsInterface(t) || t == recv {
+				continue
+			}
+			if types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface) {
+				rn.conflict(fn.Pos(), "`%s` implements `%s`, its method `%s` would need to be renamed as well", tn.Name(), rn.ifaceName(recv), fn.Name())
+			}
+		}
+		return
+	}
+	for _, tn := range named {
+		iface, ok := tn.Type().Underlying().(*types.Interface)
+		if !ok || iface.NumMethods() == 0 {
+			continue
+		}
+		if o, _, _ := types.LookupFieldOrMethod(iface, false, tn.Pkg(), fn.Name()); o == nil {
+			continue
+		}
+		if types.Implements(recv, iface) || types.Implements(types.NewPointer(recv), iface) {
+			rn.conflict(fn.Pos(), "renaming `%s` would stop `%s` from implementing `%s`", fn.Name(), rn.ifaceName(recv), tn.Pkg().Name()+"."+tn.Name())
+		}
+	}
+}
+
+func (rn *renamePlan) ifaceName(t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(rn.rs.obj.Pkg()))
+}
+
+// checkExported checks that exported names that are used in other packages remain exported
+func (rn *renamePlan) checkExported() {
+	obj := rn.rs.obj
+	if !obj.Exported() || ast.IsExported(rn.newName) {
+		return
+	}
+	for _, p := range rn.rs.pkgs {
+		if p.Pkg == obj.Pkg() {
+			continue
+		}
+		for id, o := range p.Info.Uses {
+			if o == obj {
+				rn.conflict(id.Pos(), "`%s` would be unexported, but it's used in package `%s`", rn.newName, p.Pkg.Name())
+			}
+		}
+	}
+}
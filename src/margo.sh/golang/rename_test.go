@@ -0,0 +1,172 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanRename(t *testing.T) {
+	gopath, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": renameTestSrc,
+		"ex/b/b.go": `package b
+
+import "ex/a"
+
+type E struct{ a.T }
+
+var X = a.New(2).Get() + E{}.T.N
+`,
+		"ex/c/c.go": `package c
+
+import "ex/b"
+
+func F() { b.E{}.Set(1) }
+`,
+	})
+	defer cleanup()
+
+	cases := []struct {
+		name      string
+		fn        string
+		src       string
+		newName   string
+		conflicts []string
+		files     map[string]string
+	}{
+		{
+			name:    "exported func",
+			fn:      "ex/b/b.go",
+			src:     "package b\n\nimport \"ex/a\"\n\ntype E struct{ a.T }\n\nvar X = a.Ne‸w(2).Get() + E{}.T.N\n",
+			newName: "Make",
+			files: map[string]string{
+				"ex/a/a.go": "func Make(n int) T {",
+				"ex/b/b.go": "var X = a.Make(2).Get() + E{}.T.N",
+			},
+		},
+		{
+			name:    "embedded type",
+			fn:      "ex/a/a.go",
+			src:     strings.Replace(renameTestSrc, "type T ", "type T‸ ", 1),
+			newName: "U",
+			files: map[string]string{
+				"ex/b/b.go": "var X = a.New(2).Get() + E{}.U.N",
+			},
+		},
+		{
+			name:    "promoted method",
+			fn:      "ex/a/a.go",
+			src:     strings.Replace(renameTestSrc, "func (t T) Set", "func (t T) S‸et", 1),
+			newName: "Put",
+			files: map[string]string{
+				"ex/a/a.go": "func (t T) Put(n int)",
+				"ex/c/c.go": "func F() { b.E{}.Put(1) }",
+			},
+		},
+		{
+			name:      "unexported",
+			fn:        "ex/a/a.go",
+			src:       strings.Replace(renameTestSrc, "func New", "func N‸ew", 1),
+			newName:   "newT",
+			conflicts: []string{"would be unexported"},
+		},
+		{
+			name:      "interface",
+			fn:        "ex/a/a.go",
+			src:       strings.Replace(renameTestSrc, "func (t T) Get", "func (t T) G‸et", 1),
+			newName:   "Value",
+			conflicts: []string{"would stop `T` from implementing `a.Getter`"},
+		},
+		{
+			name:      "field or method",
+			fn:        "ex/a/a.go",
+			src:       strings.Replace(renameTestSrc, "func (t T) Set", "func (t T) S‸et", 1),
+			newName:   "N",
+			conflicts: []string{"already has a field or method named `N`"},
+		},
+		{
+			name:      "same block",
+			fn:        "ex/a/a.go",
+			src:       strings.Replace(renameTestSrc, "var local", "var lo‸cal", 1),
+			newName:   "n",
+			conflicts: []string{"already declared in this block"},
+		},
+		{
+			name:      "shadowing",
+			fn:        "ex/a/a.go",
+			src:       strings.Replace(renameTestSrc, "var local", "var lo‸cal", 1),
+			newName:   "T",
+			conflicts: []string{"would refer to the renamed `local`"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := newCtx(c.fn, c.src)
+			defer mx.Cancel()
+
+			rn, err := planRename(mx, c.newName)
+			if err != nil {
+				t.Fatalf("planRename() failed: %s", err)
+			}
+			if len(rn.conflicts) != len(c.conflicts) {
+				t.Fatalf("expected %d conflicts, got %d: %v", len(c.conflicts), len(rn.conflicts), rn.conflicts)
+			}
+			for i, isu := range rn.conflicts {
+				if !strings.Contains(isu.Message, c.conflicts[i]) {
+					t.Errorf("expected conflict %d to contain %q, got %q", i, c.conflicts[i], isu.Message)
+				}
+			}
+			for fn, exp := range c.files {
+				src, err := rn.apply(filepath.Join(gopath, "src", filepath.FromSlash(fn)))
+				if err != nil {
+					t.Fatalf("apply(%s) failed: %s", fn, err)
+				}
+				if !strings.Contains(string(src), exp) {
+					t.Errorf("expected %s to contain %q, got:\n%s", fn, exp, src)
+				}
+			}
+		})
+	}
+
+	if _, err := planRename(newCtx("ex/a/a.go", strings.Replace(renameTestSrc, "func New", "func N‸ew", 1)), "1x"); err == nil {
+		t.Errorf("planRename() accepted an invalid identifier")
+	}
+}
+
+const renameTestSrc = `package a
+
+type Getter interface{ Get() int }
+
+type T struct{ N int }
+
+func (t T) Get() int { return t.N }
+
+func (t T) Set(n int) { t.N = n }
+
+func New(n int) T {
+	var local int
+	local = n
+	return T{N: local}
+}
+`
+
+func TestRenameActStaleView(t *testing.T) {
+	mx := mg.NewTestingCtx(nil)
+	defer mx.Cancel()
+	mx = mx.SetState(mx.State.SetView(mx.View.Copy(func(v *mg.View) {
+		v.Path = "/tmp/a.go"
+		v.Hash = "new"
+	})))
+
+	for _, c := range []struct {
+		hash    string
+		applied bool
+	}{{"old", false}, {"new", true}} {
+		act := renameAct{fn: "/tmp/a.go", hash: c.hash, src: []byte("package a\n"), applied: make(chan bool, 1)}
+		(&Rename{}).Reduce(mx.Copy(func(mx *mg.Ctx) { mx.Action = act }))
+		if applied := <-act.applied; applied != c.applied {
+			t.Errorf("renameAct with hash %q: expected applied=%v, got %v", c.hash, c.applied, applied)
+		}
+	}
+}
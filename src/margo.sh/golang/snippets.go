@@ -10,7 +10,7 @@ import (
 )
 
 var (
-	Snippets = SnippetFuncs(append([]snippets.SnippetFunc{ImportPathSnippet}, snippets.DefaultSnippets...)...)
+	Snippets = SnippetFuncs(append([]snippets.SnippetFunc{ImportPathSnippet, StructTagSnippet}, snippets.DefaultSnippets...)...)
 )
 
 // SnippetFunc is an alias of snippets.SnippetFunc
@@ -0,0 +1,446 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"margo.sh/mg"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// StructTagKeys is the list of tag keys suggested when completing inside a struct tag
+	StructTagKeys = []string{"json", "yaml", "xml", "toml", "db", "bson", "mapstructure"}
+)
+
+type structTagsAct struct {
+	mg.ActionType
+	fn   string
+	hash string
+	src  []byte
+}
+
+// StructTags adds the builtin command `go.tags` that manages the tags of the fields
+// of the struct under the cursor. If some fields are selected, only those fields are changed.
+//
+//	go.tags add [-transform snake|camel|kebab] [-omitempty] [keys...]
+//	  adds the keys (default json) to each exported field, named after the field.
+//	  existing keys keep their name, -omitempty is added to them if requested.
+//	  fields that declare several names e.g. `A, B int` are split into one field per name.
+//	go.tags remove keys...
+//	  removes the keys from each field.
+//	go.tags clear
+//	  removes the tags from each field.
+type StructTags struct {
+	mg.ReducerType
+
+	// Transform is the naming transform used if the -transform flag is not set.
+	// It's one of snake, camel or kebab. The default is snake.
+	Transform string
+}
+
+func (stg *StructTags) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (stg *StructTags) Reduce(mx *mg.Ctx) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(
+			mg.UserCmd{
+				Title:   "Add Struct Tags",
+				Name:    "go.tags",
+				Desc:    "add tags to the fields of the struct under the cursor",
+				Args:    []string{"add", "{{index .Prompts 0}}"},
+				Prompts: []string{"Tag keys"},
+			},
+			mg.UserCmd{
+				Title:   "Remove Struct Tags",
+				Name:    "go.tags",
+				Desc:    "remove tags from the fields of the struct under the cursor",
+				Args:    []string{"remove", "{{index .Prompts 0}}"},
+				Prompts: []string{"Tag keys"},
+			},
+			mg.UserCmd{
+				Title: "Clear Struct Tags",
+				Name:  "go.tags",
+				Desc:  "remove all tags from the fields of the struct under the cursor",
+				Args:  []string{"clear"},
+			},
+		)
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "go.tags",
+			Desc: "Manage the tags of the struct under the cursor. Usage: go.tags add|remove|clear [-transform snake|camel|kebab] [-omitempty] [keys...]",
+			Run:  stg.runTags,
+		})
+	case structTagsAct:
+		v := mx.View
+		if v.Filename() == act.fn && v.Hash == act.hash {
+			return mx.SetViewSrc(act.src)
+		}
+	}
+	return mx.State
+}
+
+func (stg *StructTags) runTags(cx *mg.CmdCtx) *mg.State {
+	defer cx.Output.Close()
+
+	if len(cx.Args) == 0 {
+		fmt.Fprintln(cx.Output, "usage: go.tags add|remove|clear [-transform snake|camel|kebab] [-omitempty] [keys...]")
+		return cx.State
+	}
+	op := structTagsOp{Cmd: cx.Args[0]}
+	rc := cx.RunCmd
+	rc.Args = cx.Args[1:]
+	fs := rc.Flags()
+	fs.SetOutput(cx.Output)
+	fs.StringVar(&op.Transform, "transform", stg.Transform, "the naming transform: snake, camel or kebab")
+	fs.BoolVar(&op.OmitEmpty, "omitempty", false, "add the omitempty option")
+	if err := fs.Parse(); err != nil {
+		return cx.State
+	}
+	// the prompt might contain a list of keys
+	for _, s := range fs.Args() {
+		op.Keys = append(op.Keys, strings.FieldsFunc(s, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+
+	src, err := op.apply(NewViewCursorCtx(cx.Ctx))
+	if err != nil {
+		fmt.Fprintln(cx.Output, "Error:", err)
+		return cx.State
+	}
+	v := cx.View
+	cx.Store.Dispatch(structTagsAct{fn: v.Filename(), hash: v.Hash, src: src})
+	return cx.State
+}
+
+// structTagsOp is a change to the tags of the fields of a struct
+type structTagsOp struct {
+	// Cmd is one of add, remove or clear
+	Cmd       string
+	Keys      []string
+	Transform string
+	OmitEmpty bool
+}
+
+// apply returns the view's src with the tags of the struct under the cursor, or the selected fields updated
+func (op structTagsOp) apply(cx *CursorCtx) ([]byte, error) {
+	switch op.Cmd {
+	case "add":
+		if len(op.Keys) == 0 {
+			op.Keys = []string{"json"}
+		}
+		if _, err := tagName(op.Transform, "X"); err != nil {
+			return nil, err
+		}
+	case "remove":
+		if len(op.Keys) == 0 {
+			return nil, fmt.Errorf("no tag keys to remove")
+		}
+	case "clear":
+	default:
+		return nil, fmt.Errorf("unknown command `%s`, expected add, remove or clear", op.Cmd)
+	}
+
+	src, start, end := cx.View.SrcSel()
+	if !bytes.Equal(src, cx.Src) || cx.AstFile == nil {
+		return nil, fmt.Errorf("cannot parse %s", cx.View.Basename())
+	}
+	var st *ast.StructType
+	if !cx.Set(&st) {
+		var ts *ast.TypeSpec
+		if cx.Set(&ts) {
+			st, _ = ts.Type.(*ast.StructType)
+		}
+	}
+	if st == nil {
+		return nil, fmt.Errorf("the cursor is not in a struct type")
+	}
+
+	type edit struct {
+		start, end int
+		s          string
+	}
+	var edits []edit
+	tf := cx.TokenFile
+	for _, f := range st.Fields.List {
+		fstart, fend := tf.Offset(f.Pos()), tf.Offset(f.End())
+		if start != end && (fend <= start || fstart >= end) {
+			// it's not selected
+			continue
+		}
+		name := recvTypeName(f.Type)
+		if len(f.Names) != 0 {
+			name = f.Names[0].Name
+		}
+		tag := structTag{}
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err == nil {
+				tag, err = parseStructTag(s)
+			}
+			if err != nil && op.Cmd != "clear" {
+				return nil, fmt.Errorf("cannot parse the tag of `%s`: %s", name, err)
+			}
+		}
+		if op.Cmd == "add" && len(f.Names) > 1 {
+			// each name needs its own tag, so the field is split into one field per name
+			end := f.Type.End()
+			if f.Tag != nil {
+				end = f.Tag.End()
+			}
+			edits = append(edits, edit{fstart, tf.Offset(end), op.splitField(src, tf, f, tag)})
+			continue
+		}
+		switch op.Cmd {
+		case "add":
+			if !ast.IsExported(name) {
+				continue
+			}
+			nm, _ := tagName(op.Transform, name)
+			for _, k := range op.Keys {
+				tag = tag.add(k, nm, op.OmitEmpty)
+			}
+		case "remove":
+			tag = tag.remove(op.Keys...)
+		case "clear":
+			tag = nil
+		}
+
+		s := tag.String()
+		switch {
+		case f.Tag != nil && s == "":
+			// remove the space before the tag as well
+			edits = append(edits, edit{tf.Offset(f.Type.End()), tf.Offset(f.Tag.End()), ""})
+		case f.Tag != nil:
+			edits = append(edits, edit{tf.Offset(f.Tag.Pos()), tf.Offset(f.Tag.End()), quoteStructTag(s)})
+		case s != "":
+			at := tf.Offset(f.Type.End())
+			edits = append(edits, edit{at, at, " " + quoteStructTag(s)})
+		}
+	}
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("no fields were changed")
+	}
+
+	buf := &bytes.Buffer{}
+	pos := 0
+	for _, e := range edits {
+		buf.Write(src[pos:e.start])
+		buf.WriteString(e.s)
+		pos = e.end
+	}
+	buf.Write(src[pos:])
+	return gofmtImports(cx.View.Filename(), buf.Bytes(), nil)
+}
+
+// splitField returns the declarations of the names in the multi-name field f, one per line,
+// with tag and the keys in op added to the tag of each exported name
+func (op structTagsOp) splitField(src []byte, tf *token.File, f *ast.Field, tag structTag) string {
+	typ := string(src[tf.Offset(f.Type.Pos()):tf.Offset(f.Type.End())])
+	lines := make([]string, len(f.Names))
+	for i, id := range f.Names {
+		t := tag
+		if ast.IsExported(id.Name) {
+			nm, _ := tagName(op.Transform, id.Name)
+			for _, k := range op.Keys {
+				t = t.add(k, nm, op.OmitEmpty)
+			}
+		}
+		lines[i] = id.Name + " " + typ
+		if s := t.String(); s != "" {
+			lines[i] += " " + quoteStructTag(s)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// structTagEnt is a key and its value in a struct tag
+type structTagEnt struct {
+	Key   string
+	Value string
+}
+
+// structTag is the list of keys in a struct tag, in the order they appear
+type structTag []structTagEnt
+
+// parseStructTag parses the conventional format of struct tags i.e. `key:"value" key2:"value2"`
+func parseStructTag(s string) (structTag, error) {
+	var tag structTag
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return tag, nil
+		}
+		i := strings.Index(s, `:"`)
+		if i <= 0 || strings.ContainsAny(s[:i], " \"") {
+			return tag, fmt.Errorf("malformed key in `%s`", s)
+		}
+		key := s[:i]
+		s = s[i+1:]
+		j := 1
+		for j < len(s) && s[j] != '"' {
+			if s[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(s) {
+			return tag, fmt.Errorf("unterminated value of `%s`", key)
+		}
+		val, err := strconv.Unquote(s[:j+1])
+		if err != nil {
+			return tag, fmt.Errorf("malformed value of `%s`: %s", key, err)
+		}
+		tag = append(tag, structTagEnt{Key: key, Value: val})
+		s = s[j+1:]
+	}
+}
+
+// add returns a copy of tag with key set to name.
+// If the key is already set, its value is kept and only the omitempty option is added.
+func (tag structTag) add(key, name string, omitEmpty bool) structTag {
+	l := append(structTag{}, tag...)
+	for i, e := range l {
+		if e.Key != key {
+			continue
+		}
+		// `-` means the field is ignored
+		if omitEmpty && e.Value != "-" && !strings.Contains(","+e.Value+",", ",omitempty,") {
+			l[i].Value += ",omitempty"
+		}
+		return l
+	}
+	if omitEmpty {
+		name += ",omitempty"
+	}
+	return append(l, structTagEnt{Key: key, Value: name})
+}
+
+// remove returns a copy of tag without the keys
+func (tag structTag) remove(keys ...string) structTag {
+	var l structTag
+	for _, e := range tag {
+		found := false
+		for _, k := range keys {
+			if e.Key == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+func (tag structTag) String() string {
+	l := make([]string, len(tag))
+	for i, e := range tag {
+		l[i] = e.Key + ":" + strconv.Quote(e.Value)
+	}
+	return strings.Join(l, " ")
+}
+
+// quoteStructTag returns s as a raw string literal if possible
+func quoteStructTag(s string) string {
+	if strings.ContainsAny(s, "`\r") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// tagName returns the name of the field name, as transformed by transform
+func tagName(transform, name string) (string, error) {
+	words := splitWords(name)
+	switch transform {
+	case "", "snake":
+		return strings.ToLower(strings.Join(words, "_")), nil
+	case "kebab":
+		return strings.ToLower(strings.Join(words, "-")), nil
+	case "camel":
+		if len(words) == 0 {
+			return "", nil
+		}
+		words[0] = strings.ToLower(words[0])
+		return strings.Join(words, ""), nil
+	default:
+		return "", fmt.Errorf("unknown transform `%s`, expected snake, camel or kebab", transform)
+	}
+}
+
+// splitWords splits the identifier s into words e.g. `HTTPServerID` -> `HTTP Server ID`
+func splitWords(s string) []string {
+	var words []string
+	rs := []rune(s)
+	start := 0
+	add := func(end int) {
+		if w := strings.Trim(string(rs[start:end]), "_"); w != "" {
+			words = append(words, w)
+		}
+		start = end
+	}
+	for i := 1; i < len(rs); i++ {
+		p, c := rs[i-1], rs[i]
+		switch {
+		case c == '_':
+			add(i)
+		case unicode.IsUpper(c) && (unicode.IsLower(p) || unicode.IsDigit(p)):
+			add(i)
+		case unicode.IsUpper(c) && unicode.IsUpper(p) && i+1 < len(rs) && unicode.IsLower(rs[i+1]):
+			add(i)
+		}
+	}
+	add(len(rs))
+	return words
+}
+
+// StructTagSnippet returns completions for the keys missing from the struct tag under the cursor
+func StructTagSnippet(cx *CompletionCtx) []mg.Completion {
+	lit, ok := cx.Node.(*ast.BasicLit)
+	if !ok || !cx.Scope.Is(StructTagScope) || lit.Kind != token.STRING || !strings.HasPrefix(lit.Value, "`") {
+		return nil
+	}
+	var f *ast.Field
+	if !cx.Set(&f) {
+		return nil
+	}
+	name := recvTypeName(f.Type)
+	if len(f.Names) != 0 {
+		name = f.Names[0].Name
+	}
+	tag, _ := strconv.Unquote(lit.Value)
+	present := map[string]bool{}
+	l, _ := parseStructTag(tag)
+	for _, e := range l {
+		present[e.Key] = true
+	}
+
+	nm, _ := tagName("", name)
+	var cl []mg.Completion
+	for _, k := range StructTagKeys {
+		if present[k] {
+			continue
+		}
+		cl = append(cl,
+			mg.Completion{
+				Query: k,
+				Title: k + `:"` + nm + `"`,
+				Src:   k + `:"${1:` + nm + `}"`,
+			},
+			mg.Completion{
+				Query: k,
+				Title: k + `:"` + nm + `,omitempty"`,
+				Src:   k + `:"${1:` + nm + `},omitempty"`,
+			},
+		)
+	}
+	return cl
+}
@@ -0,0 +1,137 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"strings"
+	"testing"
+)
+
+func TestStructTags(t *testing.T) {
+	src := "package a\n\ntype T struct {\n\tUserID   int `json:\"uid\"`\n\tHTTPAddr string\n\tname     string\n\tDB       string `db:\"db\" json:\"-\"`\n}\n"
+	newCx := func(pos, selEnd int) *CursorCtx {
+		mx := mg.NewTestingCtx(nil)
+		mx = mx.Copy(func(mx *mg.Ctx) {
+			mx.State = mx.State.SetView(mx.View.Copy(func(v *mg.View) {
+				v.Name = "a.go"
+				v.Src = []byte(src)
+				v.Pos = pos
+				v.SelStart = pos
+				v.SelEnd = selEnd
+				v.Lang = mg.Go
+			}))
+		})
+		return NewViewCursorCtx(mx)
+	}
+	inStruct := strings.Index(src, "HTTPAddr")
+
+	cases := []struct {
+		name string
+		op   structTagsOp
+		sel  string
+		exp  string
+		err  string
+	}{
+		{
+			name: "add",
+			op:   structTagsOp{Cmd: "add", Keys: []string{"json", "yaml"}, OmitEmpty: true},
+			exp:  "\tUserID   int    `json:\"uid,omitempty\" yaml:\"user_id,omitempty\"`\n\tHTTPAddr string `json:\"http_addr,omitempty\" yaml:\"http_addr,omitempty\"`\n\tname     string\n\tDB       string `db:\"db\" json:\"-\" yaml:\"db,omitempty\"`\n",
+		},
+		{
+			name: "add camel to selection",
+			op:   structTagsOp{Cmd: "add", Keys: []string{"db"}, Transform: "camel"},
+			sel:  "HTTPAddr string",
+			exp:  "\tUserID   int    `json:\"uid\"`\n\tHTTPAddr string `db:\"httpAddr\"`\n\tname     string\n",
+		},
+		{
+			name: "remove",
+			op:   structTagsOp{Cmd: "remove", Keys: []string{"json"}},
+			exp:  "\tUserID   int\n\tHTTPAddr string\n\tname     string\n\tDB       string `db:\"db\"`\n",
+		},
+		{
+			name: "clear",
+			op:   structTagsOp{Cmd: "clear"},
+			exp:  "\tUserID   int\n\tHTTPAddr string\n\tname     string\n\tDB       string\n}",
+		},
+		{
+			name: "bad transform",
+			op:   structTagsOp{Cmd: "add", Transform: "upper"},
+			err:  "unknown transform",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pos, end := inStruct, inStruct
+			if c.sel != "" {
+				pos = strings.Index(src, c.sel)
+				end = pos + len(c.sel)
+			}
+			out, err := c.op.apply(newCx(pos, end))
+			switch {
+			case c.err != "":
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing `%s`, got `%v`", c.err, err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("apply() failed: %s", err)
+			}
+			if !strings.Contains(string(out), c.exp) {
+				t.Errorf("expected result to contain:\n%s\ngot:\n%s", c.exp, out)
+			}
+		})
+	}
+}
+
+func TestStructTagsMultiName(t *testing.T) {
+	src := "package a\n\ntype T struct {\n\tA, b, CD int `db:\"x\"` // comment\n}\n"
+	mx := mg.NewTestingCtx(nil)
+	defer mx.Cancel()
+	mx = mx.SetView(mx.View.Copy(func(v *mg.View) {
+		v.Name = "a.go"
+		v.Src = []byte(src)
+		v.Pos = strings.Index(src, "CD")
+		v.Lang = mg.Go
+	}))
+	out, err := structTagsOp{Cmd: "add", Keys: []string{"json"}}.apply(NewViewCursorCtx(mx))
+	if err != nil {
+		t.Fatalf("apply() failed: %s", err)
+	}
+	exp := "\tA  int `db:\"x\" json:\"a\"`\n\tb  int `db:\"x\"`\n\tCD int `db:\"x\" json:\"cd\"` // comment\n"
+	if !strings.Contains(string(out), exp) {
+		t.Errorf("expected result to contain:\n%s\ngot:\n%s", exp, out)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	cases := map[string]string{
+		"HTTPServerID": "HTTP Server ID",
+		"userName":     "user Name",
+		"Addr2Port":    "Addr2 Port",
+		"snake_case":   "snake case",
+		"X":            "X",
+	}
+	for s, exp := range cases {
+		if got := strings.Join(splitWords(s), " "); got != exp {
+			t.Errorf("splitWords(%q) = %q, expected %q", s, got, exp)
+		}
+	}
+}
+
+func TestStructTagSnippet(t *testing.T) {
+	src := "package a\n\ntype T struct {\n\tUserID int `json:\"uid\" `\n}\n"
+	mx := mg.NewTestingCtx(nil)
+	defer mx.Cancel()
+	cx := NewCompletionCtx(mx, []byte(src), strings.Index(src, "\" `")+2)
+	cl := StructTagSnippet(cx)
+	if len(cl) == 0 {
+		t.Fatalf("expected completions in scope %s", cx.Scope)
+	}
+	for _, c := range cl {
+		if c.Query == "json" {
+			t.Errorf("json is already in the tag, but it was suggested: %#v", c)
+		}
+	}
+	if c := cl[0]; c.Query != "yaml" || c.Title != `yaml:"user_id"` {
+		t.Errorf("unexpected completion %#v", c)
+	}
+}
@@ -0,0 +1,429 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"margo.sh/golang/gopkg"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	// SymbolsLimit is the maximum number of results returned by `.symbols`
+	SymbolsLimit = 50
+)
+
+type symbolsAct struct {
+	mg.ActionType
+	hud htm.Element
+}
+
+// Symbols adds the builtin command `.symbols <query>` that searches for declarations
+// in all packages of the current module (or repository) and the packages they import.
+//
+// The top-level declarations of each package are indexed the first time they're searched,
+// and re-indexed when a file in the package is saved.
+// Results are ranked by how well they match the query, and listed in the HUD as links.
+type Symbols struct {
+	mg.ReducerType
+
+	// Unexported if true, unexported declarations are indexed as well.
+	// It can be enabled for a single search with `.symbols -unexported <query>`
+	Unexported bool
+
+	mu    sync.Mutex
+	dirs  map[string]*symbolsDir
+	roots map[string][]string
+	hud   htm.Element
+}
+
+// goSymbol is a top-level declaration, or a method
+type goSymbol struct {
+	Name string
+	Kind string
+	// Recv is the name of the receiver type of methods
+	Recv string
+	Pos  token.Position
+}
+
+// symbolsDir is the list of symbols declared in a package
+type symbolsDir struct {
+	Dir     string
+	Name    string
+	Path    string
+	Imports []string
+	Syms    []goSymbol
+}
+
+// symbolMatch is a symbol that matched a query
+type symbolMatch struct {
+	goSymbol
+	Pkg   *symbolsDir
+	Score int
+	Local bool
+}
+
+func (sy *Symbols) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (sy *Symbols) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State
+	switch act := mx.Action.(type) {
+	case mg.QueryUserCmds:
+		st = st.AddUserCmds(mg.UserCmd{
+			Title:   "Find Symbols",
+			Name:    ".symbols",
+			Args:    []string{"{{index .Prompts 0}}"},
+			Prompts: []string{"Query"},
+			Desc:    "search the declarations in the current module and its dependencies",
+		})
+	case mg.RunCmd:
+		st = st.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: ".symbols",
+			Desc: "Search the declarations in the current module and its dependencies. Usage: .symbols [-unexported] <query>",
+			Run:  sy.runSymbols,
+		})
+	case mg.ViewSaved:
+		go sy.reindex(mx)
+	case mg.ViewActivated:
+		sy.hud = nil
+	case symbolsAct:
+		sy.hud = act.hud
+	}
+	if sy.hud != nil {
+		st = st.AddHUD(htm.Text("Symbols"), sy.hud)
+	}
+	return st
+}
+
+func (sy *Symbols) runSymbols(cx *mg.CmdCtx) *mg.State {
+	go sy.search(cx)
+	return cx.State
+}
+
+func (sy *Symbols) search(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+	defer cx.Begin(mg.Task{Title: "Go/Symbols", ShowNow: true}).Done()
+
+	unexported := sy.Unexported
+	args := cx.Args
+	for len(args) != 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-unexported", "--unexported":
+			unexported = true
+		default:
+			fmt.Fprintf(cx.Output, "Error: unknown flag `%s`\n", args[0])
+			return
+		}
+		args = args[1:]
+	}
+	query := strings.TrimSpace(strings.Join(args, " "))
+	if query == "" {
+		fmt.Fprintln(cx.Output, "Usage: .symbols [-unexported] <query>")
+		return
+	}
+
+	matches := sy.match(cx.Ctx, query, unexported)
+	if len(matches) > SymbolsLimit {
+		matches = matches[:SymbolsLimit]
+	}
+
+	links := make([]htm.Element, 0, len(matches))
+	buf := &bytes.Buffer{}
+	for _, m := range matches {
+		fn := mgutil.ShortFn(m.Pos.Filename, cx.Env)
+		name := m.Pkg.Name + "." + m.qualifiedName()
+		fmt.Fprintf(buf, "%s:%d:%d: %s %s\n", fn, m.Pos.Line, m.Pos.Column, m.Kind, name)
+		links = append(links, htm.Div(nil,
+			htm.A(&htm.AAttrs{Action: posActivate(cx.View, m.Pos)}, htm.Text(name)),
+			htm.Textf(" %s %s:%d", m.Kind, fn, m.Pos.Line),
+		))
+	}
+	fmt.Fprintf(buf, "%d symbols matching `%s`\n", len(matches), query)
+	cx.Output.Write(buf.Bytes())
+
+	hud := htm.Div(nil, append([]htm.Element{htm.Textf("%d symbols matching `%s`", len(matches), query)}, links...)...)
+	cx.Store.Dispatch(symbolsAct{hud: hud})
+}
+
+// match returns the symbols matching query, sorted by rank
+func (sy *Symbols) match(mx *mg.Ctx, query string, unexported bool) []symbolMatch {
+	root := searchRoot(mx, mx.View.Dir())
+	var matches []symbolMatch
+	for _, sd := range sy.index(mx, root) {
+		local := sd.Dir == root || mgutil.IsParentDir(root, sd.Dir)
+		for _, sym := range sd.Syms {
+			if !unexported && !ast.IsExported(sym.Name) {
+				continue
+			}
+			m := symbolMatch{goSymbol: sym, Pkg: sd, Local: local}
+			m.Score = symbolScore(query, sym.Name)
+			if strings.Contains(query, ".") {
+				m.Score = symbolScore(query, sd.Name+"."+m.qualifiedName())
+				if s := symbolScore(query, m.qualifiedName()); s > m.Score {
+					m.Score = s
+				}
+			}
+			if m.Score > 0 {
+				matches = append(matches, m)
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.Local != b.Local:
+			return a.Local
+		case len(a.Name) != len(b.Name):
+			return len(a.Name) < len(b.Name)
+		case a.Pkg.Path != b.Pkg.Path:
+			return a.Pkg.Path < b.Pkg.Path
+		default:
+			return a.qualifiedName() < b.qualifiedName()
+		}
+	})
+	return matches
+}
+
+func (m symbolMatch) qualifiedName() string {
+	if m.Recv != "" {
+		return m.Recv + "." + m.Name
+	}
+	return m.Name
+}
+
+// rootDirs returns the list of package dirs under root.
+//
+// The list of packages found by the VFS scan is used, and root is only walked
+// if it contains none of them e.g. if it's a module outside of GOPATH, or the scan hasn't finished yet.
+func (sy *Symbols) rootDirs(mx *mg.Ctx, bld *build.Context, root string) []string {
+	dirs := []string{}
+	for _, p := range mctl.plst.View().List {
+		if p.Dir == root || mgutil.IsParentDir(root, p.Dir) {
+			dirs = append(dirs, p.Dir)
+		}
+	}
+	if len(dirs) != 0 {
+		// the scan might not know about the view's package yet
+		return append(dirs, mx.View.Dir())
+	}
+
+	sy.mu.Lock()
+	dirs, ok := sy.roots[root]
+	sy.mu.Unlock()
+	if ok {
+		return dirs
+	}
+	walkPkgDirs(bld, root, func(bp *build.Package) {
+		dirs = append(dirs, bp.Dir)
+	})
+	sy.mu.Lock()
+	defer sy.mu.Unlock()
+	if sy.roots == nil {
+		sy.roots = map[string][]string{}
+	}
+	sy.roots[root] = dirs
+	return dirs
+}
+
+// index returns the symbols of the packages under root, and all the packages they import.
+// Packages are only indexed the first time they're seen.
+// sy.mu is not held while packages are indexed.
+func (sy *Symbols) index(mx *mg.Ctx, root string) []*symbolsDir {
+	bld := BuildContext(mx)
+	lookup := func(dir string) *symbolsDir {
+		sy.mu.Lock()
+		defer sy.mu.Unlock()
+		return sy.dirs[dir]
+	}
+	store := func(sd *symbolsDir) *symbolsDir {
+		sy.mu.Lock()
+		defer sy.mu.Unlock()
+		if sy.dirs == nil {
+			sy.dirs = map[string]*symbolsDir{}
+		}
+		// another search might have indexed it in the meantime
+		if x := sy.dirs[sd.Dir]; x != nil {
+			return x
+		}
+		sy.dirs[sd.Dir] = sd
+		return sd
+	}
+
+	seen := map[string]bool{}
+	var l []*symbolsDir
+	for q := sy.rootDirs(mx, bld, root); len(q) != 0; {
+		dir := q[0]
+		q = q[1:]
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		sd := lookup(dir)
+		if sd == nil {
+			sd = store(indexSymbols(mx, bld, dir))
+		}
+		l = append(l, sd)
+		for _, ipath := range sd.Imports {
+			if ipath == "C" || ipath == "unsafe" {
+				continue
+			}
+			if pp, err := gopkg.FindPkg(mx, ipath, dir); err == nil && !seen[pp.Dir] {
+				q = append(q, pp.Dir)
+			}
+		}
+	}
+	return l
+}
+
+// reindex updates the index of the package of the saved view
+func (sy *Symbols) reindex(mx *mg.Ctx) {
+	// we might be called before the VFS sees the change
+	mx.VFS.Invalidate(mx.View.Filename())
+	dir := mx.View.Dir()
+	sy.mu.Lock()
+	for root, dirs := range sy.roots {
+		if dir != root && !mgutil.IsParentDir(root, dir) {
+			continue
+		}
+		found := false
+		for _, d := range dirs {
+			if d == dir {
+				found = true
+				break
+			}
+		}
+		if !found {
+			// it's a new package
+			sy.roots[root] = append(dirs, dir)
+		}
+	}
+	_, indexed := sy.dirs[dir]
+	sy.mu.Unlock()
+
+	// packages that haven't been searched yet are indexed when they're first seen
+	if !indexed {
+		return
+	}
+	sd := indexSymbols(mx, BuildContext(mx), dir)
+	sy.mu.Lock()
+	defer sy.mu.Unlock()
+	sy.dirs[dir] = sd
+}
+
+// indexSymbols returns the list of top-level declarations in the (non-test) files of the package in dir
+func indexSymbols(mx *mg.Ctx, bld *build.Context, dir string) *symbolsDir {
+	sd := &symbolsDir{Dir: dir}
+	bp, err := bld.ImportDir(dir, 0)
+	if err != nil && bp.Name == "" {
+		return sd
+	}
+	sd.Name = bp.Name
+	sd.Path = bp.ImportPath
+	sd.Imports = bp.Imports
+	fset := token.NewFileSet()
+	for _, l := range [][]string{bp.GoFiles, bp.CgoFiles} {
+		for _, nm := range l {
+			fn := filepath.Join(dir, nm)
+			src, err := mx.VFS.ReadBlob(fn).ReadFile()
+			if err != nil {
+				continue
+			}
+			af, _ := parser.ParseFile(fset, fn, src, 0)
+			if af == nil {
+				continue
+			}
+			sd.Syms = append(sd.Syms, fileSymbols(fset, af)...)
+		}
+	}
+	return sd
+}
+
+// fileSymbols returns the list of top-level declarations, and methods in af
+func fileSymbols(fset *token.FileSet, af *ast.File) []goSymbol {
+	var l []goSymbol
+	add := func(id *ast.Ident, kind, recv string) {
+		if id.Name != "_" {
+			l = append(l, goSymbol{Name: id.Name, Kind: kind, Recv: recv, Pos: fset.Position(id.Pos())})
+		}
+	}
+	for _, d := range af.Decls {
+		switch x := d.(type) {
+		case *ast.FuncDecl:
+			if x.Recv == nil || len(x.Recv.List) == 0 {
+				add(x.Name, "func", "")
+			} else {
+				add(x.Name, "method", recvTypeName(x.Recv.List[0].Type))
+			}
+		case *ast.GenDecl:
+			for _, spec := range x.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name, "type", "")
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						add(id, x.Tok.String(), "")
+					}
+				}
+			}
+		}
+	}
+	return l
+}
+
+// symbolScore returns a score indicating how well name matches query, higher is better.
+// It returns 0 if name doesn't match query.
+//
+// Exact matches rank highest, followed by prefix matches, then substrings and lastly fuzzy matches
+// i.e. where all characters of the query appear in name in the same order.
+// Matches are case-insensitive, but matches with the same case rank higher.
+func symbolScore(query, name string) int {
+	lq, ln := strings.ToLower(query), strings.ToLower(name)
+	switch {
+	case name == query:
+		return 1000
+	case ln == lq:
+		return 900
+	case strings.HasPrefix(name, query):
+		return 800 - len(name)
+	case strings.HasPrefix(ln, lq):
+		return 700 - len(name)
+	case strings.Contains(ln, lq):
+		return 500 - strings.Index(ln, lq) - len(name)
+	}
+
+	if len(ln) != len(name) {
+		// the case of some characters changed their size, so we can't use name to look for word boundaries
+		name = ln
+	}
+	score := 300 - len(name)
+	i := 0
+	for _, c := range lq {
+		j := strings.IndexRune(ln[i:], c)
+		if j < 0 {
+			return 0
+		}
+		// characters that start a word e.g. `B` in `ReadBytes` are likely what the user meant
+		if k := i + j; k != 0 && !unicode.IsUpper(rune(name[k])) && name[k-1] != '_' {
+			score -= j
+		}
+		i += j + 1
+	}
+	if score < 1 {
+		return 1
+	}
+	return score
+}
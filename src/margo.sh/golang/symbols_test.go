@@ -0,0 +1,119 @@
+package golang
+
+import (
+	"io/ioutil"
+	"margo.sh/golang/gopkg"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymbolScore(t *testing.T) {
+	ranked := []string{
+		"Reader",
+		"reader",
+		"ReaderAt",
+		"readerImpl",
+		"ByteReader",
+		"RuneDecoder",
+	}
+	for i := 1; i < len(ranked); i++ {
+		a, b := symbolScore("Reader", ranked[i-1]), symbolScore("Reader", ranked[i])
+		if a <= b {
+			t.Errorf("expected `%s` (%d) to rank higher than `%s` (%d)", ranked[i-1], a, ranked[i], b)
+		}
+	}
+	if s := symbolScore("rdb", "ReadBytes"); s <= symbolScore("rdb", "readerDebug") {
+		t.Errorf("expected word boundaries to rank higher")
+	}
+	if s := symbolScore("xyz", "Reader"); s != 0 {
+		t.Errorf("expected `xyz` not to match `Reader`, got score %d", s)
+	}
+}
+
+func TestSymbolsMatch(t *testing.T) {
+	gopath, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": `package a
+
+import "dep/d"
+
+type Reader struct{}
+
+func (r *Reader) Read() {}
+
+func newReader() *Reader { return nil }
+
+var _ = d.ReadAll
+`,
+		"dep/d/d.go": `package d
+
+func ReadAll() {}
+`,
+		"other/o/o.go": `package o
+
+func ReadOther() {}
+`,
+	})
+	defer cleanup()
+
+	mx := newCtx("ex/a/a.go", "")
+	defer mx.Cancel()
+
+	sy := &Symbols{}
+	names := func(l []symbolMatch) []string {
+		s := make([]string, len(l))
+		for i, m := range l {
+			s[i] = m.Pkg.Name + "." + m.qualifiedName()
+		}
+		return s
+	}
+	check := func(query string, unexported bool, exp ...string) {
+		t.Helper()
+		got := names(sy.match(mx, query, unexported))
+		if len(got) != len(exp) {
+			t.Fatalf("%s: expected %v, got %v", query, exp, got)
+		}
+		for i := range exp {
+			if got[i] != exp[i] {
+				t.Errorf("%s: expected %v, got %v", query, exp, got)
+				break
+			}
+		}
+	}
+	check("read", false, "a.Reader.Read", "a.Reader", "d.ReadAll")
+	check("read", true, "a.Reader.Read", "a.Reader", "d.ReadAll", "a.newReader")
+	check("Reader.Read", false, "a.Reader.Read")
+
+	// saving a file updates the index
+	fn := filepath.Join(gopath, "src", "ex", "a", "a.go")
+	if err := ioutil.WriteFile(fn, []byte("package a\n\nfunc ReadNew() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sy.reindex(mx)
+	check("readnew", false, "a.ReadNew")
+}
+
+func TestSymbolsRootDirs(t *testing.T) {
+	gopath, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": "package a\n",
+		"ex/b/b.go": "package b\n",
+	})
+	defer cleanup()
+
+	mx := newCtx("ex/a/a.go", "")
+	defer mx.Cancel()
+
+	root := filepath.Join(gopath, "src", "ex")
+	dirA, dirB := filepath.Join(root, "a"), filepath.Join(root, "b")
+	sy := &Symbols{}
+	if dirs := sy.rootDirs(mx, BuildContext(mx), root); len(dirs) != 2 {
+		t.Fatalf("expected both packages to be found by walking the root, got %v", dirs)
+	}
+
+	// once the package list knows about the root, it's used instead of walking the root
+	mctl.plst.Add(gopkg.Pkg{Dir: dirB, Name: "b", ImportPath: "ex/b"})
+	defer mctl.plst.PruneDir(dirB)
+	dirs := sy.rootDirs(mx, BuildContext(mx), root)
+	if len(dirs) != 2 || dirs[0] != dirB || dirs[1] != dirA {
+		t.Fatalf("expected the listed package and the view's package, got %v", dirs)
+	}
+}
@@ -0,0 +1,236 @@
+package golang
+
+import (
+	"bytes"
+	"go/ast"
+	"go/doc"
+	"go/token"
+	"go/types"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"unicode/utf8"
+)
+
+type tooltipsQuery struct {
+	mx  *mg.Ctx
+	act mg.QueryTooltips
+}
+
+type tooltipsAct struct {
+	mg.ActionType
+	name     string
+	tooltips []mg.Tooltip
+}
+
+// Tooltips shows information about the identifier under the mouse when hovering over it.
+//
+// It shows the declaration of the identifier i.e. its signature or type,
+// the package that declares it, the value of constants and its documentation.
+//
+// Only the last query is processed, and the package is only type-checked again after the view changes.
+type Tooltips struct {
+	mg.ReducerType
+
+	q *mgutil.ChanQ
+
+	// sc is the checker of the last query, and scKey identifies the view it checked.
+	// They're only accessed by the processer goroutine.
+	sc    *srcChecker
+	scKey string
+}
+
+func (tt *Tooltips) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (tt *Tooltips) RMount(mx *mg.Ctx) {
+	tt.q = mgutil.NewChanQ(1)
+	go tt.processer()
+}
+
+func (tt *Tooltips) RUnmount(mx *mg.Ctx) {
+	tt.q.Close()
+}
+
+func (tt *Tooltips) Reduce(mx *mg.Ctx) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.QueryTooltips:
+		tt.q.Put(tooltipsQuery{mx: mx, act: act})
+	case tooltipsAct:
+		// the view might have changed while we were busy
+		if act.name == mx.View.Name {
+			return mx.AddTooltips(act.tooltips...)
+		}
+	}
+	return mx.State
+}
+
+func (tt *Tooltips) processer() {
+	for v := range tt.q.C() {
+		q := v.(tooltipsQuery)
+		tt.query(q.mx, q.act)
+	}
+}
+
+func (tt *Tooltips) query(mx *mg.Ctx, act mg.QueryTooltips) {
+	defer func() { recover() }()
+
+	src, err := mx.View.ReadAll()
+	if err != nil {
+		return
+	}
+	pos := rowColOffset(src, act.Row, act.Col)
+	mx = mx.Copy(func(mx *mg.Ctx) {
+		mx.State = mx.State.SetView(mx.View.Copy(func(v *mg.View) { v.Pos = pos }))
+	})
+	l, err := objTooltips(tt.checker(mx))
+	if err != nil || len(l) == 0 {
+		return
+	}
+	mx.Store.Dispatch(tooltipsAct{name: mx.View.Name, tooltips: l})
+}
+
+// checker returns a srcChecker for the view in mx,
+// reusing the last one, and therefore its type-checked packages, if the view hasn't changed since
+func (tt *Tooltips) checker(mx *mg.Ctx) *srcChecker {
+	v := mx.View
+	k := v.Filename() + "\x00" + v.Hash
+	if tt.sc == nil || tt.scKey != k || v.Hash == "" {
+		tt.sc = newSrcChecker(mx)
+		tt.scKey = k
+	}
+	tt.sc.mx = mx
+	return tt.sc
+}
+
+// objTooltips returns the tooltips describing the object under the cursor
+func objTooltips(sc *srcChecker) ([]mg.Tooltip, error) {
+	sp, err := sc.checkView()
+	if err != nil {
+		return nil, err
+	}
+	v := sc.mx.View
+	id, obj := sp.identAt(sc.fset, v.Filename(), v.Pos)
+	if id == nil || obj == nil {
+		return nil, nil
+	}
+
+	qual := func(p *types.Package) string {
+		if p == sp.Pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	els := []htm.Element{htm.StrongText(types.ObjectString(obj, qual))}
+	if c, ok := obj.(*types.Const); ok {
+		els = append(els, htm.Text(" = "+c.Val().ExactString()))
+	}
+	l := []mg.Tooltip{tooltip(els...)}
+
+	var pkg *types.Package
+	var docs string
+	if pn, ok := obj.(*types.PkgName); ok {
+		// the import path is already part of the declaration
+		if dp, err := sc.declsPkg(pn.Imported()); err == nil {
+			for _, af := range dp.Files {
+				if af.Doc != nil {
+					docs = af.Doc.Text()
+					break
+				}
+			}
+		}
+	} else {
+		if obj.Pkg() != nil && obj.Pkg() != sp.Pkg && !isLocalObj(obj) {
+			pkg = obj.Pkg()
+		}
+		if o, dp, err := sc.declSrc(obj); err == nil {
+			if tf := sc.fset.File(o.Pos()); tf != nil {
+				docs = declDoc(dp.file(sc.fset, tf.Name()), o.Pos())
+			}
+		}
+	}
+	if pkg != nil {
+		l = append(l, tooltip(htm.Text("package "), htm.EmText(pkg.Path())))
+	}
+	if docs != "" {
+		buf := &bytes.Buffer{}
+		doc.ToHTML(buf, docs, nil)
+		l = append(l, mg.Tooltip{Content: buf.String()})
+	}
+	return l, nil
+}
+
+// tooltip returns a tooltip whose content is the html of els
+func tooltip(els ...htm.Element) mg.Tooltip {
+	buf := &bytes.Buffer{}
+	for _, el := range els {
+		el.FPrintHTML(buf)
+	}
+	return mg.Tooltip{Content: buf.String()}
+}
+
+// declDoc returns the doc comment of the declaration whose name is at pos in af
+func declDoc(af *ast.File, pos token.Pos) string {
+	if af == nil {
+		return ""
+	}
+	var gen *ast.GenDecl
+	var cg *ast.CommentGroup
+	found := false
+	ast.Inspect(af, func(n ast.Node) bool {
+		if found || n == nil || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		names := []*ast.Ident{}
+		docs := []*ast.CommentGroup{}
+		inGen := false
+		switch x := n.(type) {
+		case *ast.GenDecl:
+			gen = x
+		case *ast.FuncDecl:
+			names, docs = []*ast.Ident{x.Name}, []*ast.CommentGroup{x.Doc}
+		case *ast.TypeSpec:
+			names, docs, inGen = []*ast.Ident{x.Name}, []*ast.CommentGroup{x.Doc, x.Comment}, true
+		case *ast.ValueSpec:
+			names, docs, inGen = x.Names, []*ast.CommentGroup{x.Doc, x.Comment}, true
+		case *ast.Field:
+			names, docs = x.Names, []*ast.CommentGroup{x.Doc, x.Comment}
+		}
+		for _, nm := range names {
+			if nm.Pos() != pos {
+				continue
+			}
+			found = true
+			if inGen && gen != nil {
+				// a comment on the group applies to all the specs in it
+				docs = append(docs, gen.Doc)
+			}
+			for _, d := range docs {
+				if d != nil {
+					cg = d
+					break
+				}
+			}
+		}
+		return !found
+	})
+	return cg.Text()
+}
+
+// rowColOffset returns the byte offset in src of the (0-based) row and column col, counted in runes
+func rowColOffset(src []byte, row, col int) int {
+	pos := 0
+	for ; row > 0; row-- {
+		i := bytes.IndexByte(src[pos:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		pos += i + 1
+	}
+	for ; col > 0 && pos < len(src) && src[pos] != '\n'; col-- {
+		_, n := utf8.DecodeRune(src[pos:])
+		pos += n
+	}
+	return pos
+}
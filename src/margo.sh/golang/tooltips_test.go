@@ -0,0 +1,120 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"strings"
+	"testing"
+)
+
+func TestObjTooltips(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": `// Package a is an example
+package a
+
+// Answers
+const (
+	// Answer is the answer
+	Answer = 42
+)
+
+// T is a thing
+type T struct {
+	// N is a number
+	N int
+}
+`,
+		"ex/b/b.go": `package b
+
+import "ex/a"
+
+var X = a.Answer
+`,
+	})
+	defer cleanup()
+
+	cases := []struct {
+		name string
+		src  string
+		tips []string
+	}{
+		{
+			name: "imported const",
+			src:  "package b\n\nimport \"ex/a\"\n\nvar X = a.Ans‸wer\n",
+			tips: []string{"const a.Answer untyped int", " = 42", "package <em >ex/a</em>", "Answer is the answer"},
+		},
+		{
+			name: "field",
+			src:  "package b\n\nimport \"ex/a\"\n\nvar X = a.T{}.N‸\n",
+			tips: []string{"field N int", "package <em >ex/a</em>", "N is a number"},
+		},
+		{
+			name: "package name",
+			src:  "package b\n\nimport \"ex/a\"\n\nvar X = a‸.Answer\n",
+			tips: []string{`package a ("ex/a")`, "Package a is an example"},
+		},
+		{
+			name: "local var",
+			src:  "package b\n\n// X is x\nvar X‸ = 1\n",
+			tips: []string{"var X int", "X is x"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := newCtx("ex/b/b.go", c.src)
+			defer mx.Cancel()
+
+			l, err := objTooltips(newSrcChecker(mx))
+			if err != nil {
+				t.Fatalf("objTooltips() failed: %s", err)
+			}
+			s := ""
+			for _, tip := range l {
+				s += tip.Content + "\n"
+			}
+			for _, exp := range c.tips {
+				if !strings.Contains(s, exp) {
+					t.Errorf("expected tooltips to contain %q, got:\n%s", exp, s)
+				}
+			}
+		})
+	}
+}
+
+func TestTooltipsChecker(t *testing.T) {
+	_, newCtx, cleanup := newTestGopath(t, map[string]string{
+		"ex/a/a.go": "package a\n\nvar X‸ = 1\n",
+	})
+	defer cleanup()
+
+	withHash := func(hash string) *mg.Ctx {
+		mx := newCtx("ex/a/a.go", "")
+		return mx.SetView(mx.View.Copy(func(v *mg.View) { v.Hash = hash }))
+	}
+	tt := &Tooltips{}
+	sc := tt.checker(withHash("1"))
+	if _, err := objTooltips(sc); err != nil {
+		t.Fatalf("objTooltips() failed: %s", err)
+	}
+	if tt.checker(withHash("1")) != sc {
+		t.Errorf("the checker was not reused while the view was unchanged")
+	}
+	if tt.checker(withHash("2")) == sc {
+		t.Errorf("the checker was reused after the view changed")
+	}
+}
+
+func TestRowColOffset(t *testing.T) {
+	src := []byte("ab\nçd\n")
+	cases := []struct{ row, col, pos int }{
+		{0, 0, 0},
+		{0, 5, 2},
+		{1, 1, 5},
+		{1, 2, 6},
+		{9, 0, len(src)},
+	}
+	for _, c := range cases {
+		if pos := rowColOffset(src, c.row, c.col); pos != c.pos {
+			t.Errorf("rowColOffset(%d, %d): expected %d, got %d", c.row, c.col, c.pos, pos)
+		}
+	}
+}
@@ -0,0 +1,612 @@
+package golang
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"margo.sh/golang/gopkg"
+	"margo.sh/golang/goutil"
+	"margo.sh/kimporter"
+	"margo.sh/mg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// srcPkg is a package that was type-checked from source with full type information
+type srcPkg struct {
+	Dir   string
+	XTest bool
+	Pkg   *types.Package
+	Info  *types.Info
+	Files []*ast.File
+	// Err is the first error reported by the parser or type-checker, if any
+	Err error
+}
+
+// file returns the file named fn, if it's part of the package
+func (sp *srcPkg) file(fset *token.FileSet, fn string) *ast.File {
+	for _, af := range sp.Files {
+		if tf := fset.File(af.Pos()); tf != nil && tf.Name() == fn {
+			return af
+		}
+	}
+	return nil
+}
+
+// identAt returns the identifier at the byte offset pos in the file fn, and the object it refers to
+func (sp *srcPkg) identAt(fset *token.FileSet, fn string, pos int) (*ast.Ident, types.Object) {
+	af := sp.file(fset, fn)
+	if af == nil {
+		return nil, nil
+	}
+	tf := fset.File(af.Pos())
+	if pos < 0 || pos > tf.Size() {
+		return nil, nil
+	}
+	tp := tf.Pos(pos)
+	var id *ast.Ident
+	ast.Inspect(af, func(n ast.Node) bool {
+		// the cursor is on an identifier if it's anywhere from its start to its end
+		if id != nil || n == nil || tp < n.Pos() || tp > n.End() {
+			return false
+		}
+		if x, ok := n.(*ast.Ident); ok {
+			id = x
+		}
+		return true
+	})
+	if id == nil {
+		return nil, nil
+	}
+	// Uses has priority so that embedded fields resolve to the embedded type
+	if obj := sp.Info.Uses[id]; obj != nil {
+		return id, obj
+	}
+	if obj := sp.Info.Defs[id]; obj != nil {
+		return id, obj
+	}
+	return id, sp.Info.Implicits[id]
+}
+
+// srcChecker type-checks packages from source into a shared FileSet.
+//
+// Packages it checked are used in place of the ones imported through kimporter,
+// so the objects declared in them are the same objects seen by the packages that import them.
+// This allows comparing objects across packages which is otherwise not possible
+// because each package imported by kimporter is checked separately.
+type srcChecker struct {
+	mx     *mg.Ctx
+	bld    *build.Context
+	fset   *token.FileSet
+	srcMap map[string][]byte
+	kp     *kimporter.Importer
+	pkgs   map[string]*srcPkg
+	dirs   map[*types.Package]string
+
+	// fromSrc is the set of package dirs that are checked from source when they're imported,
+	// instead of being imported through kimporter.
+	fromSrc map[string]bool
+}
+
+// newSrcChecker returns a new srcChecker.
+// The src of the current view is used in place of the file on disk, even if it's not saved.
+func newSrcChecker(mx *mg.Ctx) *srcChecker {
+	sc := &srcChecker{
+		mx:      mx,
+		bld:     BuildContext(mx),
+		fset:    token.NewFileSet(),
+		srcMap:  map[string][]byte{},
+		pkgs:    map[string]*srcPkg{},
+		dirs:    map[*types.Package]string{},
+		fromSrc: map[string]bool{},
+	}
+	if v := mx.View; v != nil {
+		if src, err := v.ReadAll(); err == nil {
+			sc.srcMap[v.Filename()] = src
+			if importsSyscallJs(mx, v.Filename(), src) {
+				// files that import syscall/js are usually only built for js/wasm
+				bld := *sc.bld
+				bld.GOOS = "js"
+				bld.GOARCH = "wasm"
+				sc.bld = &bld
+			}
+		}
+	}
+	// the view's package is checked by us, so kimporter doesn't need the SrcMap.
+	// without it, the packages we import directly are the same as the ones imported by our dependencies
+	sc.kp = kimporter.New(mx, nil)
+	return sc
+}
+
+// importsSyscallJs returns true if the file fn, or its package imports syscall/js
+func importsSyscallJs(mx *mg.Ctx, fn string, src []byte) bool {
+	const sysjs = "syscall/js"
+	pf := ParseFile(mx, fn, src)
+	for _, spec := range pf.AstFile.Imports {
+		if s, _ := strconv.Unquote(spec.Path.Value); s == sysjs {
+			return true
+		}
+	}
+	if mx.View.Path == "" {
+		// file doesn't exist, so there's no package
+		return false
+	}
+	pkg, _ := BuildContext(mx).ImportDir(filepath.Dir(fn), 0)
+	if pkg == nil {
+		return false
+	}
+	for _, l := range [][]string{pkg.Imports, pkg.TestImports} {
+		for _, s := range l {
+			if s == sysjs {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (sc *srcChecker) Import(path string) (*types.Package, error) {
+	return sc.ImportFrom(path, ".", 0)
+}
+
+func (sc *srcChecker) ImportFrom(ipath, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	pp, err := gopkg.FindPkg(sc.mx, ipath, srcDir)
+	if err == nil {
+		if sc.fromSrc[pp.Dir] {
+			// there are no import cycles, but don't retry if the check fails
+			delete(sc.fromSrc, pp.Dir)
+			sc.checkDir(pp.Dir, false)
+		}
+		if sp := sc.pkgs[sc.key(pp.Dir, false)]; sp != nil && sp.Pkg != nil {
+			return sp.Pkg, nil
+		}
+	}
+	pkg, err := sc.kp.ImportFrom(ipath, srcDir, mode)
+	if pkg != nil && pp != nil {
+		sc.dirs[pkg] = pp.Dir
+	}
+	return pkg, err
+}
+
+func (sc *srcChecker) key(dir string, xtest bool) string {
+	if xtest {
+		return dir + "#xtest"
+	}
+	return dir
+}
+
+// pkgDir returns the directory of pkg if it was imported or checked by sc
+func (sc *srcChecker) pkgDir(pkg *types.Package) string {
+	if dir, ok := sc.dirs[pkg]; ok {
+		return dir
+	}
+	for _, sp := range sc.pkgs {
+		if sp.Pkg == pkg {
+			return sp.Dir
+		}
+	}
+	return ""
+}
+
+// readFile returns the src of the file fn, preferring unsaved src in sc.srcMap
+func (sc *srcChecker) readFile(fn string) ([]byte, error) {
+	if src, ok := sc.srcMap[fn]; ok {
+		return src, nil
+	}
+	return sc.mx.VFS.ReadBlob(fn).ReadFile()
+}
+
+// checkDir type-checks the package in dir.
+// If xtest is true, the external test package (package x_test) is checked instead.
+// Internal test files are always included.
+func (sc *srcChecker) checkDir(dir string, xtest bool) (*srcPkg, error) {
+	k := sc.key(dir, xtest)
+	if sp := sc.pkgs[k]; sp != nil {
+		return sp, nil
+	}
+	bp, err := sc.bld.ImportDir(dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok || !xtest {
+			return nil, err
+		}
+	}
+	names := append(append(append([]string{}, bp.GoFiles...), bp.CgoFiles...), bp.TestGoFiles...)
+	ipath := bp.ImportPath
+	if ipath == "" || ipath == "." {
+		// the package is outside of GOPATH e.g. in a module
+		ipath = filepath.ToSlash(dir)
+	}
+	if xtest {
+		names = bp.XTestGoFiles
+		ipath += "_test"
+	}
+	if len(names) == 0 {
+		return nil, &build.NoGoError{Dir: dir}
+	}
+	fns := make([]string, len(names))
+	for i, nm := range names {
+		fns[i] = filepath.Join(dir, nm)
+	}
+	sp := sc.check(dir, ipath, fns, true)
+	sp.XTest = xtest
+	sc.pkgs[k] = sp
+	sc.dirs[sp.Pkg] = dir
+	return sp, nil
+}
+
+// checkView type-checks the package of the current view and returns it.
+// If the view's file doesn't exist, or is excluded by build constraints, only the view is checked.
+func (sc *srcChecker) checkView() (*srcPkg, error) {
+	v := sc.mx.View
+	if v.Path != "" {
+		for _, xtest := range []bool{false, true} {
+			sp, err := sc.checkDir(v.Dir(), xtest)
+			if err == nil && sp.file(sc.fset, v.Filename()) != nil {
+				return sp, nil
+			}
+		}
+	}
+	return sc.check(v.Dir(), "_", []string{v.Filename()}, true), nil
+}
+
+// check parses and type-checks the files fns as the package ipath.
+// Errors are recorded in srcPkg.Err, but do not stop the check so partial information is available.
+// If funcBodies is false, only declarations are checked.
+func (sc *srcChecker) check(dir, ipath string, fns []string, funcBodies bool) *srcPkg {
+	sp := &srcPkg{
+		Dir: dir,
+		Info: &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Implicits:  map[ast.Node]types.Object{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+			Scopes:     map[ast.Node]*types.Scope{},
+		},
+	}
+	setErr := func(err error) {
+		if sp.Err == nil {
+			sp.Err = err
+		}
+	}
+	for _, fn := range fns {
+		src, err := sc.readFile(fn)
+		if err != nil {
+			setErr(err)
+			continue
+		}
+		af, err := parser.ParseFile(sc.fset, fn, src, parser.ParseComments)
+		setErr(err)
+		if af != nil {
+			sp.Files = append(sp.Files, af)
+		}
+	}
+	tc := types.Config{
+		FakeImportC:      true,
+		IgnoreFuncBodies: !funcBodies,
+		Error:            setErr,
+		Importer:         sc,
+		Sizes:            types.SizesFor(sc.bld.Compiler, sc.bld.GOARCH),
+	}
+	sp.Pkg, _ = tc.Check(ipath, sc.fset, sp.Files, sp.Info)
+	return sp
+}
+
+// srcPkgOf returns the package checked from source that's the same as pkg
+func (sc *srcChecker) srcPkgOf(pkg *types.Package) *srcPkg {
+	for _, sp := range sc.pkgs {
+		if sp.Pkg == pkg {
+			return sp
+		}
+	}
+	return nil
+}
+
+// importDir returns the dir of pkg, looking it up by import path if it wasn't imported directly
+func (sc *srcChecker) importDir(pkg *types.Package) (string, error) {
+	if dir := sc.pkgDir(pkg); dir != "" {
+		return dir, nil
+	}
+	pp, err := gopkg.FindPkg(sc.mx, pkg.Path(), sc.mx.View.Dir())
+	if err != nil {
+		return "", err
+	}
+	return pp.Dir, nil
+}
+
+// declPos returns the position of the declaration of obj.
+//
+// Objects imported through kimporter don't have a usable position,
+// so the declarations in their package are checked from source to find it.
+func (sc *srcChecker) declPos(obj types.Object) (token.Position, error) {
+	o, _, err := sc.declSrc(obj)
+	if err != nil {
+		return token.Position{}, err
+	}
+	return sc.fset.Position(o.Pos()), nil
+}
+
+// declSrc returns the object declared in source that's the same as obj, and the package that declares it
+func (sc *srcChecker) declSrc(obj types.Object) (types.Object, *srcPkg, error) {
+	pkg := obj.Pkg()
+	if pkg == nil || !obj.Pos().IsValid() {
+		return nil, nil, fmt.Errorf("`%s` is predeclared", obj.Name())
+	}
+	if sp := sc.srcPkgOf(pkg); sp != nil {
+		return obj, sp, nil
+	}
+	sp, err := sc.declsPkg(pkg)
+	if err != nil {
+		return nil, nil, err
+	}
+	o := lookupObj(obj, sp.Pkg)
+	if o == nil || !o.Pos().IsValid() {
+		return nil, nil, fmt.Errorf("cannot find the declaration of `%s` in %s", obj.Name(), sp.Dir)
+	}
+	return o, sp, nil
+}
+
+// declsPkg returns pkg checked from source.
+// If it wasn't checked by sc, only the declarations in its non-test files are checked.
+func (sc *srcChecker) declsPkg(pkg *types.Package) (*srcPkg, error) {
+	if sp := sc.srcPkgOf(pkg); sp != nil {
+		return sp, nil
+	}
+	if pkg.Path() == "C" || pkg == types.Unsafe {
+		return nil, fmt.Errorf("`%s` is a fake package", pkg.Path())
+	}
+	dir, err := sc.importDir(pkg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the package `%s`: %s", pkg.Path(), err)
+	}
+	k := dir + "#decls"
+	if sp := sc.pkgs[k]; sp != nil {
+		return sp, nil
+	}
+	bp, err := sc.bld.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fns := []string{}
+	for _, l := range [][]string{bp.GoFiles, bp.CgoFiles} {
+		for _, nm := range l {
+			fns = append(fns, filepath.Join(dir, nm))
+		}
+	}
+	sp := sc.check(dir, pkg.Path(), fns, false)
+	sc.pkgs[k] = sp
+	return sp, nil
+}
+
+// importers returns the list of package dirs under root that import the package in dir.
+//
+// If transitive is true, packages that import it indirectly are included as well.
+// Only the non-test imports of a package make its importers indirect importers of dir.
+func (sc *srcChecker) importers(root, dir string, transitive bool) []string {
+	resolved := map[string]string{}
+	resolve := func(srcDir, ipath string) string {
+		k := srcDir + "\x00" + ipath
+		if d, ok := resolved[k]; ok {
+			return d
+		}
+		d := ""
+		if pp, err := gopkg.FindPkg(sc.mx, ipath, srcDir); err == nil {
+			d = pp.Dir
+		}
+		resolved[k] = d
+		return d
+	}
+	targets := map[string]bool{dir: true}
+	importsTarget := func(bp *build.Package, l []string) bool {
+		for _, ipath := range l {
+			if targets[resolve(bp.Dir, ipath)] {
+				return true
+			}
+		}
+		return false
+	}
+
+	pkgs := []*build.Package{}
+	walkPkgDirs(sc.bld, root, func(bp *build.Package) {
+		pkgs = append(pkgs, bp)
+	})
+	found := map[string]bool{}
+	dirs := []string{}
+	for changed := true; changed; {
+		changed = false
+		for _, bp := range pkgs {
+			if transitive && !targets[bp.Dir] && importsTarget(bp, bp.Imports) {
+				targets[bp.Dir] = true
+				changed = true
+			}
+			if found[bp.Dir] {
+				continue
+			}
+			for _, l := range [][]string{bp.Imports, bp.TestImports, bp.XTestImports} {
+				if importsTarget(bp, l) {
+					found[bp.Dir] = true
+					dirs = append(dirs, bp.Dir)
+					break
+				}
+			}
+		}
+	}
+	return dirs
+}
+
+// walkPkgDirs calls f for each package dir under root.
+// Dirs that are ignored by the go tool, and nested modules are skipped.
+func walkPkgDirs(bld *build.Context, root string, f func(bp *build.Package)) {
+	filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		nm := fi.Name()
+		if p != root {
+			if nm[0] == '.' || nm[0] == '_' || nm == "testdata" || nm == "vendor" || nm == "node_modules" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		bp, err := bld.ImportDir(p, 0)
+		if err != nil && bp.Name == "" {
+			return nil
+		}
+		f(bp)
+		return nil
+	})
+}
+
+// searchRoot returns the root directory of the module or repository containing dir.
+//
+// In GOPATH mode, the search doesn't go above the likely repository root in $GOPATH/src
+// i.e. `<host>/<owner>/<repo>` for import paths that start with a domain name, or the top-level dir otherwise.
+// Outside of GOPATH, if there is no repository, dir is returned.
+func searchRoot(mx *mg.Ctx, dir string) string {
+	if nd := goutil.ModFileNd(mx, dir); nd != nil {
+		return nd.Parent().Path()
+	}
+	isRepo := func(d string) bool {
+		_, err := os.Stat(filepath.Join(d, ".git"))
+		return err == nil
+	}
+	for _, gp := range goutil.PathList(BuildContext(mx).GOPATH) {
+		src := filepath.Join(gp, "src")
+		rel, err := filepath.Rel(src, dir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		l := strings.Split(filepath.ToSlash(rel), "/")
+		n := 1
+		if strings.Contains(l[0], ".") {
+			n = 3
+		}
+		if n > len(l) {
+			n = len(l)
+		}
+		top := filepath.Join(src, filepath.FromSlash(strings.Join(l[:n], "/")))
+		for d := dir; d != top; d = filepath.Dir(d) {
+			if isRepo(d) {
+				return d
+			}
+		}
+		return top
+	}
+	for d := dir; ; {
+		if isRepo(d) {
+			return d
+		}
+		p := filepath.Dir(d)
+		if p == d {
+			return dir
+		}
+		d = p
+	}
+}
+
+// pkgTypeNames returns the package-level named types declared in pkgs and the packages they import.
+// If transitive is true, all packages imported indirectly are included as well.
+func pkgTypeNames(pkgs []*types.Package, transitive bool) []*types.TypeName {
+	seen := map[*types.Package]bool{}
+	l := []*types.TypeName{}
+	var add func(pkg *types.Package, depth int)
+	add = func(pkg *types.Package, depth int) {
+		if pkg == nil || seen[pkg] {
+			return
+		}
+		seen[pkg] = true
+		scope := pkg.Scope()
+		for _, nm := range scope.Names() {
+			if tn, ok := scope.Lookup(nm).(*types.TypeName); ok && !tn.IsAlias() {
+				l = append(l, tn)
+			}
+		}
+		if depth == 0 || transitive {
+			for _, p := range pkg.Imports() {
+				add(p, depth+1)
+			}
+		}
+	}
+	for _, pkg := range pkgs {
+		add(pkg, 0)
+	}
+	return l
+}
+
+// isLocalObj returns true if obj can only be referred to in the package that declares it
+func isLocalObj(obj types.Object) bool {
+	switch obj.(type) {
+	case *types.PkgName, *types.Label:
+		return true
+	}
+	if pkg := obj.Pkg(); pkg != nil && obj.Parent() != nil && obj.Parent() != pkg.Scope() {
+		// declared in a func
+		return true
+	}
+	return !obj.Exported()
+}
+
+// objOwner returns the package-level type that declares obj as a field or method
+func objOwner(obj types.Object) *types.TypeName {
+	pkg := obj.Pkg()
+	if pkg == nil {
+		return nil
+	}
+	scope := pkg.Scope()
+	for _, nm := range scope.Names() {
+		tn, ok := scope.Lookup(nm).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if nt, ok := tn.Type().(*types.Named); ok {
+			for i := 0; i < nt.NumMethods(); i++ {
+				if nt.Method(i) == obj {
+					return tn
+				}
+			}
+		}
+		switch t := tn.Type().Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				if t.Field(i) == obj {
+					return tn
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < t.NumExplicitMethods(); i++ {
+				if t.ExplicitMethod(i) == obj {
+					return tn
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lookupObj returns the object in pkg that corresponds to obj, which was declared in another check of the same package.
+// Only package-level objects, and fields and methods of package-level types are found.
+func lookupObj(obj types.Object, pkg *types.Package) types.Object {
+	if obj.Pkg() == pkg {
+		return obj
+	}
+	if obj.Pkg() != nil && obj.Parent() == obj.Pkg().Scope() {
+		return pkg.Scope().Lookup(obj.Name())
+	}
+	owner := objOwner(obj)
+	if owner == nil {
+		return nil
+	}
+	tn, ok := pkg.Scope().Lookup(owner.Name()).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	o, _, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, obj.Name())
+	return o
+}
@@ -0,0 +1,28 @@
+// +build !go1.18
+
+package golang
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// isGeneric returns true if nt has type parameters
+func isGeneric(nt *types.Named) bool {
+	return false
+}
+
+// indexListX returns the operand of x if it's an index expression with multiple indices e.g. `T[K, V]`
+func indexListX(x ast.Expr) ast.Expr {
+	return nil
+}
+
+// isTypeParam returns true if t is a type parameter
+func isTypeParam(t types.Type) bool {
+	return false
+}
+
+// typeParamsStr returns the list of type parameters of t e.g. `[K, V]`
+func typeParamsStr(t *types.Named) string {
+	return ""
+}
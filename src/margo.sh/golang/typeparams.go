@@ -0,0 +1,41 @@
+// +build go1.18
+
+package golang
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// isGeneric returns true if nt has type parameters
+func isGeneric(nt *types.Named) bool {
+	return nt.TypeParams().Len() != 0
+}
+
+// indexListX returns the operand of x if it's an index expression with multiple indices e.g. `T[K, V]`
+func indexListX(x ast.Expr) ast.Expr {
+	if t, ok := x.(*ast.IndexListExpr); ok {
+		return t.X
+	}
+	return nil
+}
+
+// isTypeParam returns true if t is a type parameter
+func isTypeParam(t types.Type) bool {
+	_, ok := t.(*types.TypeParam)
+	return ok
+}
+
+// typeParamsStr returns the list of type parameters of t e.g. `[K, V]`
+func typeParamsStr(t *types.Named) string {
+	tp := t.TypeParams()
+	if tp.Len() == 0 {
+		return ""
+	}
+	l := make([]string, tp.Len())
+	for i := range l {
+		l[i] = tp.At(i).Obj().Name()
+	}
+	return "[" + strings.Join(l, ", ") + "]"
+}
@@ -22,7 +22,10 @@ var (
 		Register("ViewSaved", ViewSaved{}).
 		Register("QueryUserCmds", QueryUserCmds{}).
 		Register("QueryTestCmds", QueryTestCmds{}).
+		Register("QueryPromptChoices", QueryPromptChoices{}).
+		Register("QueryDeclarations", QueryDeclarations{}).
 		Register("RunCmd", RunCmd{}).
+		Register("CmdInput", CmdInput{}).
 		Register("QueryTooltips", QueryTooltips{})
 )
 
@@ -0,0 +1,274 @@
+package mg
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+var (
+	ansiColorNames = [16]string{
+		"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white",
+		"bright-black", "bright-red", "bright-green", "bright-yellow",
+		"bright-blue", "bright-magenta", "bright-cyan", "bright-white",
+	}
+)
+
+// CmdStyle describes the SGR (colour and text attributes) style of a run of command output.
+//
+// Fg and Bg are empty for the default colour, one of the 16 standard colour names
+// e.g. `red` or `bright-red`, or a `#rrggbb` hex colour.
+type CmdStyle struct {
+	Fg        string
+	Bg        string
+	Bold      bool
+	Dim       bool
+	Italic    bool
+	Underline bool
+	Inverse   bool
+}
+
+// CmdStyleRun is a run of CmdOutput.Output with style CmdStyle
+type CmdStyleRun struct {
+	CmdStyle
+
+	// Start and End are the rune (Unicode code point) offsets of the run in CmdOutput.Output
+	Start int
+	End   int
+}
+
+// ansiParser strips ANSI escape sequences from command output,
+// converting SGR sequences into a list of CmdStyleRun.
+//
+// It keeps the current style and incomplete escape sequences between calls to parse
+// so output can be parsed in chunks.
+type ansiParser struct {
+	style   CmdStyle
+	pending []byte
+}
+
+// parse returns the plain text in p and the styles that apply to it.
+func (ap *ansiParser) parse(p []byte) (text []byte, runs []CmdStyleRun) {
+	s := p
+	if len(ap.pending) != 0 {
+		s = append(ap.pending, p...)
+		ap.pending = nil
+	}
+
+	text = make([]byte, 0, len(s))
+	for len(s) != 0 {
+		i := bytes.IndexByte(s, 0x1b)
+		if i < 0 {
+			i = len(s)
+		}
+		if i > 0 {
+			runs = ap.addRun(runs, len(text), len(text)+i)
+			text = append(text, s[:i]...)
+			s = s[i:]
+			continue
+		}
+
+		n, complete := ap.escape(s)
+		if !complete {
+			ap.pending = append([]byte(nil), s...)
+			break
+		}
+		s = s[n:]
+	}
+	runeOffsets(text, runs)
+	return text, runs
+}
+
+// runeOffsets converts the byte offsets in runs into rune offsets in text.
+// runs must be sorted and not overlap.
+func runeOffsets(text []byte, runs []CmdStyleRun) {
+	pos, n := 0, 0
+	off := func(i int) int {
+		n += utf8.RuneCount(text[pos:i])
+		pos = i
+		return n
+	}
+	for i := range runs {
+		runs[i].Start = off(runs[i].Start)
+		runs[i].End = off(runs[i].End)
+	}
+}
+
+func (ap *ansiParser) addRun(runs []CmdStyleRun, start, end int) []CmdStyleRun {
+	if ap.style == (CmdStyle{}) {
+		return runs
+	}
+	if n := len(runs) - 1; n >= 0 && runs[n].End == start && runs[n].CmdStyle == ap.style {
+		runs[n].End = end
+		return runs
+	}
+	return append(runs, CmdStyleRun{CmdStyle: ap.style, Start: start, End: end})
+}
+
+// escape consumes the escape sequence at the start of s, returning its length.
+// complete is false if s ends before the sequence does.
+func (ap *ansiParser) escape(s []byte) (n int, complete bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	switch s[1] {
+	case '[':
+		// CSI: parameter and intermediate bytes, terminated by a byte in the range @-~
+		for i := 2; i < len(s); i++ {
+			c := s[i]
+			if c < 0x40 || c > 0x7e {
+				continue
+			}
+			if c == 'm' {
+				ap.sgr(string(s[2:i]))
+			}
+			return i + 1, true
+		}
+		return 0, false
+	case ']':
+		// OSC: terminated by BEL or ST (ESC \)
+		for i := 2; i < len(s); i++ {
+			switch {
+			case s[i] == 0x07:
+				return i + 1, true
+			case s[i] == 0x1b && i+1 < len(s) && s[i+1] == '\\':
+				return i + 2, true
+			}
+		}
+		return 0, false
+	default:
+		return 2, true
+	}
+}
+
+// sgr applies the list of SGR parameters in params to the current style
+func (ap *ansiParser) sgr(params string) {
+	l := ansiParams(params)
+	st := &ap.style
+	for i := 0; i < len(l); i++ {
+		switch n := l[i]; {
+		case n == 0:
+			*st = CmdStyle{}
+		case n == 1:
+			st.Bold = true
+		case n == 2:
+			st.Dim = true
+		case n == 3:
+			st.Italic = true
+		case n == 4:
+			st.Underline = true
+		case n == 7:
+			st.Inverse = true
+		case n == 22:
+			st.Bold, st.Dim = false, false
+		case n == 23:
+			st.Italic = false
+		case n == 24:
+			st.Underline = false
+		case n == 27:
+			st.Inverse = false
+		case n >= 30 && n <= 37:
+			st.Fg = ansiColorNames[n-30]
+		case n >= 90 && n <= 97:
+			st.Fg = ansiColorNames[n-90+8]
+		case n == 39:
+			st.Fg = ""
+		case n >= 40 && n <= 47:
+			st.Bg = ansiColorNames[n-40]
+		case n >= 100 && n <= 107:
+			st.Bg = ansiColorNames[n-100+8]
+		case n == 49:
+			st.Bg = ""
+		case n == 38 || n == 48:
+			c, skip := ansiExtColor(l[i+1:])
+			i += skip
+			if n == 38 {
+				st.Fg = c
+			} else {
+				st.Bg = c
+			}
+		}
+	}
+}
+
+// ansiParams splits the SGR parameter string s.
+// Empty parameters are treated as 0, as is an empty list.
+func ansiParams(s string) []int {
+	if s == "" {
+		return []int{0}
+	}
+	l := []int{}
+	for len(s) != 0 {
+		i := 0
+		for i < len(s) && s[i] != ';' && s[i] != ':' {
+			i++
+		}
+		n, _ := strconv.Atoi(s[:i])
+		l = append(l, n)
+		if i == len(s) {
+			break
+		}
+		s = s[i+1:]
+		if s == "" {
+			l = append(l, 0)
+		}
+	}
+	return l
+}
+
+// ansiExtColor parses the extended colour that follows SGR parameters 38 and 48.
+// It returns the colour and the number of parameters consumed.
+func ansiExtColor(l []int) (color string, n int) {
+	if len(l) == 0 {
+		return "", 0
+	}
+	switch l[0] {
+	case 5:
+		if len(l) < 2 {
+			return "", len(l)
+		}
+		return ansi256Color(l[1]), 2
+	case 2:
+		if len(l) < 4 {
+			return "", len(l)
+		}
+		return ansiHexColor(l[1], l[2], l[3]), 4
+	}
+	return "", 1
+}
+
+// ansi256Color returns the colour at index i of the xterm 256-colour palette
+func ansi256Color(i int) string {
+	switch {
+	case i < 0 || i > 255:
+		return ""
+	case i < 16:
+		return ansiColorNames[i]
+	case i < 232:
+		i -= 16
+		v := func(n int) int {
+			if n == 0 {
+				return 0
+			}
+			return 55 + n*40
+		}
+		return ansiHexColor(v(i/36), v(i/6%6), v(i%6))
+	default:
+		v := 8 + (i-232)*10
+		return ansiHexColor(v, v, v)
+	}
+}
+
+func ansiHexColor(r, g, b int) string {
+	clamp := func(n int) int {
+		switch {
+		case n < 0:
+			return 0
+		case n > 255:
+			return 255
+		}
+		return n
+	}
+	return fmt.Sprintf("#%02x%02x%02x", clamp(r), clamp(g), clamp(b))
+}
@@ -0,0 +1,54 @@
+package mg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnsiParser(t *testing.T) {
+	ap := &ansiParser{}
+	text, runs := ap.parse([]byte("ok \x1b[1;31mFAIL\x1b[0m done \x1b[38;5;196"))
+	if s := string(text); s != "ok FAIL done " {
+		t.Errorf("expected plain text `ok FAIL done `, got `%q`", s)
+	}
+	expect := []CmdStyleRun{{CmdStyle: CmdStyle{Fg: "red", Bold: true}, Start: 3, End: 7}}
+	if !reflect.DeepEqual(runs, expect) {
+		t.Errorf("expected runs %#v, got %#v", expect, runs)
+	}
+
+	text, runs = ap.parse([]byte("mhot\x1b]0;title\x07\x1b[K"))
+	if s := string(text); s != "hot" {
+		t.Errorf("expected plain text `hot`, got `%q`", s)
+	}
+	expect = []CmdStyleRun{{CmdStyle: CmdStyle{Fg: "#ff0000"}, Start: 0, End: 3}}
+	if !reflect.DeepEqual(runs, expect) {
+		t.Errorf("expected runs %#v, got %#v", expect, runs)
+	}
+}
+
+func TestAnsiParserRuneOffsets(t *testing.T) {
+	ap := &ansiParser{}
+	text, runs := ap.parse([]byte("✓ \x1b[32mok\x1b[0m … \x1b[1mdone\x1b[0m"))
+	if s := string(text); s != "✓ ok … done" {
+		t.Errorf("expected plain text `✓ ok … done`, got `%q`", s)
+	}
+	expect := []CmdStyleRun{
+		{CmdStyle: CmdStyle{Fg: "green"}, Start: 2, End: 4},
+		{CmdStyle: CmdStyle{Bold: true}, Start: 7, End: 11},
+	}
+	if !reflect.DeepEqual(runs, expect) {
+		t.Errorf("expected runs %#v, got %#v", expect, runs)
+	}
+}
+
+func TestCmdOutParseANSI(t *testing.T) {
+	w := &CmdOut{ParseANSI: true}
+	w.Write([]byte("\x1b[32mPASS\x1b[39m\n"))
+	out := w.Output()
+	if s := string(out.Output); s != "PASS\n" {
+		t.Errorf("expected output `PASS\\n`, got `%q`", s)
+	}
+	if len(out.Styles) != 1 || out.Styles[0].Fg != "green" {
+		t.Errorf("expected a single green style run, got %#v", out.Styles)
+	}
+}
@@ -65,17 +65,31 @@ func (bc builtins) nopRun(cx *CmdCtx) *State {
 func (bc builtins) execCmd(cx *CmdCtx) {
 	defer cx.Output.Close()
 
-	if cx.Name == ".exec" {
-		if len(cx.Args) == 0 {
-			return
-		}
-		cx = cx.Copy(func(cx *CmdCtx) {
-			cx.Name = cx.Args[0]
-			cx.Args = cx.Args[1:]
-		})
+	// only `.exec` supports shell syntax; other commands are run as-is
+	// so that args like `;` in `find -exec rm {} ;` or `<div>` are passed through unchanged
+	if cx.Name != ".exec" {
+		cx.RunProc()
+		return
 	}
+	if len(cx.Args) == 0 {
+		return
+	}
+	cx = cx.Copy(func(cx *CmdCtx) {
+		cx.Name = cx.Args[0]
+		cx.Args = cx.Args[1:]
+	})
 
-	cx.RunProc()
+	words := append([]string{cx.Name}, cx.Args...)
+	if !isShellSyntax(words) {
+		cx.RunProc()
+		return
+	}
+	sl, err := parseShell(words)
+	if err != nil {
+		fmt.Fprintf(cx.Output, "%s\n", err)
+		return
+	}
+	runShell(cx, sl)
 }
 
 // TypeCmd tries to find the cx.Args in commands, and writes the description of
@@ -129,7 +143,7 @@ func (bc builtins) EnvCmd(cx *CmdCtx) *State {
 func (bc builtins) Commands() BuiltinCmdList {
 	return []BuiltinCmd{
 		BuiltinCmd{Name: ".env", Desc: "List env vars", Run: bc.EnvCmd},
-		BuiltinCmd{Name: ".exec", Desc: "Run a command through os/exec", Run: bc.ExecCmd},
+		BuiltinCmd{Name: ".exec", Desc: "Run a command through os/exec, with support for pipes, redirects, &&, || and ;", Run: bc.ExecCmd},
 		BuiltinCmd{Name: ".type", Desc: "Lists all builtins or which builtin handles a command", Run: bc.TypeCmd},
 
 		// virtual commands implemented by other reducers
@@ -160,6 +174,9 @@ type CmdCtx struct {
 
 	// Verbose if true prints the command being run (prefixed by "# ")
 	Verbose bool
+
+	// history records the command in the command history
+	history *cmdHistoryRecord
 }
 
 func (cx *CmdCtx) update(updaters ...func(*CmdCtx)) *CmdCtx {
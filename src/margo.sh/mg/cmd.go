@@ -2,7 +2,9 @@ package mg
 
 import (
 	"bytes"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"margo.sh/mg/actions"
 	"margo.sh/mgutil"
@@ -19,6 +21,12 @@ var (
 	// OutputStreamFlushInterval specifies how often to flush command output.
 	OutputStreamFlushInterval = 500 * time.Millisecond
 
+	// DefaultTtySize is the window size used for RunCmd.Tty when RunCmd.TtySize is not set.
+	DefaultTtySize = TtySize{Rows: 24, Cols: 80}
+
+	// ProcOutputBufferSize is the amount of output kept for each Proc for replay with `.output`
+	ProcOutputBufferSize = 64 << 10
+
 	_ OutputStream = (*CmdOut)(nil)
 	_ OutputStream = (*IssueOut)(nil)
 	_ OutputStream = (OutputStreams)(nil)
@@ -126,9 +134,14 @@ type CmdOut struct {
 	Fd       string
 	Dispatch Dispatcher
 
+	// ParseANSI if true, strips ANSI escape sequences from the output
+	// and reports SGR colours and attributes in CmdOutput.Styles
+	ParseANSI bool
+
 	mu     sync.Mutex
 	buf    []byte
 	closed bool
+	ansi   ansiParser
 }
 
 func (w *CmdOut) Write(p []byte) (int, error) {
@@ -188,6 +201,9 @@ func (w *CmdOut) Output() CmdOutput {
 
 	out := CmdOutput{Fd: w.Fd, Output: w.buf, Close: w.closed}
 	w.buf = nil
+	if w.ParseANSI {
+		out.Output, out.Styles = w.ansi.parse(out.Output)
+	}
 	return out
 }
 
@@ -197,6 +213,12 @@ type CmdOutput struct {
 	Fd     string
 	Output []byte
 	Close  bool
+
+	// Styles is the list of styled runs in Output.
+	// It's only set if the CmdOut was created with ParseANSI e.g. by RunCmd.ParseANSI.
+	// Output never contains escape sequences in that case,
+	// so clients that can't render styles can display it as plain text.
+	Styles []CmdStyleRun
 }
 
 func (out CmdOutput) ClientAction() actions.ClientData {
@@ -218,7 +240,17 @@ func runCmd(mx *Ctx, rc RunCmd) *State {
 	cx := &CmdCtx{
 		Ctx:    mx,
 		RunCmd: rc,
-		Output: &CmdOut{Fd: rc.Fd, Dispatch: mx.Store.Dispatch},
+		Output: &CmdOut{Fd: rc.Fd, Dispatch: mx.Store.Dispatch, ParseANSI: rc.ParseANSI},
+	}
+	if len(rc.TypedPrompts) != 0 {
+		if err := ValidatePrompts(rc.TypedPrompts, rc.Prompts); err != nil {
+			defer cx.Output.Close()
+			fmt.Fprintf(cx.Output, "%s: %s\n", rc.Name, err)
+			return mx.State
+		}
+	}
+	if h := mx.Store.history; h != nil {
+		h.begin(cx)
 	}
 	defer mx.Profile.Push(cx.Name).Pop()
 	return cx.Run()
@@ -257,6 +289,12 @@ func (fs RunCmdFlagSet) Parse() error {
 	return fs.FlagSet.Parse(fs.RunCmd.Args)
 }
 
+// TtySize is the window size of a pseudo-terminal
+type TtySize struct {
+	Rows uint16
+	Cols uint16
+}
+
 type RunDmc = RunCmd
 type RunCmd struct {
 	ActionType
@@ -268,6 +306,48 @@ type RunCmd struct {
 	Args     []string
 	CancelID string
 	Prompts  []string
+
+	// TypedPrompts is the list of prompts for which Prompts were entered.
+	// If it's set, Prompts are validated against it before the command is run.
+	TypedPrompts []Prompt
+
+	// Tty if true, starts the process on a pseudo-terminal instead of a pipe.
+	// It's currently only supported on Linux.
+	Tty bool
+
+	// TtySize is the window size of the pseudo-terminal.
+	// If it's zero, DefaultTtySize is used.
+	TtySize TtySize
+
+	// Interactive if true, keeps the process' stdin open
+	// so that data can be sent to it using the CmdInput action.
+	// If Input is also set, the view's src is sent before any other input.
+	Interactive bool
+
+	// Limits is the list of resource limits applied to processes started by the command
+	Limits ProcLimits
+
+	// ParseANSI if true, strips ANSI escape sequences from the command's output
+	// and reports SGR colours and attributes in CmdOutput.Styles
+	ParseANSI bool
+}
+
+// CmdInput is the action dispatched to send data to the stdin of a running command
+// that was started with RunCmd.Interactive.
+//
+// The command is looked up by its task ID or CancelID, or by the Fd of its output.
+type CmdInput struct {
+	ActionType
+
+	CancelID string
+	Fd       string
+
+	// Data is written to the command's stdin
+	Data string
+
+	// Close if true, closes the command's stdin after Data is written.
+	// For commands started with RunCmd.Tty, an EOF (^D) is sent instead.
+	Close bool
 }
 
 func (rc RunCmd) Flags() RunCmdFlagSet {
@@ -347,18 +427,53 @@ type Proc struct {
 	cmd    *exec.Cmd
 	task   *TaskTicket
 	cid    string
+	out    *mgutil.RingBuffer
+	stdout io.Writer
+	limits *procLimiter
+	// progress if set, reports the progress of `go test` commands
+	progress *goTestProgress
+
+	ptm     *os.File
+	ptmDone chan struct{}
+
+	inputMu     sync.Mutex
+	inputQ      chan procInput
+	inputClosed bool
+}
+
+type procInput struct {
+	data  []byte
+	close bool
+}
+
+// ttyStdin writes input to the pty master.
+// Closing it sends EOF (^D) to the process instead of closing the pty.
+type ttyStdin struct{ *os.File }
+
+func (ts ttyStdin) Close() error {
+	_, err := ts.Write([]byte{4})
+	return err
 }
 
 func newProc(cx *CmdCtx) *Proc {
 	cmd := exec.Command(cx.Name, cx.Args...)
-	if cx.Input {
+	if cx.Input && !cx.Interactive {
 		s, _ := cx.View.ReadAll()
 		cmd.Stdin = bytes.NewReader(s)
 	}
+	out := mgutil.NewRingBuffer(ProcOutputBufferSize)
+	limits := newProcLimiter(cmdLimits(cx.Limits, cx.Name, cx.Args))
+	var progress *goTestProgress
+	stdout := io.MultiWriter(cx.Output, out)
+	if isGoTestCmd(cx.Name, cx.Args) {
+		progress = &goTestProgress{}
+		stdout = io.MultiWriter(stdout, progress)
+	}
+	stdout = limits.writer(stdout)
 	cmd.Dir = cx.Wd(cx.View)
 	cmd.Env = cx.Env.Environ()
-	cmd.Stdout = cx.Output
-	cmd.Stderr = cx.Output
+	cmd.Stdout = stdout
+	cmd.Stderr = stdout
 	cmd.SysProcAttr = pgSysProcAttr
 
 	name := filepath.Base(cx.Name)
@@ -370,12 +485,65 @@ func newProc(cx *CmdCtx) *Proc {
 		args[i] = s
 	}
 
-	return &Proc{
-		Title: "`" + mgutil.QuoteCmd(name, args...) + "`",
-		done:  make(chan struct{}),
-		cx:    cx,
-		cmd:   cmd,
-		cid:   cx.CancelID,
+	p := &Proc{
+		Title:    "`" + mgutil.QuoteCmd(name, args...) + "`",
+		done:     make(chan struct{}),
+		cx:       cx,
+		cmd:      cmd,
+		cid:      cx.CancelID,
+		out:      out,
+		stdout:   stdout,
+		limits:   limits,
+		progress: progress,
+	}
+	if cx.Interactive {
+		p.inputQ = make(chan procInput, 64)
+	}
+	return p
+}
+
+// Input queues data to be written to the process' stdin, closing it afterwards if close is true.
+// It returns an error if the process wasn't started with RunCmd.Interactive,
+// or its stdin was already closed.
+func (p *Proc) Input(data []byte, close bool) error {
+	p.inputMu.Lock()
+	defer p.inputMu.Unlock()
+
+	switch {
+	case p.inputQ == nil:
+		return errors.New("stdin is not interactive")
+	case p.inputClosed:
+		return errors.New("stdin is closed")
+	}
+
+	select {
+	case <-p.done:
+		return errors.New("process exited")
+	case p.inputQ <- procInput{data: data, close: close}:
+		p.inputClosed = close
+		return nil
+	default:
+		return errors.New("stdin is not being read")
+	}
+}
+
+func (p *Proc) inputWriter(w io.WriteCloser) {
+	defer w.Close()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case in := <-p.inputQ:
+			if len(in.data) != 0 {
+				if _, err := w.Write(in.data); err != nil {
+					return
+				}
+			}
+			if in.close {
+				return
+			}
+		}
 	}
 }
 
@@ -394,17 +562,97 @@ func (p *Proc) start() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.task = p.cx.Begin(Task{
+	task := Task{
 		CancelID: p.cid,
 		Title:    p.Title,
 		Cancel:   p.Cancel,
-	})
+		Fd:       p.cx.Fd,
+		Output:   p.out.Bytes,
+		Cmd:      p.cx.RunCmd,
+	}
+	if p.inputQ != nil {
+		task.Input = p.Input
+	}
+	p.task = p.cx.Begin(task)
+	if p.progress != nil {
+		p.progress.setTask(p.task)
+	}
 	go p.dispatcher()
 
-	if err := p.cmd.Start(); err != nil {
+	if p.cx.Tty {
+		return p.startTty()
+	}
+
+	var stdin io.WriteCloser
+	if p.inputQ != nil {
+		w, err := p.cmd.StdinPipe()
+		if err != nil {
+			p.close()
+			return err
+		}
+		stdin = w
+	}
+
+	if err := startLimited(p.cmd, p.limits); err != nil {
+		p.close()
+		return err
+	}
+	if stdin != nil {
+		p.startInput(stdin)
+	}
+	return nil
+}
+
+// startInput starts writing input to stdin, beginning with the view's src if RunCmd.Input is set.
+func (p *Proc) startInput(stdin io.WriteCloser) {
+	if p.cx.Input {
+		s, _ := p.cx.View.ReadAll()
+		p.Input(s, false)
+	}
+	go p.inputWriter(stdin)
+}
+
+// startTty starts the process with its stdout and stderr (and stdin if not already set)
+// attached to a new pseudo-terminal. Output read from the pty is written to cx.Output.
+func (p *Proc) startTty() error {
+	sz := p.cx.TtySize
+	if sz == (TtySize{}) {
+		sz = DefaultTtySize
+	}
+	ptm, pts, err := openPty(sz)
+	if err != nil {
+		p.close()
+		return err
+	}
+	defer pts.Close()
+
+	cmd := p.cmd
+	cmd.Stdout = pts
+	cmd.Stderr = pts
+	if cmd.Stdin == nil {
+		cmd.Stdin = pts
+	}
+	if p.cx.Env.Get("TERM", "") == "" {
+		cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+	}
+	cmd.SysProcAttr = ptySysProcAttr()
+
+	if err := startLimited(cmd, p.limits); err != nil {
+		ptm.Close()
 		p.close()
 		return err
 	}
+
+	p.ptm = ptm
+	p.ptmDone = make(chan struct{})
+	if p.inputQ != nil {
+		p.startInput(ttyStdin{ptm})
+	}
+	go func() {
+		defer close(p.ptmDone)
+		// reads fail with EIO once the process closes the pty so the error is not useful
+		io.Copy(p.stdout, ptm)
+	}()
 	return nil
 }
 
@@ -437,5 +685,39 @@ func (p *Proc) Wait() error {
 		p.close()
 	}()
 
-	return p.cmd.Wait()
+	err := p.cmd.Wait()
+	if rec := p.cx.history; rec != nil {
+		rec.exited(err)
+	}
+	p.task.SetError(err)
+	if p.ptm != nil {
+		// background children might keep the pty open so don't wait forever
+		select {
+		case <-p.ptmDone:
+		case <-time.After(OutputStreamFlushInterval):
+		}
+		p.ptm.Close()
+		<-p.ptmDone
+	}
+	p.reportLimits()
+	return err
+}
+
+// reportLimits reports any resource limit that was exceeded to the output and as an Issue.
+// Issues from a previous run of the same command are cleared.
+func (p *Proc) reportLimits() {
+	if p.limits == nil {
+		return
+	}
+	issues := IssueSet{}
+	if reason := p.limits.stop(p.cmd.ProcessState); reason != "" {
+		fmt.Fprintf(p.cx.Output, "%s was stopped: %s\n", p.Title, reason)
+		issues = issues.Add(limitIssue(p.cx.View, "Limits", p.Title, reason))
+	}
+	if sto := p.cx.Store; sto != nil {
+		sto.Dispatch(StoreIssues{
+			IssueKey: IssueKey{Key: procLimitIssueKey{Title: p.Title}},
+			Issues:   issues,
+		})
+	}
 }
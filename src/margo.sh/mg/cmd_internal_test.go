@@ -67,3 +67,33 @@ func TestCmdSupport_Reduce_withCmdOutput(t *testing.T) {
 		t.Errorf("cs.Reduce(%v): cs.cmdOutput() wasn't called", ctx)
 	}
 }
+
+func TestProcInteractiveInput(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	out := &CmdOut{}
+	cx := &CmdCtx{
+		Ctx:    mx,
+		RunCmd: RunCmd{Fd: "Jq8vE4", Name: "cat", Interactive: true},
+		Output: out,
+	}
+	p, err := cx.StartProc()
+	if err != nil {
+		t.Skipf("cannot start `cat`: %s", err)
+	}
+
+	st := mx.Store.tasks.cmdInput(mx.State, CmdInput{Fd: "Jq8vE4", Data: "hello\n", Close: true})
+	if len(st.Errors) != 0 {
+		t.Fatalf("CmdInput failed: %v", st.Errors)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("process exited with error: %s", err)
+	}
+	if s := string(out.Output().Output); s != "hello\n" {
+		t.Errorf("expected output `hello\\n`, got `%q`", s)
+	}
+	if err := p.Input([]byte("x"), false); err == nil {
+		t.Errorf("expected an error sending input after stdin was closed")
+	}
+}
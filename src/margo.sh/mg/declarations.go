@@ -0,0 +1,48 @@
+package mg
+
+// Declaration is a symbol declared in a file e.g. a type or func
+type Declaration struct {
+	// Name is the name of the symbol
+	Name string
+
+	// Kind is the kind of symbol e.g. `type`, `method` or `const`
+	Kind string
+
+	// Detail is a short description of the symbol e.g. its signature or the value of a const
+	Detail string
+
+	// Path is the name of the file in which the symbol is declared.
+	// It's empty if the symbol is declared in the current view and the view is not saved.
+	Path string
+
+	// Row is the (0-based) line on which the symbol is declared
+	Row int
+
+	// Col is the (0-based) column at which the symbol is declared
+	Col int
+
+	// Children is the list of symbols declared inside this symbol
+	// e.g. the fields and methods of a type
+	Children []Declaration
+}
+
+// QueryDeclarations is the action dispatched to get the list of symbols declared in the current view.
+//
+// Reducers add declarations using State.AddDeclarations.
+type QueryDeclarations struct {
+	ActionType
+
+	// Package if true, requests the declarations of the whole package (or equivalent)
+	// instead of only those in the current view
+	Package bool
+}
+
+// AddDeclarations adds the list of declarations in l to State.Declarations
+func (st *State) AddDeclarations(l ...Declaration) *State {
+	if len(l) == 0 {
+		return st
+	}
+	return st.Copy(func(st *State) {
+		st.Declarations = append(st.Declarations[:len(st.Declarations):len(st.Declarations)], l...)
+	})
+}
@@ -0,0 +1,399 @@
+package mg
+
+import (
+	"bytes"
+	"fmt"
+	"margo.sh/bolt"
+	"margo.sh/mgpf"
+	"margo.sh/mgutil"
+	"margo.sh/vfs"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// CmdHistoryLimit is the maximum number of commands remembered for each project
+	CmdHistoryLimit = 1000
+
+	// CmdHistoryUserCmds is the number of most frequently run commands
+	// that are added to State.UserCmds during QueryUserCmds
+	CmdHistoryUserCmds = 5
+
+	// cmdHistoryRoots is the list of files or directories that mark the root of a project
+	cmdHistoryRoots = []string{".git", ".hg", "go.mod"}
+)
+
+// CmdHistoryEntry is a command that was run through RunCmd
+type CmdHistoryEntry struct {
+	// ID uniquely identifies the entry in its project's history
+	ID int
+
+	Name string
+	Args []string
+	Dir  string
+
+	// Exit is the exit code of the last process started by the command
+	// or -1 if it didn't exit normally
+	Exit int
+
+	// Error is the error returned by the last process started by the command
+	Error string
+
+	Dur  time.Duration
+	Time time.Time
+}
+
+// Cmd returns the command line of the entry e.g. for display
+func (e CmdHistoryEntry) Cmd() string {
+	return mgutil.QuoteCmd(e.Name, e.Args...)
+}
+
+type cmdHistoryKey struct{ Dir string }
+
+type cmdHistoryState struct {
+	LastID  int
+	Entries []CmdHistoryEntry
+}
+
+// cmdHistory records every RunCmd in bolt.DS, per project directory.
+// It implements the `.history` builtin.
+type cmdHistory struct {
+	ReducerType
+
+	ds    *bolt.DataStore
+	mu    sync.Mutex
+	cache map[string]*cmdHistoryState
+
+	// storeMu serialises writes to ds, which are done without holding mu.
+	// stored is the LastID of the last state stored for each dir.
+	storeMu sync.Mutex
+	stored  map[string]int
+}
+
+func (ch *cmdHistory) Reduce(mx *Ctx) *State {
+	switch mx.Action.(type) {
+	case RunCmd:
+		return mx.State.AddBuiltinCmds(BuiltinCmd{
+			Name: ".history",
+			Desc: "List and search command history, or re-run an entry with -run ID",
+			Run:  ch.historyBuiltin,
+		})
+	case QueryUserCmds:
+		return mx.State.AddUserCmds(ch.userCmds(mx)...)
+	}
+	return mx.State
+}
+
+// begin starts recording the command in cx.
+// The entry is stored when the command closes cx.Output.
+func (ch *cmdHistory) begin(cx *CmdCtx) {
+	rec := &cmdHistoryRecord{
+		ch:   ch,
+		log:  cx.Log,
+		dir:  ch.projectDir(cx.VFS, cx.Wd(cx.View)),
+		skip: cx.Name == ".history",
+	}
+	rec.setCmd(cx.RunCmd, cx.View)
+	rec.entry.Time = time.Now()
+	cx.history = rec
+	cx.Output = &cmdHistoryOutput{OutputStream: cx.Output, rec: rec}
+}
+
+// projectDir returns the closest parent of dir that contains one of cmdHistoryRoots, or dir itself
+func (ch *cmdHistory) projectDir(fs *vfs.FS, dir string) string {
+	if fs == nil || dir == "" {
+		return dir
+	}
+	nd := fs.Closest(dir, func(nd *vfs.Node) bool {
+		for _, s := range cmdHistoryRoots {
+			if _, err := nd.Poke(s).Stat(); err == nil {
+				return true
+			}
+		}
+		return false
+	})
+	if nd == nil {
+		return dir
+	}
+	return nd.Path()
+}
+
+// load returns the history of the project dir. ch.mu must be held.
+//
+// If the history cannot be loaded, it's not cached
+// so that an empty history isn't stored over the existing one.
+func (ch *cmdHistory) load(dir string) (*cmdHistoryState, error) {
+	if st, ok := ch.cache[dir]; ok {
+		return st, nil
+	}
+	st := &cmdHistoryState{}
+	if ch.ds != nil {
+		err := ch.ds.Load(cmdHistoryKey{Dir: dir}, st)
+		if err != nil && err != bolt.ErrNotFound {
+			return nil, fmt.Errorf("cannot load command history for %s: %s", dir, err)
+		}
+	}
+	if ch.cache == nil {
+		ch.cache = map[string]*cmdHistoryState{}
+	}
+	ch.cache[dir] = st
+	return st, nil
+}
+
+// entries returns a copy of the history for the project dir, oldest first
+func (ch *cmdHistory) entries(dir string) ([]CmdHistoryEntry, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	st, err := ch.load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return append([]CmdHistoryEntry(nil), st.Entries...), nil
+}
+
+func (ch *cmdHistory) add(dir string, e CmdHistoryEntry) error {
+	ch.mu.Lock()
+	st, err := ch.load(dir)
+	if err != nil {
+		ch.mu.Unlock()
+		return err
+	}
+	st.LastID++
+	e.ID = st.LastID
+	st.Entries = append(st.Entries, e)
+	if n := len(st.Entries) - CmdHistoryLimit; n > 0 {
+		st.Entries = append(st.Entries[:0:0], st.Entries[n:]...)
+	}
+	// store a copy so readers aren't blocked while it's written to disk
+	snap := cmdHistoryState{
+		LastID:  st.LastID,
+		Entries: append([]CmdHistoryEntry(nil), st.Entries...),
+	}
+	ch.mu.Unlock()
+
+	if ch.ds == nil {
+		return nil
+	}
+	return ch.store(dir, snap)
+}
+
+// store writes st to ds, unless a newer state for dir was already written
+func (ch *cmdHistory) store(dir string, st cmdHistoryState) error {
+	ch.storeMu.Lock()
+	defer ch.storeMu.Unlock()
+
+	if st.LastID <= ch.stored[dir] {
+		return nil
+	}
+	if err := ch.ds.Store(cmdHistoryKey{Dir: dir}, st); err != nil {
+		return err
+	}
+	if ch.stored == nil {
+		ch.stored = map[string]int{}
+	}
+	ch.stored[dir] = st.LastID
+	return nil
+}
+
+func (ch *cmdHistory) userCmds(mx *Ctx) []UserCmd {
+	if CmdHistoryUserCmds <= 0 {
+		return nil
+	}
+
+	type Freq struct {
+		CmdHistoryEntry
+		n int
+	}
+	freqs := map[string]*Freq{}
+	dir := ch.projectDir(mx.VFS, mx.View.Dir())
+	entries, err := ch.entries(dir)
+	if err != nil {
+		mx.Log.Println(err)
+	}
+	for _, e := range entries {
+		k := e.Dir + "\x00" + e.Cmd()
+		if f, ok := freqs[k]; ok {
+			f.n++
+			f.CmdHistoryEntry = e
+		} else {
+			freqs[k] = &Freq{CmdHistoryEntry: e, n: 1}
+		}
+	}
+
+	l := make([]*Freq, 0, len(freqs))
+	for _, f := range freqs {
+		l = append(l, f)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].n != l[j].n {
+			return l[i].n > l[j].n
+		}
+		return l[i].ID > l[j].ID
+	})
+	if len(l) > CmdHistoryUserCmds {
+		l = l[:CmdHistoryUserCmds]
+	}
+
+	cmds := make([]UserCmd, len(l))
+	for i, f := range l {
+		cmds[i] = UserCmd{
+			Title: "History: " + f.Cmd(),
+			Desc:  fmt.Sprintf("run %d times, last exit: %d, dir: %s", f.n, f.Exit, mgutil.ShortFn(f.Dir, mx.Env)),
+			Name:  f.Name,
+			Args:  f.Args,
+			Dir:   f.Dir,
+		}
+	}
+	return cmds
+}
+
+func (ch *cmdHistory) historyBuiltin(cx *CmdCtx) *State {
+	fs := cx.Flags()
+	fs.SetOutput(cx.Output)
+	qry := fs.String("q", "", "only list commands containing this string")
+	limit := fs.Int("n", 20, "list at most this many entries")
+	failed := fs.Bool("failed", false, "only list commands that failed")
+	here := fs.Bool("here", false, "only list commands run in the current directory")
+	run := fs.Int("run", 0, "re-run the entry with this ID")
+	if err := fs.Parse(); err != nil {
+		cx.Output.Close()
+		return cx.State
+	}
+
+	wd := cx.Wd(cx.View)
+	dir := ch.projectDir(cx.VFS, wd)
+	entries, err := ch.entries(dir)
+	if err != nil {
+		fmt.Fprintln(cx.Output, err)
+		cx.Output.Close()
+		return cx.State
+	}
+
+	if *run > 0 {
+		for _, e := range entries {
+			if e.ID != *run {
+				continue
+			}
+			fmt.Fprintln(cx.Output, "#", e.Cmd())
+			if rec := cx.history; rec != nil {
+				rec.rerun(e)
+			}
+			return cx.Copy(func(x *CmdCtx) {
+				rc := x.RunCmd
+				rc.Name = e.Name
+				rc.Args = append([]string(nil), e.Args...)
+				rc.Dir = e.Dir
+				x.RunCmd = rc
+			}).Run()
+		}
+		defer cx.Output.Close()
+		fmt.Fprintf(cx.Output, "history entry %d not found\n", *run)
+		return cx.State
+	}
+
+	defer cx.Output.Close()
+	buf := &bytes.Buffer{}
+	matches := make([]CmdHistoryEntry, 0, len(entries))
+	for _, e := range entries {
+		switch {
+		case *qry != "" && !strings.Contains(e.Cmd(), *qry):
+		case *failed && e.Exit == 0:
+		case *here && e.Dir != wd:
+		default:
+			matches = append(matches, e)
+		}
+	}
+	if n := len(matches) - *limit; *limit > 0 && n > 0 {
+		matches = matches[n:]
+	}
+	for _, e := range matches {
+		fmt.Fprintf(buf, "%5d  %s  exit: %d, dur: %s", e.ID, e.Time.Format("2006-01-02 15:04:05"), e.Exit, mgpf.D(e.Dur))
+		if e.Dir != dir {
+			if rel, err := filepath.Rel(dir, e.Dir); err == nil {
+				fmt.Fprintf(buf, ", dir: %s", rel)
+			}
+		}
+		fmt.Fprintf(buf, "  `%s`\n", e.Cmd())
+	}
+	cx.Output.Write(buf.Bytes())
+	return cx.State
+}
+
+// cmdHistoryRecord holds the details of a running command
+type cmdHistoryRecord struct {
+	ch   *cmdHistory
+	log  *Logger
+	dir  string
+	once sync.Once
+
+	mu    sync.Mutex
+	skip  bool
+	entry CmdHistoryEntry
+}
+
+func (rec *cmdHistoryRecord) setCmd(rc RunCmd, v *View) {
+	rec.entry.Name = rc.Name
+	rec.entry.Args = append([]string(nil), rc.Args...)
+	rec.entry.Dir = rc.Wd(v)
+}
+
+// rerun updates the record to store the command of entry e instead of `.history`
+func (rec *cmdHistoryRecord) rerun(e CmdHistoryEntry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.skip = false
+	rec.entry.Name = e.Name
+	rec.entry.Args = e.Args
+	rec.entry.Dir = e.Dir
+}
+
+// exited records the error returned by a process started by the command
+func (rec *cmdHistoryRecord) exited(err error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.entry.Exit = 0
+	rec.entry.Error = ""
+	if err == nil {
+		return
+	}
+	rec.entry.Exit = -1
+	rec.entry.Error = err.Error()
+	if e, ok := err.(*exec.ExitError); ok {
+		rec.entry.Exit = e.ExitCode()
+	}
+}
+
+func (rec *cmdHistoryRecord) done() {
+	rec.once.Do(func() {
+		rec.mu.Lock()
+		e := rec.entry
+		skip := rec.skip
+		rec.mu.Unlock()
+
+		if skip {
+			return
+		}
+		e.Dur = time.Since(e.Time)
+		if err := rec.ch.add(rec.dir, e); err != nil && rec.log != nil {
+			rec.log.Println("cannot store command history:", err)
+		}
+	})
+}
+
+// cmdHistoryOutput stores the command's history entry when it's closed
+type cmdHistoryOutput struct {
+	OutputStream
+	rec *cmdHistoryRecord
+}
+
+func (cho *cmdHistoryOutput) Close() error {
+	defer cho.rec.done()
+	return cho.OutputStream.Close()
+}
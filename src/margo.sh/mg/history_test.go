@@ -0,0 +1,62 @@
+package mg
+
+import (
+	"errors"
+	"github.com/ugorji/go/codec"
+	"io/ioutil"
+	"margo.sh/bolt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCmdHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "margo-history-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ds := &bolt.DataStore{
+		Path:   filepath.Join(dir, "bolt.ds"),
+		Handle: &codec.MsgpackHandle{},
+		Bucket: []byte("ds"),
+	}
+	ch := &cmdHistory{ds: ds}
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	run := func(name string, err error, args ...string) {
+		cx := &CmdCtx{
+			Ctx:    mx,
+			RunCmd: RunCmd{Name: name, Args: args, Dir: dir},
+			Output: &CmdOut{},
+		}
+		ch.begin(cx)
+		cx.history.exited(err)
+		cx.Output.Close()
+	}
+	run("go", nil, "test")
+	run("go", errors.New("boom"), "vet")
+	run("go", nil, "test")
+	run(".history", nil)
+
+	// a new instance should load the history from the DataStore
+	ch = &cmdHistory{ds: ds}
+	l, err := ch.entries(dir)
+	if err != nil {
+		t.Fatalf("cannot load history: %s", err)
+	}
+	if len(l) != 3 {
+		t.Fatalf("expected 3 history entries, got %d: %#v", len(l), l)
+	}
+	if e := l[1]; e.ID != 2 || e.Cmd() != "go vet" || e.Exit != -1 || e.Error != "boom" || e.Dir != dir {
+		t.Errorf("unexpected history entry %#v", e)
+	}
+
+	mx = mx.SetState(mx.State.SetView(mx.View.Copy(func(v *View) { v.Path = filepath.Join(dir, "x.go") })))
+	cmds := ch.userCmds(mx)
+	if len(cmds) != 2 || cmds[0].Title != "History: go test" || cmds[1].Title != "History: go vet" {
+		t.Errorf("expected the most frequent commands first, got %#v", cmds)
+	}
+}
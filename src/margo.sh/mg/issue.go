@@ -8,9 +8,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -228,18 +230,85 @@ type IssueKey struct {
 	Dir  string
 }
 
+// less orders keys by Path, Name, Dir and then the printed value of Key
+func (k IssueKey) less(p IssueKey) bool {
+	switch {
+	case k.Path != p.Path:
+		return k.Path < p.Path
+	case k.Name != p.Name:
+		return k.Name < p.Name
+	case k.Dir != p.Dir:
+		return k.Dir < p.Dir
+	}
+	return fmt.Sprint(k.Key) < fmt.Sprint(p.Key)
+}
+
+// issueDeltaTTL is how long the new/fixed notification is shown after a change
+const issueDeltaTTL = 5 * time.Second
+
+// issueDelta records the issues that were added or fixed by a StoreIssues action
+type issueDelta struct {
+	label string
+	added IssueSet
+	fixed IssueSet
+	ts    time.Time
+}
+
+func diffIssues(prev, next IssueSet) issueDelta {
+	d := issueDelta{
+		added: next.Remove(prev...),
+		fixed: prev.Remove(next...),
+	}
+	for _, s := range []IssueSet{d.added, d.fixed} {
+		if len(s) != 0 && d.label == "" {
+			d.label = s[0].Label
+		}
+	}
+	if d.label == "" {
+		d.label = "Issues"
+	}
+	return d
+}
+
+func (d issueDelta) empty() bool {
+	return len(d.added) == 0 && len(d.fixed) == 0
+}
+
+func (d issueDelta) status() string {
+	return fmt.Sprintf("%s: +%d new, −%d fixed", d.label, len(d.added), len(d.fixed))
+}
+
+func (d issueDelta) render(st *State) *State {
+	st = st.AddStatus(d.status())
+	if len(d.added) == 0 {
+		return st
+	}
+	els := make([]htm.Element, len(d.added))
+	for i, isu := range d.added {
+		els[i] = htm.Text(isu.Error())
+	}
+	return st.AddHUD(htm.Textf("New Issues ( %s )", d.label), els...)
+}
+
 type issueKeySupport struct {
 	ReducerType
 	issues map[IssueKey]IssueSet
+	deltas map[IssueKey]issueDelta
 }
 
 func (iks *issueKeySupport) RMount(mx *Ctx) {
 	iks.issues = map[IssueKey]IssueSet{}
+	iks.deltas = map[IssueKey]issueDelta{}
 }
 
 func (iks *issueKeySupport) Reduce(mx *Ctx) *State {
 	switch act := mx.Action.(type) {
 	case StoreIssues:
+		d := diffIssues(iks.issues[act.IssueKey], act.Issues)
+		if !d.empty() {
+			d.ts = time.Now()
+			iks.deltas[act.IssueKey] = d
+		}
 		if len(act.Issues) == 0 {
 			delete(iks.issues, act.IssueKey)
 		} else {
@@ -277,7 +346,23 @@ func (iks *issueKeySupport) Reduce(mx *Ctx) *State {
 		}
 	}
 
-	return mx.State.AddIssues(issues...)
+	deltaKeys := []IssueKey{}
+	for k, d := range iks.deltas {
+		if time.Since(d.ts) >= issueDeltaTTL {
+			delete(iks.deltas, k)
+			continue
+		}
+		if match(k) {
+			deltaKeys = append(deltaKeys, k)
+		}
+	}
+	sort.Slice(deltaKeys, func(i, j int) bool { return deltaKeys[i].less(deltaKeys[j]) })
+	st := mx.State
+	for _, k := range deltaKeys {
+		st = iks.deltas[k].render(st)
+	}
+
+	return st.AddIssues(issues...)
 }
 
 type issueStatusSupport struct {
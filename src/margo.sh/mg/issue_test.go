@@ -4,6 +4,7 @@ package mg
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -32,6 +33,48 @@ func TestIssueWriter(t *testing.T) {
 	}
 }
 
+func TestDiffIssues(t *testing.T) {
+	a := Issue{Path: "/a.go", Row: 1, Label: "Go/TypeCheck", Message: "a"}
+	b := Issue{Path: "/a.go", Row: 2, Label: "Go/TypeCheck", Message: "b"}
+	c := Issue{Path: "/a.go", Row: 3, Label: "Go/TypeCheck", Message: "c"}
+
+	d := diffIssues(IssueSet{a, b}, IssueSet{b, c})
+	if !d.added.Equal(IssueSet{c}) {
+		t.Errorf("diffIssues: expected added %v, got %v", IssueSet{c}, d.added)
+	}
+	if !d.fixed.Equal(IssueSet{a}) {
+		t.Errorf("diffIssues: expected fixed %v, got %v", IssueSet{a}, d.fixed)
+	}
+	if s, want := d.status(), "Go/TypeCheck: +1 new, −1 fixed"; s != want {
+		t.Errorf("diffIssues: expected status %q, got %q", want, s)
+	}
+	if d := diffIssues(IssueSet{a}, IssueSet{a}); !d.empty() {
+		t.Errorf("diffIssues: expected no changes, got %#v", d)
+	}
+}
+
+func TestIssueDeltasMatchView(t *testing.T) {
+	iks := &issueKeySupport{}
+	mx := NewTestingCtx(nil)
+	iks.RMount(mx)
+	mx = mx.SetView(mx.View.Copy(func(v *View) { v.Path = "/b/b.go" }))
+	var st *State
+	store := func(k IssueKey, lbl string) {
+		isu := Issue{Path: k.Path, Label: lbl, Message: "x"}
+		st = iks.Reduce(mx.Copy(func(mx *Ctx) {
+			mx.Action = StoreIssues{IssueKey: k, Issues: IssueSet{isu}}
+		}))
+	}
+	store(IssueKey{Path: "/c/c.go"}, "C")
+	store(IssueKey{Path: "/b/b.go"}, "B")
+	store(IssueKey{Key: "2"}, "Y")
+	store(IssueKey{Key: "1"}, "X")
+	want := StrSet{"X: +1 new, −0 fixed", "Y: +1 new, −0 fixed", "B: +1 new, −0 fixed"}
+	if !reflect.DeepEqual(st.Status, want) {
+		t.Errorf("expected status %q, got %q", want, st.Status)
+	}
+}
+
 func BenchmarkIssueSetAdd(b *testing.B) {
 	// if we make a syntax error at the top of a large file
 	// we can end up with thousands of errors
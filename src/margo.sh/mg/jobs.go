@@ -0,0 +1,179 @@
+package mg
+
+import (
+	"bytes"
+	"fmt"
+	"margo.sh/mgpf"
+	"margo.sh/mgutil"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	// TaskHistoryLimit is the number of finished tasks that are kept for the job control builtins
+	TaskHistoryLimit = 32
+)
+
+// find returns the active or finished task identified by tid
+// tid is either the task's ID or its CancelID
+//
+// tr.mu must be held by the caller
+func (tr *taskTracker) find(tid string) *TaskTicket {
+	for _, t := range tr.tickets {
+		if t.ID == tid || t.CancelID == tid {
+			return t
+		}
+	}
+	for i := len(tr.finished) - 1; i >= 0; i-- {
+		if t := tr.finished[i]; t.ID == tid || t.CancelID == tid {
+			return t
+		}
+	}
+	return nil
+}
+
+// lookup is the locked equivalent of find
+func (tr *taskTracker) lookup(tid string) *TaskTicket {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return tr.find(tid)
+}
+
+// status returns the status of the task and its exit code if it finished
+//
+// tr.mu must be held by the caller
+func (t *TaskTicket) status() (status string, exit int) {
+	switch {
+	case t.queued:
+		return "queued", 0
+	case t.end.IsZero():
+		return "running", 0
+	case t.canceled:
+		return "canceled", -1
+	case t.err == nil:
+		return "done", 0
+	}
+	if e, ok := t.err.(*exec.ExitError); ok {
+		return "failed", e.ExitCode()
+	}
+	return "failed", -1
+}
+
+func (tr *taskTracker) jobsBuiltin(cx *CmdCtx) *State {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	defer cx.Output.Close()
+	buf := &bytes.Buffer{}
+	now := time.Now()
+	for _, l := range [][]*TaskTicket{tr.finished, tr.tickets} {
+		for _, t := range l {
+			id := t.ID
+			if t.CancelID != "" && t.CancelID != t.ID {
+				id += "|" + t.CancelID
+			}
+			end := t.end
+			if end.IsZero() {
+				end = now
+			}
+			status, exit := t.status()
+			fmt.Fprintf(buf, "ID: %s, Status: %s, Exit: %d, Dur: %s, Title: %s\n", id, status, exit, mgpf.D(end.Sub(t.Start)), t.Title)
+			if t.err != nil && status == "failed" {
+				fmt.Fprintf(buf, "\tError: %s\n", t.err)
+			}
+		}
+	}
+	cx.Output.Write(buf.Bytes())
+	return cx.State
+}
+
+func (tr *taskTracker) outputBuiltin(cx *CmdCtx) *State {
+	defer cx.Output.Close()
+
+	if len(cx.Args) != 1 {
+		fmt.Fprintln(cx.Output, "usage: .output <task ID>")
+		return cx.State
+	}
+	t := tr.lookup(cx.Args[0])
+	switch {
+	case t == nil:
+		fmt.Fprintf(cx.Output, "task %s not found\n", cx.Args[0])
+	case t.Output == nil:
+		fmt.Fprintf(cx.Output, "task %s has no buffered output\n", cx.Args[0])
+	default:
+		cx.Output.Write(t.Output())
+	}
+	return cx.State
+}
+
+func (tr *taskTracker) waitBuiltin(cx *CmdCtx) *State {
+	canceled := make(chan struct{})
+	once := sync.Once{}
+	task := cx.Begin(Task{
+		Title:    "`" + mgutil.QuoteCmd(cx.Name, cx.Args...) + "`",
+		CancelID: cx.CancelID,
+		Cancel:   func() { once.Do(func() { close(canceled) }) },
+		Fd:       cx.Fd,
+	})
+	go func() {
+		defer cx.Output.Close()
+		defer task.Done()
+
+		for _, tid := range cx.Args {
+			t := tr.lookup(tid)
+			if t == nil {
+				fmt.Fprintf(cx.Output, "%s: not found\n", tid)
+				continue
+			}
+			select {
+			case <-t.done:
+			case <-canceled:
+				fmt.Fprintf(cx.Output, "%s: wait canceled\n", tid)
+				return
+			}
+
+			tr.mu.Lock()
+			status, exit := t.status()
+			tr.mu.Unlock()
+			fmt.Fprintf(cx.Output, "%s: %s, exit: %d\n", tid, status, exit)
+		}
+	}()
+	return cx.State
+}
+
+func (tr *taskTracker) restartBuiltin(cx *CmdCtx) *State {
+	if len(cx.Args) != 1 {
+		defer cx.Output.Close()
+		fmt.Fprintln(cx.Output, "usage: .restart <task ID>")
+		return cx.State
+	}
+
+	tid := cx.Args[0]
+	tr.mu.Lock()
+	t := tr.find(tid)
+	if t != nil && t.end.IsZero() {
+		// the old task is interrupted, but we do not wait for it to exit
+		tr.cancel(t.ID)
+	}
+	tr.mu.Unlock()
+
+	switch {
+	case t == nil:
+		defer cx.Output.Close()
+		fmt.Fprintf(cx.Output, "task %s not found\n", tid)
+		return cx.State
+	case t.Cmd.Name == "":
+		defer cx.Output.Close()
+		fmt.Fprintf(cx.Output, "task %s was not started by a command\n", tid)
+		return cx.State
+	}
+
+	return cx.Copy(func(x *CmdCtx) {
+		rc := t.Cmd
+		rc.Fd = x.Fd
+		rc.Args = append([]string(nil), rc.Args...)
+		x.RunCmd = rc
+	}).Run()
+}
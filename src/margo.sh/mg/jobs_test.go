@@ -0,0 +1,86 @@
+// +build !windows
+
+package mg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobControl(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	tr := mx.Store.tasks
+	cx := &CmdCtx{
+		Ctx:    mx,
+		RunCmd: RunCmd{Name: "sh", Args: []string{"-c", "echo hi; exit 3"}, CancelID: "job"},
+		Output: &CmdOut{},
+	}
+	p, err := cx.StartProc()
+	if err != nil {
+		t.Fatalf("cannot start process: %s", err)
+	}
+	p.Wait()
+
+	run := func(f BuiltinCmdRunFunc, args ...string) string {
+		return runJobBuiltin(cx, "", f, args...)
+	}
+
+	if s := run(tr.waitBuiltin, "job"); s != "job: failed, exit: 3\n" {
+		t.Errorf("unexpected .wait output `%q`", s)
+	}
+	if s := run(tr.jobsBuiltin); !strings.Contains(s, "Status: failed, Exit: 3") {
+		t.Errorf("expected .jobs to list the failed task, got `%q`", s)
+	}
+	if s := run(tr.outputBuiltin, "job"); s != "hi\n" {
+		t.Errorf("expected .output to replay `hi\\n`, got `%q`", s)
+	}
+}
+
+func TestJobControlCancelWait(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	tr := mx.Store.tasks
+	cx := &CmdCtx{
+		Ctx:    mx,
+		RunCmd: RunCmd{Name: "sleep", Args: []string{"10"}, CancelID: "sleeper"},
+		Output: &CmdOut{},
+	}
+	p, err := cx.StartProc()
+	if err != nil {
+		t.Fatalf("cannot start process: %s", err)
+	}
+	defer p.Cancel()
+
+	go func() {
+		for !tr.Cancel("waiter") {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	if s := runJobBuiltin(cx, "waiter", tr.waitBuiltin, "sleeper"); s != "sleeper: wait canceled\n" {
+		t.Errorf("unexpected .wait output `%q`", s)
+	}
+}
+
+// runJobBuiltin runs the builtin f with args and returns its output once it's closed
+func runJobBuiltin(cx *CmdCtx, cancelID string, f BuiltinCmdRunFunc, args ...string) string {
+	out := &CmdOut{}
+	f(cx.Copy(func(x *CmdCtx) {
+		x.Args = args
+		x.CancelID = cancelID
+		x.Output = out
+	}))
+	// some builtins close the output in a goroutine
+	s := []byte{}
+	for {
+		o := out.Output()
+		s = append(s, o.Output...)
+		if o.Close {
+			return string(s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,233 @@
+package mg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"margo.sh/mgpf"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	// ProcKillGracePeriod is how long a process is given to exit after being interrupted
+	// because it exceeded one of its ProcLimits, before it's killed.
+	ProcKillGracePeriod = 5 * time.Second
+
+	// CmdLimits is the list of default limits for commands run through RunCmd, including builtins,
+	// that don't set RunCmd.Limits.
+	//
+	// The key is either the command name e.g. `go`, or the name followed by its first arg e.g. `go test`.
+	// The latter takes precedence.
+	CmdLimits = map[string]ProcLimits{}
+
+	// oomMessages is a list of messages that programs commonly print when they fail to allocate memory
+	oomMessages = [][]byte{
+		[]byte("out of memory"),
+		[]byte("cannot allocate memory"),
+		[]byte("bad_alloc"),
+		[]byte("memoryerror"),
+	}
+)
+
+// ProcLimits describes the resource limits of a process.
+//
+// A zero value for any field means no limit.
+type ProcLimits struct {
+	// Timeout is the maximum wall-clock time the process may run for.
+	Timeout time.Duration
+
+	// CPUTime is the maximum CPU time the process may use.
+	// It's implemented using RLIMIT_CPU, set before the command is executed, and is only supported on Linux.
+	CPUTime time.Duration
+
+	// AddressSpace is the maximum size of the process' virtual memory in bytes.
+	// It's implemented using RLIMIT_AS, set before the command is executed, and is only supported on Linux.
+	AddressSpace int64
+
+	// MaxOutput is the maximum number of bytes the process may write to stdout and stderr.
+	MaxOutput int64
+}
+
+// IsZero returns true if no limits are set
+func (pl ProcLimits) IsZero() bool {
+	return pl == ProcLimits{}
+}
+
+// cmdLimits returns the limits of the command name, run with args.
+// If limits is not zero, it's returned as-is, otherwise the default from CmdLimits is returned.
+func cmdLimits(limits ProcLimits, name string, args []string) ProcLimits {
+	if !limits.IsZero() {
+		return limits
+	}
+	if len(args) != 0 {
+		if pl, ok := CmdLimits[name+" "+args[0]]; ok {
+			return pl
+		}
+	}
+	return CmdLimits[name]
+}
+
+// procLimiter enforces ProcLimits on a command
+type procLimiter struct {
+	ProcLimits
+
+	mu      sync.Mutex
+	proc    *os.Process
+	timer   *time.Timer
+	written int64
+	reason  string
+
+	// oom is set if the output looks like the process failed to allocate memory.
+	// tail is the end of the last write, so messages split across writes are found.
+	oom  bool
+	tail []byte
+}
+
+func newProcLimiter(pl ProcLimits) *procLimiter {
+	if pl.IsZero() {
+		return nil
+	}
+	return &procLimiter{ProcLimits: pl}
+}
+
+// writer returns a writer that writes to w and kills the process if MaxOutput is exceeded.
+// If AddressSpace is set, the output is also checked for out-of-memory errors.
+func (lim *procLimiter) writer(w io.Writer) io.Writer {
+	if lim == nil || (lim.MaxOutput <= 0 && lim.AddressSpace <= 0) {
+		return w
+	}
+	return limitWriter{w: w, lim: lim}
+}
+
+// start starts the timeout timer for the process p
+func (lim *procLimiter) start(p *os.Process) {
+	if lim == nil {
+		return
+	}
+
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	lim.proc = p
+	if d := lim.Timeout; d > 0 {
+		lim.timer = time.AfterFunc(d, func() {
+			lim.exceeded(fmt.Sprintf("wall-clock timeout of %s exceeded", mgpf.D(d)))
+		})
+	}
+}
+
+// stop stops the timer and returns a description of the limit that was exceeded, if any.
+func (lim *procLimiter) stop(ps *os.ProcessState) string {
+	if lim == nil {
+		return ""
+	}
+
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	if lim.timer != nil {
+		lim.timer.Stop()
+	}
+	if lim.reason == "" && lim.CPUTime > 0 && ps != nil && cpuLimitExceeded(ps) {
+		lim.reason = fmt.Sprintf("CPU time limit of %s exceeded", mgpf.D(lim.CPUTime))
+	}
+	if lim.reason == "" && lim.AddressSpace > 0 && ps != nil && !ps.Success() && (lim.oom || crashed(ps)) {
+		lim.reason = fmt.Sprintf("address space limit of %d bytes probably exceeded", lim.AddressSpace)
+	}
+	return lim.reason
+}
+
+// exceeded records the reason and kills the process
+func (lim *procLimiter) exceeded(reason string) {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	if lim.reason != "" || lim.proc == nil {
+		return
+	}
+	lim.reason = reason
+	p := lim.proc
+	pgKill(p)
+	time.AfterFunc(ProcKillGracePeriod, func() { p.Kill() })
+}
+
+type limitWriter struct {
+	w   io.Writer
+	lim *procLimiter
+}
+
+func (lw limitWriter) Write(p []byte) (int, error) {
+	lim := lw.lim
+	lim.mu.Lock()
+	if lim.AddressSpace > 0 && !lim.oom {
+		lim.checkOOM(p)
+	}
+	n := int64(len(p))
+	if lim.MaxOutput > 0 {
+		if rem := lim.MaxOutput - lim.written; n > rem {
+			n = rem
+		}
+		if n < 0 {
+			n = 0
+		}
+	}
+	lim.written += n
+	over := int(n) < len(p)
+	lim.mu.Unlock()
+
+	if n > 0 {
+		lw.w.Write(p[:n])
+	}
+	if over {
+		lim.exceeded(fmt.Sprintf("output limit of %d bytes exceeded", lim.MaxOutput))
+	}
+	// report the full length so the process doesn't see a write error before it's killed
+	return len(p), nil
+}
+
+// checkOOM sets lim.oom if p, following the previous output, contains one of oomMessages.
+// lim.mu must be held.
+func (lim *procLimiter) checkOOM(p []byte) {
+	s := bytes.ToLower(append(lim.tail, p...))
+	for _, m := range oomMessages {
+		if bytes.Contains(s, m) {
+			lim.oom = true
+			return
+		}
+	}
+	if n := 32; len(s) > n {
+		s = s[len(s)-n:]
+	}
+	lim.tail = append(lim.tail[:0], s...)
+}
+
+// limitIssue returns an Issue reporting that the command titled title exceeded a limit
+func limitIssue(v *View, label, title, reason string) Issue {
+	return Issue{
+		Path:    v.Path,
+		Name:    v.Name,
+		Tag:     Warning,
+		Label:   label,
+		Message: fmt.Sprintf("%s was stopped: %s", title, reason),
+	}
+}
+
+type procLimitIssueKey struct{ Title string }
+
+// startLimited is like cmd.Start, but applies the limits in lim.
+// The rlimits are set before cmd is executed, so they also apply to any process it starts.
+func startLimited(cmd *exec.Cmd, lim *procLimiter) error {
+	if lim != nil {
+		if err := limitCmd(cmd, lim.ProcLimits); err != nil {
+			return fmt.Errorf("cannot set resource limits: %s", err)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	lim.start(cmd.Process)
+	return nil
+}
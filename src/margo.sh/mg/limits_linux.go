@@ -0,0 +1,61 @@
+// +build linux
+
+package mg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// limitCmd arranges for the CPUTime and AddressSpace limits to be set in the child process before cmd is executed.
+//
+// The limits are set by a `/bin/sh` wrapper using `ulimit`, which then execs the original command
+// so that any process it starts is also limited.
+func limitCmd(cmd *exec.Cmd, pl ProcLimits) error {
+	var l []string
+	if d := pl.CPUTime; d > 0 {
+		secs := int64((d + time.Second - 1) / time.Second)
+		// the soft limit sends SIGXCPU, the hard limit SIGKILL.
+		// the soft limit is set first because it must not be greater than the hard limit
+		l = append(l, fmt.Sprintf("ulimit -S -t %d", secs), fmt.Sprintf("ulimit -H -t %d", secs+1))
+	}
+	if n := pl.AddressSpace; n > 0 {
+		l = append(l, fmt.Sprintf("ulimit -v %d", (n+1023)/1024))
+	}
+	if len(l) == 0 {
+		return nil
+	}
+	if !strings.ContainsRune(cmd.Path, '/') {
+		// exec.Command failed to find the executable, so report the same error that cmd.Start would
+		if _, err := exec.LookPath(cmd.Path); err != nil {
+			return err
+		}
+	}
+	script := strings.Join(l, " && ") + ` && exec "$0" "$@"`
+	cmd.Args = append([]string{"sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
+
+// cpuLimitExceeded returns true if the process was killed by the RLIMIT_CPU limit
+func cpuLimitExceeded(ps *os.ProcessState) bool {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	return ok && ws.Signaled() && ws.Signal() == syscall.SIGXCPU
+}
+
+// crashed returns true if the process was killed by a signal that's usually the result of failing to allocate memory
+func crashed(ps *os.ProcessState) bool {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return false
+	}
+	switch ws.Signal() {
+	case syscall.SIGSEGV, syscall.SIGBUS, syscall.SIGABRT:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package mg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcLimitsCPUTime(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	out := &CmdOut{}
+	cx := &CmdCtx{
+		Ctx: mx,
+		RunCmd: RunCmd{
+			Name:   "sh",
+			Args:   []string{"-c", "while :; do :; done"},
+			Limits: ProcLimits{CPUTime: time.Second, Timeout: 10 * time.Second},
+		},
+		Output: out,
+	}
+	p, err := cx.StartProc()
+	if err != nil {
+		t.Fatalf("cannot start process: %s", err)
+	}
+	if err := p.Wait(); err == nil {
+		t.Fatalf("expected process to fail")
+	}
+	if s := string(out.Output().Output); !strings.Contains(s, "CPU time limit") {
+		t.Fatalf("expected output to report the CPU time limit, got %q", s)
+	}
+}
+
+func TestProcLimitsBeforeExec(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	out := &CmdOut{}
+	cx := &CmdCtx{
+		Ctx: mx,
+		RunCmd: RunCmd{
+			Name:   "sh",
+			Args:   []string{"-c", "ulimit -t; ulimit -v"},
+			Limits: ProcLimits{CPUTime: 5 * time.Second, AddressSpace: 1 << 30},
+		},
+		Output: out,
+	}
+	p, err := cx.StartProc()
+	if err != nil {
+		t.Fatalf("cannot start process: %s", err)
+	}
+	p.Wait()
+	// the limits are inherited from the wrapper, so they're visible to the command itself
+	if s, want := string(out.Output().Output), "5\n1048576\n"; s != want {
+		t.Fatalf("expected the limits to be set before exec: want %q, got %q", want, s)
+	}
+}
+
+func TestProcLimitsAddressSpace(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	out := &CmdOut{}
+	cx := &CmdCtx{
+		Ctx: mx,
+		RunCmd: RunCmd{
+			Name:   "sh",
+			Args:   []string{"-c", "echo 'fatal error: out of memory' >&2; exit 2"},
+			Limits: ProcLimits{AddressSpace: 1 << 30},
+		},
+		Output: out,
+	}
+	p, err := cx.StartProc()
+	if err != nil {
+		t.Fatalf("cannot start process: %s", err)
+	}
+	p.Wait()
+	if s := string(out.Output().Output); !strings.Contains(s, "address space limit") {
+		t.Fatalf("expected output to report the address space limit, got %q", s)
+	}
+}
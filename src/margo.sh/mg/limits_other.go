@@ -0,0 +1,24 @@
+// +build !linux
+
+package mg
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func limitCmd(cmd *exec.Cmd, pl ProcLimits) error {
+	if pl.CPUTime > 0 || pl.AddressSpace > 0 {
+		return errors.New("CPUTime and AddressSpace limits are only supported on Linux")
+	}
+	return nil
+}
+
+func cpuLimitExceeded(ps *os.ProcessState) bool {
+	return false
+}
+
+func crashed(ps *os.ProcessState) bool {
+	return false
+}
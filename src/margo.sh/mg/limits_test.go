@@ -0,0 +1,100 @@
+// +build !windows
+
+package mg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		args   []string
+		limits ProcLimits
+		reason string
+	}{
+		{
+			name:   "timeout",
+			args:   []string{"-c", "sleep 10"},
+			limits: ProcLimits{Timeout: 100 * time.Millisecond},
+			reason: "wall-clock timeout",
+		},
+		{
+			name:   "output",
+			args:   []string{"-c", "while :; do echo 0123456789; done"},
+			limits: ProcLimits{MaxOutput: 100},
+			reason: "output limit of 100 bytes",
+		},
+		{
+			name:   "ok",
+			args:   []string{"-c", "echo ok"},
+			limits: ProcLimits{Timeout: 10 * time.Second, MaxOutput: 100},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mx := NewTestingCtx(nil)
+			defer mx.Cancel()
+
+			out := &CmdOut{}
+			cx := &CmdCtx{
+				Ctx:    mx,
+				RunCmd: RunCmd{Name: "sh", Args: c.args, Limits: c.limits},
+				Output: out,
+			}
+			p, err := cx.StartProc()
+			if err != nil {
+				t.Fatalf("cannot start process: %s", err)
+			}
+
+			start := time.Now()
+			err = p.Wait()
+			if d := time.Since(start); d > 5*time.Second {
+				t.Fatalf("process ran for %s, expected it to be stopped", d)
+			}
+			s := string(out.Output().Output)
+			if c.reason == "" {
+				if err != nil || strings.Contains(s, "was stopped") {
+					t.Fatalf("expected process to succeed, got err: %v, output: %q", err, s)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected process to fail")
+			}
+			if !strings.Contains(s, c.reason) {
+				t.Fatalf("expected output to contain %q, got %q", c.reason, s)
+			}
+			if c.limits.MaxOutput > 0 && len(s) > int(c.limits.MaxOutput)+200 {
+				t.Fatalf("output was not limited, got %d bytes", len(s))
+			}
+		})
+	}
+}
+
+func TestCmdLimits(t *testing.T) {
+	defer func(m map[string]ProcLimits) { CmdLimits = m }(CmdLimits)
+	CmdLimits = map[string]ProcLimits{
+		"go":      {Timeout: time.Minute},
+		"go test": {Timeout: time.Hour},
+	}
+	cases := []struct {
+		limits ProcLimits
+		name   string
+		args   []string
+		want   time.Duration
+	}{
+		{name: "go", args: []string{"test", "./..."}, want: time.Hour},
+		{name: "go", args: []string{"vet"}, want: time.Minute},
+		{name: "go", want: time.Minute},
+		{name: "make", want: 0},
+		{limits: ProcLimits{Timeout: time.Second}, name: "go", args: []string{"test"}, want: time.Second},
+	}
+	for _, c := range cases {
+		if got := cmdLimits(c.limits, c.name, c.args).Timeout; got != c.want {
+			t.Errorf("cmdLimits(%v, %q, %q): want Timeout %s, got %s", c.limits, c.name, c.args, c.want, got)
+		}
+	}
+}
@@ -20,6 +20,9 @@ type Linter struct {
 	Label    string
 	TempDir  []string
 
+	// Limits is the list of resource limits applied to the linter process
+	Limits ProcLimits
+
 	q *mgutil.ChanQ
 }
 
@@ -113,17 +116,29 @@ func (lt *Linter) lint(mx *Ctx) {
 		Base:     Issue{Label: lt.Label, Tag: lt.Tag},
 	}
 
+	lim := newProcLimiter(lt.Limits)
 	cmd := exec.Command(lt.Name, lt.Args...)
-	cmd.Stdout = iw
-	cmd.Stderr = iw
+	cmd.Stdout = lim.writer(iw)
+	cmd.Stderr = cmd.Stdout
 	cmd.Env = mx.Env.Environ()
 	cmd.Dir = dir
+	if lim != nil {
+		cmd.SysProcAttr = pgSysProcAttr
+	}
 
-	if err := cmd.Start(); err != nil {
+	if err := startLimited(cmd, lim); err != nil {
 		mx.Log.Printf("cannot start linter `%s`: %s", cmdStr, err)
 		return
 	}
 	cmd.Wait()
 	iw.Close()
 	res.Issues = iw.Issues()
+	if reason := lim.stop(cmd.ProcessState); reason != "" {
+		mx.Log.Printf("linter `%s` was stopped: %s\n", cmdStr, reason)
+		lbl := lt.Label
+		if lbl == "" {
+			lbl = lt.Name
+		}
+		res.Issues = res.Issues.Add(limitIssue(mx.View, lbl, "`"+cmdStr+"`", reason))
+	}
 }
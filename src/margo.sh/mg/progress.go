@@ -0,0 +1,146 @@
+package mg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TaskPriority is the priority of a Task
+type TaskPriority int
+
+const (
+	// TaskPriorityLow is the priority of background work e.g. scanning or preloading packages.
+	// Only TaskLowPriorityLimit of these tasks run concurrently in each Task.Group.
+	TaskPriorityLow TaskPriority = -1
+
+	// TaskPriorityNormal is the default priority
+	TaskPriorityNormal TaskPriority = 0
+
+	// TaskPriorityHigh is the priority of tasks the user is actively waiting on
+	TaskPriorityHigh TaskPriority = 1
+)
+
+var (
+	// TaskLowPriorityLimit is the number of TaskPriorityLow tasks in the same Task.Group that may run concurrently
+	TaskLowPriorityLimit = 2
+)
+
+// TaskProgress describes how far along a task is
+type TaskProgress struct {
+	// N is the number of steps completed
+	N int
+
+	// Total is the total number of steps, or 0 if it's not known
+	Total int
+
+	// Fraction is the fraction of the task completed, in the range [0, 1].
+	// It's ignored if Total is set.
+	Fraction float64
+
+	// Status is a short description of what the task is currently doing
+	Status string
+}
+
+// IsZero returns true if no progress was reported
+func (tp TaskProgress) IsZero() bool {
+	return tp == TaskProgress{}
+}
+
+// Frac returns the fraction of the task completed.
+// ok is false if it's not known.
+func (tp TaskProgress) Frac() (frac float64, ok bool) {
+	switch {
+	case tp.Total > 0:
+		frac = float64(tp.N) / float64(tp.Total)
+	case tp.Fraction > 0:
+		frac = tp.Fraction
+	default:
+		return 0, false
+	}
+	switch {
+	case frac < 0:
+		frac = 0
+	case frac > 1:
+		frac = 1
+	}
+	return frac, true
+}
+
+// String returns the progress formatted for display e.g. `3/10 (30%) status`
+func (tp TaskProgress) String() string {
+	l := make([]string, 0, 3)
+	if tp.Total > 0 {
+		l = append(l, fmt.Sprintf("%d/%d", tp.N, tp.Total))
+	} else if tp.N > 0 {
+		l = append(l, fmt.Sprintf("%d", tp.N))
+	}
+	if frac, ok := tp.Frac(); ok {
+		pct := fmt.Sprintf("%d%%", int(frac*100))
+		if len(l) != 0 {
+			pct = "(" + pct + ")"
+		}
+		l = append(l, pct)
+	}
+	if tp.Status != "" {
+		l = append(l, tp.Status)
+	}
+	return strings.Join(l, " ")
+}
+
+// goTestProgress reports the progress of `go test` through the task's progress.
+// N is the number of packages tested and Status is the test that's currently running, when using `-v`.
+type goTestProgress struct {
+	mu   sync.Mutex
+	task *TaskTicket
+	line []byte
+	tp   TaskProgress
+}
+
+func isGoTestCmd(name string, args []string) bool {
+	return name == "go" && len(args) != 0 && args[0] == "test"
+}
+
+func (gtp *goTestProgress) setTask(t *TaskTicket) {
+	gtp.mu.Lock()
+	defer gtp.mu.Unlock()
+
+	gtp.task = t
+}
+
+func (gtp *goTestProgress) Write(p []byte) (int, error) {
+	gtp.mu.Lock()
+	defer gtp.mu.Unlock()
+
+	s := append(gtp.line, p...)
+	updated := false
+	for {
+		i := bytes.IndexByte(s, '\n')
+		if i < 0 {
+			break
+		}
+		updated = gtp.scan(string(bytes.TrimSpace(s[:i]))) || updated
+		s = s[i+1:]
+	}
+	gtp.line = append(gtp.line[:0], s...)
+	if updated && gtp.task != nil {
+		gtp.task.SetProgress(gtp.tp)
+	}
+	return len(p), nil
+}
+
+func (gtp *goTestProgress) scan(ln string) bool {
+	switch {
+	case strings.HasPrefix(ln, "=== RUN "):
+		gtp.tp.Status = strings.TrimSpace(strings.TrimPrefix(ln, "=== RUN "))
+	case strings.HasPrefix(ln, "ok "), strings.HasPrefix(ln, "FAIL\t"), strings.HasPrefix(ln, "? "):
+		gtp.tp.N++
+		if f := strings.Fields(ln); len(f) >= 2 {
+			gtp.tp.Status = f[1]
+		}
+	default:
+		return false
+	}
+	return true
+}
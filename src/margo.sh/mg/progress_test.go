@@ -0,0 +1,79 @@
+package mg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskProgressString(t *testing.T) {
+	cases := []struct {
+		tp  TaskProgress
+		exp string
+	}{
+		{TaskProgress{}, ""},
+		{TaskProgress{N: 3}, "3"},
+		{TaskProgress{N: 3, Total: 10}, "3/10 (30%)"},
+		{TaskProgress{N: 3, Total: 10, Status: "pkg"}, "3/10 (30%) pkg"},
+		{TaskProgress{Fraction: 0.5}, "50%"},
+		{TaskProgress{N: 12, Total: 10}, "12/10 (100%)"},
+		{TaskProgress{Status: "scanning"}, "scanning"},
+	}
+	for _, c := range cases {
+		if s := c.tp.String(); s != c.exp {
+			t.Errorf("%#v.String() = %q, expected %q", c.tp, s, c.exp)
+		}
+	}
+}
+
+func TestTaskLowPriorityLimit(t *testing.T) {
+	tr := &taskTracker{}
+	lim := TaskLowPriorityLimit
+	low := Task{Priority: TaskPriorityLow, Group: "test"}
+
+	l := []*TaskTicket{}
+	for i := 0; i < lim; i++ {
+		l = append(l, tr.Begin(low))
+	}
+	// tasks in other groups, or with other priorities are not limited
+	tr.Begin(Task{Priority: TaskPriorityLow, Group: "other"}).Done()
+	tr.Begin(Task{Group: "test"}).Done()
+
+	started := make(chan *TaskTicket)
+	go func() { started <- tr.Begin(low) }()
+	select {
+	case <-started:
+		t.Fatalf("Begin did not block with %d low priority tasks running", lim)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if n, exp := len(tr.tickets), lim+1; n != exp {
+		t.Fatalf("expected %d tickets including the queued ticket, got %d", exp, n)
+	}
+	l[0].Done()
+	select {
+	case tk := <-started:
+		tk.Done()
+	case <-time.After(time.Second):
+		t.Fatalf("Begin did not return after a task finished")
+	}
+	for _, tk := range l[1:] {
+		tk.Done()
+	}
+}
+
+func TestGoTestProgress(t *testing.T) {
+	tr := &taskTracker{}
+	gtp := &goTestProgress{}
+	tk := tr.Begin(Task{})
+	defer tk.Done()
+	gtp.setTask(tk)
+
+	gtp.Write([]byte("=== RUN   TestA\n--- PASS: TestA (0.00s)\nok  \tmargo.sh/a\t0.01s\n=== RU"))
+	if tp := tk.Progress(); tp.N != 1 || tp.Status != "margo.sh/a" {
+		t.Fatalf("unexpected progress %#v", tp)
+	}
+	gtp.Write([]byte("N   TestB\n"))
+	if tp := tk.Progress(); tp.N != 1 || tp.Status != "TestB" {
+		t.Fatalf("unexpected progress %#v", tp)
+	}
+}
@@ -0,0 +1,131 @@
+package mg
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// PromptType is the type of input a Prompt asks the user for
+type PromptType string
+
+const (
+	// PromptTypeString asks for free-form text. It's the default.
+	PromptTypeString PromptType = "string"
+
+	// PromptTypeBool asks for `true` or `false`
+	PromptTypeBool PromptType = "bool"
+
+	// PromptTypeChoice asks the user to select one of Prompt.Choices
+	PromptTypeChoice PromptType = "choice"
+
+	// PromptTypeFile asks for the path of a file
+	PromptTypeFile PromptType = "file"
+
+	// PromptTypePackage asks the user to select a package import path.
+	// The choices are queried from reducers using QueryPromptChoices.
+	PromptTypePackage PromptType = "package"
+)
+
+// PromptChoice is one of the values a user may select for a Prompt
+type PromptChoice struct {
+	// Value is the value assigned to RunCmd.Prompts if the choice is selected
+	Value string
+
+	// Title is the text displayed to the user. If it's empty, Value is displayed instead.
+	Title string
+
+	// Desc describes the choice
+	Desc string
+}
+
+// Prompt describes an input the user is prompted for before running a UserCmd
+type Prompt struct {
+	// Title is the text displayed to the user
+	Title string
+
+	// Type is the type of input. If it's empty, PromptTypeString is assumed.
+	Type PromptType
+
+	// Default is the value that's initially entered or selected
+	Default string
+
+	// Choices is the list of values the user may choose from.
+	Choices []PromptChoice
+
+	// Query if set, identifies the choices to request from reducers
+	// by dispatching QueryPromptChoices e.g. `go.tests`.
+	// The returned choices are added to Choices.
+	Query string
+
+	// Pattern is a regular expression that the input must match
+	Pattern string
+}
+
+// Validate returns an error if s is not a valid input for the prompt.
+//
+// Values are validated by the client as they're entered, and again by RunCmd before the command is run.
+// The client's validation (in gosubl/margo_state.py) must follow the same rules.
+func (p Prompt) Validate(s string) error {
+	switch p.Type {
+	case PromptTypeBool:
+		if s != "true" && s != "false" {
+			return fmt.Errorf("%s: `%s` is not a boolean", p.Title, s)
+		}
+	case PromptTypeChoice:
+		found := false
+		for _, c := range p.Choices {
+			if c.Value == s {
+				found = true
+				break
+			}
+		}
+		if !found && p.Query == "" {
+			return fmt.Errorf("%s: `%s` is not one of the choices", p.Title, s)
+		}
+	}
+	if p.Pattern == "" {
+		return nil
+	}
+	pat, err := regexp.Compile(p.Pattern)
+	if err != nil {
+		return fmt.Errorf("%s: invalid pattern `%s`: %s", p.Title, p.Pattern, err)
+	}
+	if !pat.MatchString(s) {
+		return fmt.Errorf("%s: `%s` does not match the pattern `%s`", p.Title, s, p.Pattern)
+	}
+	return nil
+}
+
+// ValidatePrompts validates each value in values against the prompt at the same index in prompts
+func ValidatePrompts(prompts []Prompt, values []string) error {
+	if len(values) != len(prompts) {
+		return fmt.Errorf("expected %d prompt values, got %d", len(prompts), len(values))
+	}
+	for i, p := range prompts {
+		if err := p.Validate(values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryPromptChoices is the action dispatched to get the list of choices for a Prompt.
+//
+// Reducers add choices using State.AddPromptChoices.
+type QueryPromptChoices struct {
+	ActionType
+
+	// Prompt is the prompt for which choices are requested.
+	// Reducers usually respond based on its Query or Type fields.
+	Prompt Prompt
+}
+
+// AddPromptChoices adds the list of choices in l to State.PromptChoices
+func (st *State) AddPromptChoices(l ...PromptChoice) *State {
+	if len(l) == 0 {
+		return st
+	}
+	return st.Copy(func(st *State) {
+		st.PromptChoices = append(st.PromptChoices[:len(st.PromptChoices):len(st.PromptChoices)], l...)
+	})
+}
@@ -0,0 +1,41 @@
+package mg
+
+import (
+	"testing"
+)
+
+func TestPromptValidate(t *testing.T) {
+	choices := []PromptChoice{{Value: "a"}, {Value: "b"}}
+	cases := []struct {
+		p  Prompt
+		s  string
+		ok bool
+	}{
+		{Prompt{Type: PromptTypeString}, "anything", true},
+		{Prompt{Type: PromptTypeBool}, "true", true},
+		{Prompt{Type: PromptTypeBool}, "yes", false},
+		// the client only offers true and false, so other values accepted by strconv.ParseBool are rejected
+		{Prompt{Type: PromptTypeBool}, "1", false},
+		{Prompt{Type: PromptTypeChoice, Choices: choices}, "b", true},
+		{Prompt{Type: PromptTypeChoice, Choices: choices}, "c", false},
+		// queried choices are not known so they can't be validated
+		{Prompt{Type: PromptTypeChoice, Choices: choices, Query: "x"}, "c", true},
+		{Prompt{Pattern: `^\d+$`}, "123", true},
+		{Prompt{Pattern: `^\d+$`}, "12a", false},
+		{Prompt{Pattern: `(`}, "", false},
+	}
+	for _, c := range cases {
+		err := c.p.Validate(c.s)
+		if ok := err == nil; ok != c.ok {
+			t.Errorf("%#v.Validate(%q) = %v, expected ok=%v", c.p, c.s, err, c.ok)
+		}
+	}
+
+	prompts := []Prompt{{Type: PromptTypeBool}, {Pattern: `^x`}}
+	if err := ValidatePrompts(prompts, []string{"false", "xyz"}); err != nil {
+		t.Errorf("ValidatePrompts returned an unexpected error: %s", err)
+	}
+	if err := ValidatePrompts(prompts, []string{"false"}); err == nil {
+		t.Errorf("ValidatePrompts did not return an error for missing values")
+	}
+}
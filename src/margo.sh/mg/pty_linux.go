@@ -0,0 +1,75 @@
+// +build linux
+
+package mg
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// ptySysProcAttr makes the pty attached to the child's stdout its controlling terminal.
+// Setsid also puts the child in a new process group, so pgKill still reaches it.
+func ptySysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    1,
+	}
+}
+
+// openPty opens a new pseudo-terminal pair with window size sz.
+// ptm is the master side that's read by us, pts is the slave side given to the process.
+func openPty(sz TtySize) (ptm, pts *os.File, err error) {
+	ptm, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			ptm.Close()
+		}
+	}()
+
+	unlock := int32(0)
+	if err := ptyIoctl(ptm, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		return nil, nil, err
+	}
+	n := uint32(0)
+	if err := ptyIoctl(ptm, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		return nil, nil, err
+	}
+
+	pts, err = os.OpenFile("/dev/pts/"+strconv.FormatUint(uint64(n), 10), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ws := struct{ Row, Col, X, Y uint16 }{Row: sz.Rows, Col: sz.Cols}
+	if err := ptyIoctl(pts, syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+		pts.Close()
+		return nil, nil, err
+	}
+	return ptm, pts, nil
+}
+
+// ptyIoctl calls ioctl on f without using f.Fd(),
+// which would put the file into blocking mode and prevent Close from interrupting reads.
+func ptyIoctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// +build linux
+
+package mg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcTty(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	out := &CmdOut{}
+	cx := &CmdCtx{
+		Ctx: mx,
+		RunCmd: RunCmd{
+			Name:    "sh",
+			Args:    []string{"-c", "test -t 1 && stty size"},
+			Tty:     true,
+			TtySize: TtySize{Rows: 12, Cols: 34},
+		},
+		Output: out,
+	}
+	p, err := cx.StartProc()
+	if err != nil {
+		t.Skipf("cannot start process on a pty: %s", err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("process exited with error: %s", err)
+	}
+	if s := strings.TrimSpace(string(out.Output().Output)); s != "12 34" {
+		t.Errorf("expected `stty size` output `12 34`, got `%s`", s)
+	}
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package mg
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func ptySysProcAttr() *syscall.SysProcAttr {
+	return pgSysProcAttr
+}
+
+func openPty(sz TtySize) (ptm, pts *os.File, err error) {
+	return nil, nil, errors.New("RunCmd.Tty is only supported on Linux")
+}
@@ -0,0 +1,353 @@
+package mg
+
+import (
+	"fmt"
+	"io"
+	"margo.sh/mgutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	shellRedirPat  = regexp.MustCompile(`^(\d|&)?(>>|>|<)(.*)$`)
+	shellAssignPat = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// shellRedir is an I/O redirection e.g. `2>&1` or `> out.txt`
+type shellRedir struct {
+	// Fd is the redirected fd: 0, 1, 2 or -1 for both stdout and stderr (`&>`)
+	Fd int
+	// Op is one of `<`, `>` or `>>`
+	Op string
+	// Target is the file name, or `&N` to duplicate fd N
+	Target string
+}
+
+// shellCmd is a simple command in a pipeline
+type shellCmd struct {
+	Env    []string
+	Name   string
+	Args   []string
+	Redirs []shellRedir
+}
+
+// shellPipeline is a list of commands connected by `|`
+type shellPipeline struct {
+	// Op is the operator that separates it from the previous pipeline: `&&`, `||` or `;`
+	Op   string
+	Cmds []shellCmd
+}
+
+// shellList is a list of pipelines, as parsed by parseShell
+type shellList []shellPipeline
+
+func isShellOp(s string) bool {
+	switch s {
+	case "|", "&&", "||", ";":
+		return true
+	}
+	return false
+}
+
+// isShellSyntax returns true if the command words needs to be parsed by parseShell
+func isShellSyntax(words []string) bool {
+	if len(words) != 0 && shellAssignPat.MatchString(words[0]) {
+		return true
+	}
+	for _, s := range words {
+		if isShellOp(s) || shellRedirPat.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseShell parses the list of words into a shellList.
+//
+// It supports pipes (`|`), the list operators `&&`, `||` and `;`,
+// redirections (`<`, `>`, `>>`, `2>`, `2>&1`, `&>`) and leading `NAME=value` env assignments.
+//
+// The words are expected to be already split and unquoted,
+// so operators are only recognised as separate words
+// e.g. `a && b` is a list of 2 commands, but `'a&&b'` and `a&&b` are the single word `a&&b`.
+// Redirections may be joined to their target, as in `>out.txt`.
+func parseShell(words []string) (shellList, error) {
+	sl := shellList{}
+	pl := shellPipeline{}
+	c := shellCmd{}
+	endCmd := func(op string) error {
+		if c.Name == "" {
+			return fmt.Errorf("syntax error: missing command before `%s`", op)
+		}
+		pl.Cmds = append(pl.Cmds, c)
+		c = shellCmd{}
+		return nil
+	}
+
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch {
+		case isShellOp(w):
+			if err := endCmd(w); err != nil {
+				return nil, err
+			}
+			if w != "|" {
+				sl = append(sl, pl)
+				pl = shellPipeline{Op: w}
+			}
+		case shellRedirPat.MatchString(w):
+			m := shellRedirPat.FindStringSubmatch(w)
+			r := shellRedir{Op: m[2], Target: m[3]}
+			switch m[1] {
+			case "":
+				r.Fd = 1
+				if r.Op == "<" {
+					r.Fd = 0
+				}
+			case "&":
+				r.Fd = -1
+			default:
+				r.Fd, _ = strconv.Atoi(m[1])
+			}
+			if r.Target == "" {
+				i++
+				if i >= len(words) || isShellOp(words[i]) {
+					return nil, fmt.Errorf("syntax error: missing file name after `%s`", w)
+				}
+				r.Target = words[i]
+			}
+			c.Redirs = append(c.Redirs, r)
+		case c.Name == "" && shellAssignPat.MatchString(w):
+			c.Env = append(c.Env, w)
+		case c.Name == "":
+			c.Name = w
+		default:
+			c.Args = append(c.Args, w)
+		}
+	}
+
+	switch {
+	case c.Name != "":
+		pl.Cmds = append(pl.Cmds, c)
+	case len(c.Env) != 0 || len(c.Redirs) != 0:
+		return nil, fmt.Errorf("syntax error: missing command name")
+	case len(pl.Cmds) != 0:
+		return nil, fmt.Errorf("syntax error: missing command after `|`")
+	case pl.Op == "&&" || pl.Op == "||":
+		return nil, fmt.Errorf("syntax error: missing command after `%s`", pl.Op)
+	}
+	if len(pl.Cmds) != 0 {
+		sl = append(sl, pl)
+	}
+	return sl, nil
+}
+
+// shellRunner runs a shellList using Procs, one for each command
+type shellRunner struct {
+	cx *CmdCtx
+
+	mu       sync.Mutex
+	procs    map[*Proc]bool
+	canceled bool
+}
+
+func runShell(cx *CmdCtx, sl shellList) {
+	sr := &shellRunner{cx: cx, procs: map[*Proc]bool{}}
+	words := append([]string{cx.Name}, cx.Args...)
+	task := cx.Begin(Task{
+		CancelID: cx.CancelID,
+		Title:    "`" + mgutil.QuoteCmd(words[0], words[1:]...) + "`",
+		Cancel:   sr.cancel,
+		Fd:       cx.Fd,
+		Cmd:      cx.RunCmd,
+	})
+	defer task.Done()
+
+	var err error
+	defer func() { task.SetError(err) }()
+	for _, pl := range sl {
+		switch {
+		case sr.isCanceled():
+			return
+		case pl.Op == "&&" && err != nil:
+			continue
+		case pl.Op == "||" && err == nil:
+			continue
+		}
+		err = sr.runPipeline(pl)
+	}
+}
+
+func (sr *shellRunner) cancel() {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.canceled = true
+	for p := range sr.procs {
+		p.Cancel()
+	}
+}
+
+func (sr *shellRunner) isCanceled() bool {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	return sr.canceled
+}
+
+func (sr *shellRunner) track(p *Proc, running bool) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if running {
+		sr.procs[p] = true
+	} else {
+		delete(sr.procs, p)
+	}
+}
+
+// runPipeline starts all commands in pl and returns the error of the last command
+func (sr *shellRunner) runPipeline(pl shellPipeline) error {
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+
+	procs := make([]*Proc, 0, len(pl.Cmds))
+	var stdin io.Reader
+	var err error
+	for i, c := range pl.Cmds {
+		p := sr.newProc(c, i == 0)
+		if stdin != nil {
+			p.cmd.Stdin = stdin
+			stdin = nil
+		}
+		var pw *os.File
+		if i < len(pl.Cmds)-1 {
+			r, w, e := os.Pipe()
+			if e != nil {
+				err = e
+				break
+			}
+			closers = append(closers, r, w)
+			p.cmd.Stdout = w
+			stdin = r
+			pw = w
+		}
+		if err = sr.redirect(p, c.Redirs, &closers); err != nil {
+			fmt.Fprintf(sr.cx.Output, "%s: %s\n", p.Title, err)
+			break
+		}
+		if err = p.start(); err != nil {
+			fmt.Fprintf(sr.cx.Output, "%s exited: %s\n", p.Title, err)
+			break
+		}
+		sr.track(p, true)
+		if pw != nil {
+			// the next command only sees EOF once all copies of the write end are closed
+			pw.Close()
+		}
+		procs = append(procs, p)
+	}
+	if err != nil {
+		for _, p := range procs {
+			p.Cancel()
+		}
+	}
+
+	for _, p := range procs {
+		e := p.Wait()
+		sr.track(p, false)
+		if e != nil {
+			fmt.Fprintf(sr.cx.Output, "%s exited: %s\n", p.Title, e)
+		}
+		if err == nil && p == procs[len(procs)-1] {
+			err = e
+		}
+	}
+	return err
+}
+
+// newProc creates a Proc for the command c.
+// The view src is only sent to the first command in a pipeline.
+func (sr *shellRunner) newProc(c shellCmd, first bool) *Proc {
+	cx := sr.cx.Copy(func(cx *CmdCtx) {
+		rc := cx.RunCmd
+		rc.Name = c.Name
+		rc.Args = c.Args
+		rc.Input = rc.Input && first
+		rc.CancelID = ""
+		rc.Tty = false
+		rc.Interactive = false
+		cx.RunCmd = rc
+	})
+	p := newProc(cx)
+	p.cmd.Env = append(p.cmd.Env, c.Env...)
+	return p
+}
+
+// redirect applies the list of redirections to p's command.
+// Any files opened are added to closers.
+func (sr *shellRunner) redirect(p *Proc, redirs []shellRedir, closers *[]io.Closer) error {
+	cmd := p.cmd
+	for _, r := range redirs {
+		if strings.HasPrefix(r.Target, "&") {
+			var w io.Writer
+			switch r.Target {
+			case "&1":
+				w = cmd.Stdout
+			case "&2":
+				w = cmd.Stderr
+			default:
+				return fmt.Errorf("unsupported redirection `%d%s%s`", r.Fd, r.Op, r.Target)
+			}
+			switch r.Fd {
+			case 1:
+				cmd.Stdout = w
+			case 2:
+				cmd.Stderr = w
+			default:
+				return fmt.Errorf("unsupported redirection `%d%s%s`", r.Fd, r.Op, r.Target)
+			}
+			continue
+		}
+
+		fn := r.Target
+		if !filepath.IsAbs(fn) {
+			fn = filepath.Join(cmd.Dir, fn)
+		}
+		flag := os.O_RDONLY
+		switch r.Op {
+		case ">":
+			flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		case ">>":
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(fn, flag, 0666)
+		if err != nil {
+			return err
+		}
+		*closers = append(*closers, f)
+
+		switch r.Fd {
+		case 0:
+			cmd.Stdin = f
+		case 1:
+			cmd.Stdout = f
+		case 2:
+			cmd.Stderr = f
+		case -1:
+			cmd.Stdout = f
+			cmd.Stderr = f
+		default:
+			return fmt.Errorf("cannot redirect fd %d", r.Fd)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// +build !windows
+
+package mg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseShell(t *testing.T) {
+	sl, err := parseShell([]string{"A=1", "go", "list", "|", "grep", "foo", ">out.txt", "2>&1", "&&", "cat", "<", "in.txt", "||", "echo", "x", ";"})
+	if err != nil {
+		t.Fatalf("parseShell failed: %s", err)
+	}
+	expect := shellList{
+		{Cmds: []shellCmd{
+			{Env: []string{"A=1"}, Name: "go", Args: []string{"list"}},
+			{Name: "grep", Args: []string{"foo"}, Redirs: []shellRedir{
+				{Fd: 1, Op: ">", Target: "out.txt"},
+				{Fd: 2, Op: ">", Target: "&1"},
+			}},
+		}},
+		{Op: "&&", Cmds: []shellCmd{
+			{Name: "cat", Redirs: []shellRedir{{Fd: 0, Op: "<", Target: "in.txt"}}},
+		}},
+		{Op: "||", Cmds: []shellCmd{{Name: "echo", Args: []string{"x"}}}},
+	}
+	if !reflect.DeepEqual(sl, expect) {
+		t.Errorf("parseShell: expected %#v, got %#v", expect, sl)
+	}
+
+	for _, words := range [][]string{{"|", "a"}, {"a", "&&"}, {"a", "|"}, {"a", ">"}, {"A=1"}} {
+		if _, err := parseShell(words); err == nil {
+			t.Errorf("parseShell(%q): expected a syntax error", words)
+		}
+	}
+
+	if isShellSyntax([]string{"grep", "-E", "a|b"}) {
+		t.Errorf("isShellSyntax: operators should only be recognised as separate words")
+	}
+}
+
+func TestRunShell(t *testing.T) {
+	dir, err := ioutil.TempDir("", "margo-shell-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	words := []string{
+		"echo", "hello", "|", "tr", "a-z", "A-Z", ">", "out.txt",
+		"&&", "false", "&&", "echo", "skipped",
+		"||", "X=world", "sh", "-c", "cat out.txt; echo $X",
+	}
+	sl, err := parseShell(words)
+	if err != nil {
+		t.Fatalf("parseShell failed: %s", err)
+	}
+	out := &CmdOut{}
+	cx := &CmdCtx{
+		Ctx:    mx,
+		RunCmd: RunCmd{Name: words[0], Args: words[1:], Dir: dir},
+		Output: out,
+	}
+	runShell(cx, sl)
+
+	s, _ := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	if string(s) != "HELLO\n" {
+		t.Errorf("expected out.txt to contain `HELLO\\n`, got `%q`", s)
+	}
+	if s, want := string(out.Output().Output), "`false` exited: exit status 1\nHELLO\nworld\n"; s != want {
+		t.Errorf("expected output `%q`, got `%q`", want, s)
+	}
+}
+
+func TestExecCmdShellSyntax(t *testing.T) {
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+
+	run := func(name string, args ...string) string {
+		out := &CmdOut{}
+		Builtins.execCmd(&CmdCtx{
+			Ctx:    mx,
+			RunCmd: RunCmd{Name: name, Args: args},
+			Output: out,
+		})
+		return string(out.Output().Output)
+	}
+
+	if s, want := run("echo", "a", ";", "<div>", ">foo"), "a ; <div> >foo\n"; s != want {
+		t.Errorf("commands other than .exec should not be parsed: expected `%q`, got `%q`", want, s)
+	}
+	if s, want := run(".exec", "echo", "a", ";", "echo", "b"), "a\nb\n"; s != want {
+		t.Errorf(".exec should support shell syntax: expected `%q`, got `%q`", want, s)
+	}
+}
@@ -0,0 +1,51 @@
+package mg
+
+// SignatureHelp describes the function being called at the cursor
+// so clients can show its signature in a popup.
+type SignatureHelp struct {
+	// Signatures is the list of signatures that might be called.
+	// e.g. an interface method, and the methods on the receivers that implement it
+	Signatures []Signature
+
+	// ActiveSignature is the index of the signature in Signatures that's most likely being called
+	// i.e. the function that's statically called
+	ActiveSignature int
+
+	// ActiveParameter is the (0-based) index of the parameter at the cursor in the active signature.
+	// It's -1 if the cursor is not in the list of arguments e.g. in the LHS of an assignment.
+	ActiveParameter int
+}
+
+// Signature is the signature of a function
+type Signature struct {
+	// Label is the signature as a single line of text e.g. `Split(s, sep string) []string`
+	Label string
+
+	// Name is the name of the function
+	Name string
+
+	// Params is the list of parameters. Each name in a group e.g. `a, b int` is listed separately.
+	Params []SignatureParam
+
+	// Results is the list of results
+	Results []SignatureParam
+
+	// Doc is the documentation of the function
+	Doc string
+}
+
+// SignatureParam is a parameter or result of a Signature
+type SignatureParam struct {
+	// Name is the name of the parameter. It's empty if the parameter is unnamed.
+	Name string
+
+	// Type is the type of the parameter e.g. `...interface{}`
+	Type string
+}
+
+// SetSignatureHelp sets State.SignatureHelp to sh
+func (st *State) SetSignatureHelp(sh *SignatureHelp) *State {
+	return st.Copy(func(st *State) {
+		st.SignatureHelp = sh
+	})
+}
@@ -134,9 +134,21 @@ type State struct {
 	// It's usually populated during the QueryUserCmds and QueryTestCmds actions.
 	UserCmds UserCmdList
 
+	// PromptChoices holds the list of choices for a Prompt.
+	// It's usually populated during the QueryPromptChoices action.
+	PromptChoices []PromptChoice
+
+	// Declarations holds the tree of symbols declared in the current view (or package).
+	// It's usually populated during the QueryDeclarations action.
+	Declarations []Declaration
+
 	// Tooltips is a list of tips to show the user
 	Tooltips []Tooltip
 
+	// SignatureHelp describes the function being called at the cursor, if any.
+	// Reducers that set it usually also add a short description to Status for clients that can't show it.
+	SignatureHelp *SignatureHelp `mg.Nillable:"true"`
+
 	// HUD contains information to the displayed to the user
 	HUD HUDState
 
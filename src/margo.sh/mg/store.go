@@ -1,6 +1,7 @@
 package mg
 
 import (
+	"margo.sh/bolt"
 	"margo.sh/mgpf"
 	yotsuba "margo.sh/why_would_you_make_yotsuba_cry"
 	"path/filepath"
@@ -60,10 +61,11 @@ type Store struct {
 		sync.Mutex
 		storeReducers
 	}
-	cfg   EditorConfig `mg.Nillable:"true"`
-	ag    *Agent
-	tasks *taskTracker
-	cache struct {
+	cfg     EditorConfig `mg.Nillable:"true"`
+	ag      *Agent
+	tasks   *taskTracker
+	history *cmdHistory
+	cache   struct {
 		sync.RWMutex
 		vName string
 		vHash string
@@ -259,7 +261,8 @@ func newStore(ag *Agent, sub Subscriber) *Store {
 		StickyState: StickyState{View: newView(sto)},
 	}
 	sto.tasks = &taskTracker{}
-	sto.After(sto.tasks)
+	sto.history = &cmdHistory{ds: bolt.DS}
+	sto.After(sto.tasks, sto.history, &watchSupport{})
 
 	// 640 slots ought to be enough for anybody
 	sto.dsp.lo = make(chan dispatchHandler, 640)
@@ -337,6 +340,7 @@ func (sto *Store) SetBaseConfig(cfg EditorConfig) *Store {
 }
 
 // Begin starts a new task and returns its ticket
+// It may block if t.Priority is TaskPriorityLow, see taskTracker.Begin
 func (sto *Store) Begin(t Task) *TaskTicket {
 	return sto.tasks.Begin(t)
 }
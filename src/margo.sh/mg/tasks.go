@@ -15,6 +15,26 @@ type Task struct {
 	CancelID string
 	ShowNow  bool
 	NoEcho   bool
+
+	// Fd is the Fd of the task's output, if it's a command
+	Fd string
+
+	// Input if set, is called to handle the CmdInput action for this task
+	Input func(data []byte, close bool) error
+
+	// Output if set, returns the recent output of the task for the `.output` builtin
+	Output func() []byte
+
+	// Cmd is the command that started the task, if any.
+	// It's used by the `.restart` builtin.
+	Cmd RunCmd
+
+	// Priority is the priority of the task.
+	// Begin blocks TaskPriorityLow tasks while TaskLowPriorityLimit tasks in the same Group are running.
+	Priority TaskPriority
+
+	// Group is the name of the task's concurrency group
+	Group string
 }
 
 type TaskTicket struct {
@@ -22,21 +42,86 @@ type TaskTicket struct {
 	ID    string
 	Start time.Time
 
-	tracker *taskTracker
+	tracker  *taskTracker
+	end      time.Time
+	err      error
+	canceled bool
+	queued   bool
+	progress TaskProgress
+	done     chan struct{}
 }
 
+// Done marks the task as finished.
+// The ticket is kept for a while so its status can be listed with `.jobs`
 func (ti *TaskTicket) Done() {
 	if ti.tracker != nil {
 		ti.tracker.done(ti.ID)
 	}
 }
 
+// SetError records the error the task finished with, to be displayed by `.jobs`.
+// It should be called before Done.
+func (ti *TaskTicket) SetError(err error) {
+	if tr := ti.tracker; tr != nil {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+	}
+	ti.err = err
+}
+
+// SetProgress replaces the task's progress
+func (ti *TaskTicket) SetProgress(tp TaskProgress) {
+	ti.updateProgress(func(p *TaskProgress) { *p = tp })
+}
+
+// Step reports that n of total steps are completed
+func (ti *TaskTicket) Step(n, total int) {
+	ti.updateProgress(func(p *TaskProgress) { p.N, p.Total = n, total })
+}
+
+// SetFraction reports that the fraction f of the task is completed
+func (ti *TaskTicket) SetFraction(f float64) {
+	ti.updateProgress(func(p *TaskProgress) { p.Fraction = f })
+}
+
+// SetStatus sets the description of what the task is currently doing
+func (ti *TaskTicket) SetStatus(s string) {
+	ti.updateProgress(func(p *TaskProgress) { p.Status = s })
+}
+
+// Progress returns the task's progress
+func (ti *TaskTicket) Progress() TaskProgress {
+	if tr := ti.tracker; tr != nil {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+	}
+	return ti.progress
+}
+
+func (ti *TaskTicket) updateProgress(f func(*TaskProgress)) {
+	if ti == nil {
+		return
+	}
+	if tr := ti.tracker; tr != nil {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+	}
+	f(&ti.progress)
+}
+
 func (ti *TaskTicket) Cancel() {
 	if f := ti.Task.Cancel; f != nil {
 		f()
 	}
 }
 
+func (ti *TaskTicket) matchInput(ci CmdInput) bool {
+	if id := ci.CancelID; id != "" && (id == ti.ID || id == ti.CancelID) {
+		return true
+	}
+	return ci.Fd != "" && ci.Fd == ti.Fd
+}
+
 func (ti *TaskTicket) Cancellable() bool {
 	return ti.Task.Cancel != nil
 }
@@ -46,10 +131,12 @@ type taskTracker struct {
 	mu       sync.Mutex
 	id       uint64
 	tickets  []*TaskTicket
+	finished []*TaskTicket
 	buf      bytes.Buffer
 	dispatch Dispatcher
 	status   string
 	timer    *time.Timer
+	cond     *sync.Cond
 }
 
 func (tr *taskTracker) RInit(mx *Ctx) {
@@ -73,11 +160,13 @@ func (tr *taskTracker) Reduce(mx *Ctx) *State {
 	defer tr.mu.Unlock()
 
 	st := mx.State
-	switch mx.Action.(type) {
+	switch act := mx.Action.(type) {
 	case RunCmd:
 		st = tr.runCmd(st)
 	case QueryUserCmds:
 		st = tr.userCmds(st)
+	case CmdInput:
+		st = tr.cmdInput(st, act)
 	}
 	if tr.status != "" {
 		st = st.AddStatus(tr.status)
@@ -122,14 +211,20 @@ func (tr *taskTracker) userCmds(st *State) *State {
 	now := time.Now()
 	for i, t := range tr.tickets {
 		c := UserCmd{Name: ".kill"}
-		dur := mgpf.D(now.Sub(t.Start))
+		desc := fmt.Sprintf("elapsed: %s", mgpf.D(now.Sub(t.Start)))
+		if t.queued {
+			desc = "queued"
+		}
+		if s := t.progress.String(); s != "" {
+			desc += ", progress: " + s
+		}
 		if t.Cancellable() {
 			c.Args = []string{t.CancelID}
 			c.Title = "Task: Cancel " + t.Title
-			c.Desc = fmt.Sprintf("elapsed: %s, cmd: `%s`", dur, mgutil.QuoteCmd(c.Name, c.Args...))
+			c.Desc = fmt.Sprintf("%s, cmd: `%s`", desc, mgutil.QuoteCmd(c.Name, c.Args...))
 		} else {
 			c.Title = "Task: " + t.Title
-			c.Desc = fmt.Sprintf("elapsed: %s", dur)
+			c.Desc = desc
 		}
 		cl[i] = c
 	}
@@ -143,9 +238,45 @@ func (tr *taskTracker) runCmd(st *State) *State {
 			Desc: "List and cancel active tasks",
 			Run:  tr.killBuiltin,
 		},
+		BuiltinCmd{
+			Name: ".jobs",
+			Desc: "List active and recently finished tasks with their status",
+			Run:  tr.jobsBuiltin,
+		},
+		BuiltinCmd{
+			Name: ".output",
+			Desc: "Replay the buffered output of the task with the specified ID",
+			Run:  tr.outputBuiltin,
+		},
+		BuiltinCmd{
+			Name: ".wait",
+			Desc: "Wait for the tasks with the specified IDs to finish",
+			Run:  tr.waitBuiltin,
+		},
+		BuiltinCmd{
+			Name: ".restart",
+			Desc: "Cancel the task with the specified ID, and run its command again with the same args",
+			Run:  tr.restartBuiltin,
+		},
 	)
 }
 
+func (tr *taskTracker) cmdInput(st *State, ci CmdInput) *State {
+	for _, t := range tr.tickets {
+		if !t.matchInput(ci) {
+			continue
+		}
+		if t.Input == nil {
+			return st.AddErrorf("CmdInput: task %s does not accept input", t.Title)
+		}
+		if err := t.Input([]byte(ci.Data), ci.Close); err != nil {
+			return st.AddErrorf("CmdInput: task %s: %s", t.Title, err)
+		}
+		return st
+	}
+	return st.AddErrorf("CmdInput: no task found with CancelID `%s` or Fd `%s`", ci.CancelID, ci.Fd)
+}
+
 // Cancel cancels the task tid.
 // true is returned if the task exists and was canceled
 func (tr *taskTracker) Cancel(tid string) bool {
@@ -158,7 +289,9 @@ func (tr *taskTracker) Cancel(tid string) bool {
 func (tr *taskTracker) cancel(tid string) bool {
 	for _, t := range tr.tickets {
 		if t.ID == tid || t.CancelID == tid {
+			t.canceled = t.Cancellable()
 			t.Cancel()
+			tr.wake()
 			return t.Cancellable()
 		}
 	}
@@ -202,7 +335,14 @@ func (tr *taskTracker) listAll(cx *CmdCtx) {
 			dur = dur.Round(time.Second)
 		}
 
-		fmt.Fprintf(buf, "ID: %s, Dur: %s, Title: %s\n", id, dur, t.Title)
+		fmt.Fprintf(buf, "ID: %s, Dur: %s, Title: %s", id, dur, t.Title)
+		if t.queued {
+			buf.WriteString(", Queued: true")
+		}
+		if s := t.progress.String(); s != "" {
+			fmt.Fprintf(buf, ", Progress: %s", s)
+		}
+		buf.WriteByte('\n')
 	}
 	cx.Output.Write(buf.Bytes())
 }
@@ -215,21 +355,30 @@ func (tr *taskTracker) render() string {
 	visible := false
 	showAnim := false
 	title := ""
+	queued := 0
 	for _, t := range tr.tickets {
+		if t.queued {
+			queued++
+			continue
+		}
 		dur := now.Sub(t.Start)
 		if dur < 1*time.Second {
 			continue
 		}
 		visible = true
-		if t.NoEcho || t.Title == "" {
+		if t.NoEcho || t.Title == "" || title != "" {
 			continue
 		}
 		if dur < 16*time.Second {
 			showAnim = true
 		}
+		// tasks that report progress stay visible until they're done
+		if s := t.progress.String(); s != "" {
+			title = t.Title + " " + s
+			continue
+		}
 		if dur < 8*time.Second {
 			title = t.Title
-			break
 		}
 	}
 	if !visible {
@@ -241,7 +390,10 @@ func (tr *taskTracker) render() string {
 	if now.Second()%2 == 0 || !showAnim {
 		digits = mgutil.PrimaryDigits
 	}
-	digits.DrawInto(len(tr.tickets), &tr.buf)
+	digits.DrawInto(len(tr.tickets)-queued, &tr.buf)
+	if queued != 0 {
+		fmt.Fprintf(&tr.buf, " (+%d queued)", queued)
+	}
 	if title != "" {
 		tr.buf.WriteByte(' ')
 		tr.buf.WriteString(title)
@@ -257,11 +409,60 @@ func (tr *taskTracker) done(id string) {
 	for _, t := range tr.tickets {
 		if t.ID != id {
 			l = append(l, t)
+			continue
+		}
+		t.end = time.Now()
+		close(t.done)
+		tr.finished = append(tr.finished, t)
+		if n := len(tr.finished) - TaskHistoryLimit; n > 0 {
+			tr.finished = append(tr.finished[:0:0], tr.finished[n:]...)
 		}
 	}
 	tr.tickets = l
+	tr.wake()
+}
+
+// wake wakes up any tasks waiting in Begin for their group to have a free slot
+//
+// tr.mu must be held by the caller
+func (tr *taskTracker) wake() {
+	if tr.cond != nil {
+		tr.cond.Broadcast()
+	}
+}
+
+// running returns the number of low priority tasks in group that are not queued
+//
+// tr.mu must be held by the caller
+func (tr *taskTracker) running(group string) int {
+	n := 0
+	for _, t := range tr.tickets {
+		if t.Priority == TaskPriorityLow && t.Group == group && !t.queued {
+			n++
+		}
+	}
+	return n
+}
+
+// wait blocks until there's a free slot in t's group or t is canceled
+//
+// tr.mu must be held by the caller
+func (tr *taskTracker) wait(t *TaskTicket) {
+	if tr.cond == nil {
+		tr.cond = sync.NewCond(&tr.mu)
+	}
+	t.queued = true
+	for !t.canceled && tr.running(t.Group) >= TaskLowPriorityLimit {
+		tr.cond.Wait()
+	}
+	t.queued = false
+	t.Start = time.Now()
 }
 
+// Begin starts a new task and returns its ticket.
+//
+// If o.Priority is TaskPriorityLow, Begin blocks until fewer than TaskLowPriorityLimit
+// low priority tasks in o.Group are running, or the task is canceled.
 func (tr *taskTracker) Begin(o Task) *TaskTicket {
 	tr.mu.Lock()
 	defer tr.mu.Unlock()
@@ -284,8 +485,12 @@ func (tr *taskTracker) Begin(o Task) *TaskTicket {
 		ID:      id,
 		Start:   time.Now(),
 		tracker: tr,
+		done:    make(chan struct{}),
 	}
 	tr.tickets = append(tr.tickets, t)
 	tr.resetTimer()
+	if o.Priority == TaskPriorityLow {
+		tr.wait(t)
+	}
 	return t
 }
@@ -44,5 +44,18 @@ type UserCmd struct {
 	// Prompts is a list of titles for prompting the user for input before running the command.
 	// The user is prompted once for each entry.
 	// The inputs are assigned directly to RunCmd.Prompts for command consumption.
+	//
+	// Each entry is equivalent to a Prompt of type PromptTypeString, see TypedPrompts.
 	Prompts []string
+
+	// TypedPrompts is a list of prompts with a type, default value, choices and validation.
+	// If it's set, Prompts is ignored.
+	TypedPrompts []Prompt
+
+	// Limits is the list of resource limits applied to the command.
+	// It's assigned to RunCmd.Limits, so if it's zero, the default in CmdLimits is used.
+	Limits ProcLimits
+
+	// ParseANSI is assigned to RunCmd.ParseANSI
+	ParseANSI bool
 }
@@ -26,6 +26,11 @@ type View struct {
 	Ext   string
 	Lang  Lang
 
+	// SelStart and SelEnd are the offsets of the first selection in the view.
+	// They're equal to Pos if nothing is selected.
+	SelStart int
+	SelEnd   int
+
 	changed int
 	kvs     KVStore
 }
@@ -130,6 +135,18 @@ func (v *View) SrcPos() ([]byte, int) {
 	return src, mgutil.ClampPos(src, v.Pos)
 }
 
+// SrcSel returns the view's src and the start and end offsets of the selection in src.
+// If nothing is selected, start and end are equal.
+func (v *View) SrcSel() (src []byte, start, end int) {
+	src, _ = v.ReadAll()
+	start = mgutil.Clamp(0, len(src), v.SelStart)
+	end = mgutil.Clamp(0, len(src), v.SelEnd)
+	if end < start {
+		start, end = end, start
+	}
+	return src, start, end
+}
+
 func (v *View) Valid() bool {
 	return v.Name != ""
 }
@@ -154,6 +171,12 @@ func (v *View) finalize() {
 
 	v.Src = src
 	v.Pos = BytePos(src, v.Pos)
+	if v.SelStart == 0 && v.SelEnd == 0 {
+		v.SelStart, v.SelEnd = v.Pos, v.Pos
+	} else {
+		v.SelStart = BytePos(src, v.SelStart)
+		v.SelEnd = BytePos(src, v.SelEnd)
+	}
 	lines := bytes.Split(src[:v.Pos], []byte{'\n'})
 	v.Row = len(lines) - 1
 	v.Col = len(lines[len(lines)-1])
@@ -167,6 +190,8 @@ func (v *View) SetSrc(s []byte) *View {
 		v.Pos = 0
 		v.Row = 0
 		v.Col = 0
+		v.SelStart = 0
+		v.SelEnd = 0
 		v.Src = s
 		v.Hash = SrcHash(s)
 		v.Dirty = true
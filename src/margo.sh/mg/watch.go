@@ -0,0 +1,354 @@
+package mg
+
+import (
+	"fmt"
+	"margo.sh/mgutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// WatchDebounce is how long `.watch` waits for changes to stop before re-running its command
+	WatchDebounce = 300 * time.Millisecond
+
+	// WatchPollInterval is how often `.watch` checks the filesystem for changes
+	WatchPollInterval = 1 * time.Second
+
+	// WatchMaxFiles is the maximum number of files a `.watch` of a directory will check for changes
+	WatchMaxFiles = 10000
+)
+
+// watchRun is dispatched to re-run the command of a watch with the current state
+type watchRun struct {
+	ActionType
+
+	w      *watch
+	n      int
+	reason string
+}
+
+// watchSupport implements the `.watch` builtin
+type watchSupport struct {
+	ReducerType
+
+	mu      sync.Mutex
+	watches map[*watch]bool
+}
+
+func (ws *watchSupport) Reduce(mx *Ctx) *State {
+	switch act := mx.Action.(type) {
+	case RunCmd:
+		return mx.AddBuiltinCmds(BuiltinCmd{
+			Name: ".watch",
+			Desc: "Re-run a command when files matching a glob or under a dir are saved or changed e.g. `.watch ./ go test`",
+			Run:  ws.watchBuiltin,
+		})
+	case ViewSaved:
+		ws.saved(mx.View.Filename())
+	case watchRun:
+		return act.w.run(mx, act.n, act.reason)
+	}
+	return mx.State
+}
+
+func (ws *watchSupport) saved(fn string) {
+	ws.mu.Lock()
+	var l []*watch
+	for w := range ws.watches {
+		if w.match(fn) {
+			l = append(l, w)
+		}
+	}
+	ws.mu.Unlock()
+
+	for _, w := range l {
+		w.saved(fn)
+	}
+}
+
+func (ws *watchSupport) track(w *watch, active bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.watches == nil {
+		ws.watches = map[*watch]bool{}
+	}
+	if active {
+		ws.watches[w] = true
+	} else {
+		delete(ws.watches, w)
+	}
+}
+
+func (ws *watchSupport) watchBuiltin(cx *CmdCtx) *State {
+	fs := cx.Flags()
+	fs.SetOutput(cx.Output)
+	debounce := fs.Duration("debounce", WatchDebounce, "wait this long for changes to stop before re-running the command")
+	poll := fs.Duration("poll", WatchPollInterval, "check the filesystem for changes at this interval, 0 disables polling")
+	if err := fs.Parse(); err != nil {
+		cx.Output.Close()
+		return cx.State
+	}
+	args := fs.Args()
+	if len(args) < 2 {
+		defer cx.Output.Close()
+		fmt.Fprintln(cx.Output, "usage: .watch [-debounce duration] [-poll duration] <glob or dir> <cmd> [args...]")
+		return cx.State
+	}
+
+	w := &watch{
+		ws:       ws,
+		cx:       cx,
+		path:     args[0],
+		name:     args[1],
+		args:     args[2:],
+		debounce: *debounce,
+		poll:     *poll,
+		stop:     make(chan struct{}),
+	}
+	if !filepath.IsAbs(w.path) {
+		w.path = filepath.Join(cx.Wd(cx.View), w.path)
+	}
+	w.path = filepath.Clean(w.path)
+	w.glob = strings.ContainsAny(w.path, "*?[")
+	if _, err := filepath.Match(w.path, ""); w.glob && err != nil {
+		defer cx.Output.Close()
+		fmt.Fprintf(cx.Output, "invalid glob `%s`: %s\n", w.path, err)
+		return cx.State
+	}
+
+	ticket := cx.Begin(Task{
+		Title:    fmt.Sprintf("Watch %s: `%s`", mgutil.ShortFn(w.path, cx.Env), mgutil.QuoteCmd(w.name, w.args...)),
+		CancelID: cx.CancelID,
+		Cancel:   w.cancel,
+		Fd:       cx.Fd,
+		Cmd:      cx.RunCmd,
+	})
+	w.runID = ticket.CancelID + "/run"
+	ws.track(w, true)
+	go w.loop(ticket)
+	return cx.State
+}
+
+type watchStat struct {
+	size  int64
+	mtime time.Time
+}
+
+// watch re-runs a command when files it matches change
+type watch struct {
+	ws *watchSupport
+	cx *CmdCtx
+
+	// path is either an absolute glob or dir
+	path     string
+	glob     bool
+	name     string
+	args     []string
+	debounce time.Duration
+	poll     time.Duration
+	// runID is the CancelID of the command's runs, so each run cancels the previous one
+	runID string
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped bool
+	timer   *time.Timer
+	reason  string
+	runs    int
+	snap    map[string]watchStat
+}
+
+// match returns true if the file fn is watched
+func (w *watch) match(fn string) bool {
+	if w.glob {
+		ok, _ := filepath.Match(w.path, fn)
+		return ok
+	}
+	return fn == w.path || strings.HasPrefix(fn, w.path+string(filepath.Separator))
+}
+
+func (w *watch) loop(ticket *TaskTicket) {
+	defer ticket.Done()
+	defer w.cx.Output.Close()
+	defer w.ws.track(w, false)
+
+	snap := w.snapshot()
+	w.mu.Lock()
+	w.snap = snap
+	w.mu.Unlock()
+	go w.rerun("started")
+
+	var tick <-chan time.Time
+	if w.poll > 0 {
+		t := time.NewTicker(w.poll)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-w.stop:
+			if sto := w.cx.Store; sto != nil {
+				sto.tasks.Cancel(w.runID)
+			}
+			return
+		case <-tick:
+			// the snapshot is taken without holding w.mu so saves aren't blocked by the walk
+			snap := w.snapshot()
+			w.mu.Lock()
+			if fn := w.changed(snap); fn != "" {
+				w.trigger(fn)
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *watch) cancel() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return
+	}
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	close(w.stop)
+}
+
+// saved triggers a re-run after fn was saved.
+// fn's stat is updated so polling doesn't also report the change.
+func (w *watch) saved(fn string) {
+	fi, err := os.Stat(fn)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err == nil && w.snap != nil {
+		w.snap[fn] = watchStat{size: fi.Size(), mtime: fi.ModTime()}
+	}
+	w.trigger(fn)
+}
+
+// trigger schedules the command to be re-run after the debounce period
+//
+// w.mu must be held by the caller
+func (w *watch) trigger(fn string) {
+	if w.stopped {
+		return
+	}
+	w.reason = fn
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.debounce, func() {
+			w.mu.Lock()
+			reason := w.reason
+			w.mu.Unlock()
+			w.rerun(reason)
+		})
+	} else {
+		w.timer.Reset(w.debounce)
+	}
+}
+
+// rerun dispatches watchRun so the command is run with the current state instead of the one .watch was started with
+func (w *watch) rerun(reason string) {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	w.runs++
+	n := w.runs
+	w.mu.Unlock()
+
+	w.cx.Store.Dispatch(watchRun{w: w, n: n, reason: reason})
+}
+
+// run runs the command for the nth time
+func (w *watch) run(mx *Ctx, n int, reason string) *State {
+	w.mu.Lock()
+	stopped := w.stopped
+	w.mu.Unlock()
+	if stopped {
+		return mx.State
+	}
+
+	fmt.Fprintf(w.cx.Output, "# run %d: %s (%s)\n", n, mgutil.QuoteCmd(w.name, w.args...), mgutil.ShortFn(reason, mx.Env))
+	rc := w.cx.RunCmd
+	rc.Name = w.name
+	rc.Args = w.args
+	rc.CancelID = w.runID
+	cx := &CmdCtx{
+		Ctx:    mx,
+		RunCmd: rc,
+		Output: watchOutput{OutputStream: w.cx.Output},
+	}
+	return cx.Run()
+}
+
+// changed replaces the snapshot with snap and returns the name of a file that changed since the last one, if any
+//
+// w.mu must be held by the caller
+func (w *watch) changed(snap map[string]watchStat) string {
+	prev := w.snap
+	w.snap = snap
+	for fn, st := range snap {
+		if p, ok := prev[fn]; !ok || p != st {
+			return fn
+		}
+	}
+	for fn := range prev {
+		if _, ok := snap[fn]; !ok {
+			return fn
+		}
+	}
+	return ""
+}
+
+// snapshot returns the stat of all the watched files
+func (w *watch) snapshot() map[string]watchStat {
+	snap := map[string]watchStat{}
+	add := func(fn string, fi os.FileInfo) {
+		snap[fn] = watchStat{size: fi.Size(), mtime: fi.ModTime()}
+	}
+	if w.glob {
+		l, _ := filepath.Glob(w.path)
+		for _, fn := range l {
+			if fi, err := os.Stat(fn); err == nil && !fi.IsDir() {
+				add(fn, fi)
+			}
+		}
+		return snap
+	}
+
+	filepath.Walk(w.path, func(fn string, fi os.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return nil
+		case len(snap) >= WatchMaxFiles:
+			return filepath.SkipDir
+		case fi.IsDir():
+			if fn != w.path && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+		default:
+			add(fn, fi)
+		}
+		return nil
+	})
+	return snap
+}
+
+// watchOutput stops each run of the command from closing the watch's output
+type watchOutput struct {
+	OutputStream
+}
+
+func (wo watchOutput) Close() error {
+	return wo.Flush()
+}
@@ -0,0 +1,81 @@
+// +build !windows
+
+package mg
+
+import (
+	"io/ioutil"
+	"margo.sh/mgutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchBuiltin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "margo-watch-test")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mx := NewTestingCtx(nil)
+	defer mx.Cancel()
+	// re-runs are dispatched through the store
+	mx.Store.mount()
+	defer mx.Store.unmount()
+
+	ws := &watchSupport{}
+	out := &CmdOut{}
+	cx := &CmdCtx{
+		Ctx: mx,
+		RunCmd: RunCmd{
+			Name:     ".watch",
+			Args:     []string{"-poll=20ms", "-debounce=10ms", filepath.Join(dir, "*.txt"), "echo", "ran"},
+			CancelID: "watch-test",
+		},
+		Output: out,
+	}
+	ws.watchBuiltin(cx)
+
+	buf := []byte{}
+	waitFor := func(s string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(string(buf), s) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for output %q, got %q", s, buf)
+			}
+			time.Sleep(10 * time.Millisecond)
+			buf = append(buf, out.Output().Output...)
+		}
+	}
+	waitFor("# run 1: echo ran (started)\nran\n")
+
+	fn := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(fn, []byte("a"), 0644); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+	waitFor("# run 2: echo ran (" + mgutil.ShortFn(fn, mx.Env) + ")\nran\n")
+
+	// files that don't match the glob don't trigger a run
+	ioutil.WriteFile(filepath.Join(dir, "b.go"), []byte("b"), 0644)
+	ws.saved(filepath.Join(dir, "b.go"))
+	ws.saved(fn)
+	waitFor("# run 3: echo ran (" + mgutil.ShortFn(fn, mx.Env) + ")\nran\n")
+	if strings.Contains(string(buf), "b.go") {
+		t.Fatalf("unexpected run for b.go: %q", buf)
+	}
+
+	mx.Store.tasks.Cancel("watch-test")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		o := out.Output()
+		if o.Close {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output was not closed after the watch was canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
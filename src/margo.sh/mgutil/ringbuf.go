@@ -0,0 +1,74 @@
+package mgutil
+
+import (
+	"sync"
+)
+
+// RingBuffer is an io.Writer that keeps only the last Size bytes written to it.
+//
+// It's safe for concurrent use.
+type RingBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	// head is the index of the oldest byte in buf.
+	// It's only non-zero once buf is full and writes wrap around.
+	head    int
+	size    int
+	dropped int64
+}
+
+// NewRingBuffer returns a new RingBuffer that holds at most size bytes.
+// It panics if size <= 0
+func NewRingBuffer(size int) *RingBuffer {
+	if size <= 0 {
+		panic("NewRingBuffer: size must be greater than 0")
+	}
+	return &RingBuffer{size: size}
+}
+
+// Write implements io.Writer, discarding the oldest data if the buffer is full.
+// It never returns an error.
+func (rb *RingBuffer) Write(p []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	n := len(p)
+	if len(p) > rb.size {
+		rb.dropped += int64(len(p) - rb.size)
+		p = p[len(p)-rb.size:]
+	}
+	// fill the buffer before wrapping around
+	if free := rb.size - len(rb.buf); free > 0 {
+		if free > len(p) {
+			free = len(p)
+		}
+		rb.buf = append(rb.buf, p[:free]...)
+		p = p[free:]
+	}
+	// the rest of p overwrites the oldest data
+	rb.dropped += int64(len(p))
+	for len(p) != 0 {
+		i := copy(rb.buf[rb.head:], p)
+		p = p[i:]
+		rb.head = (rb.head + i) % rb.size
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the data in the buffer
+func (rb *RingBuffer) Bytes() []byte {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	b := make([]byte, 0, len(rb.buf))
+	b = append(b, rb.buf[rb.head:]...)
+	return append(b, rb.buf[:rb.head]...)
+}
+
+// Dropped returns the number of bytes that were discarded because the buffer was full
+func (rb *RingBuffer) Dropped() int64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	return rb.dropped
+}
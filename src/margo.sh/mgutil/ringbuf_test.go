@@ -0,0 +1,31 @@
+package mgutil
+
+import (
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	rb := NewRingBuffer(8)
+	rb.Write([]byte("hello"))
+	rb.Write([]byte(" world"))
+	if s := string(rb.Bytes()); s != "lo world" {
+		t.Errorf("RingBuffer.Bytes() = %q, want %q", s, "lo world")
+	}
+	if n := rb.Dropped(); n != 3 {
+		t.Errorf("RingBuffer.Dropped() = %d, want %d", n, 3)
+	}
+
+	rb.Write([]byte("0123456789"))
+	if s := string(rb.Bytes()); s != "23456789" {
+		t.Errorf("RingBuffer.Bytes() = %q, want %q", s, "23456789")
+	}
+
+	rb.Write([]byte("abc"))
+	rb.Write([]byte("defghi"))
+	if s := string(rb.Bytes()); s != "bcdefghi" {
+		t.Errorf("RingBuffer.Bytes() = %q, want %q", s, "bcdefghi")
+	}
+	if n := rb.Dropped(); n != 30-8 {
+		t.Errorf("RingBuffer.Dropped() = %d, want %d", n, 30-8)
+	}
+}
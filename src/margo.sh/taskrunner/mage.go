@@ -0,0 +1,166 @@
+package taskrunner
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"margo.sh/mg"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Magefile adds UserCmds for the targets in the closest magefile.go or magefiles directory (https://magefile.org)
+//
+// Only targets that take no arguments, other than a context.Context, are listed.
+type Magefile struct {
+	mg.ReducerType
+
+	// Cmd is the command to run, it defaults to `mage`
+	Cmd string
+}
+
+func (mf *Magefile) RCond(mx *mg.Ctx) bool {
+	return mx.ActionIs(mg.QueryUserCmds{}, mg.RunCmd{})
+}
+
+func (mf *Magefile) Reduce(mx *mg.Ctx) *mg.State {
+	cmd := mf.Cmd
+	if cmd == "" {
+		cmd = "mage"
+	}
+
+	switch mx.Action.(type) {
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(runBuiltin(".mage", "Mage", cmd))
+	case mg.QueryUserCmds:
+		fn, ok := locate(mx, "magefile.go", "magefiles")
+		if !ok {
+			return mx.State
+		}
+		dir, tagged := filepath.Dir(fn), true
+		if filepath.Base(fn) == "magefiles" {
+			// files in the magefiles directory don't need the build tag
+			dir, tagged = fn, false
+		}
+		return mx.AddUserCmds(userCmds(".mage", cmd, fn, parseMagefiles(dir, tagged))...)
+	}
+	return mx.State
+}
+
+// parseMagefiles returns the list of targets defined in the Go files in dir
+// If tagged is true, only files with the `mage` build tag are considered.
+func parseMagefiles(dir string, tagged bool) []target {
+	l, _ := ioutil.ReadDir(dir)
+	var targets []target
+	for _, fi := range l {
+		nm := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(nm, ".go") || strings.HasSuffix(nm, "_test.go") {
+			continue
+		}
+		src, err := ioutil.ReadFile(filepath.Join(dir, nm))
+		if err != nil || (tagged && !hasMageTag(src)) {
+			continue
+		}
+		af, _ := parser.ParseFile(token.NewFileSet(), nm, src, parser.ParseComments)
+		if af != nil {
+			targets = append(targets, mageTargets(af)...)
+		}
+	}
+	return targets
+}
+
+// hasMageTag returns true if the header of src contains the `mage` build tag
+func hasMageTag(src []byte) bool {
+	for _, ln := range strings.Split(string(src), "\n") {
+		ln = strings.TrimSpace(ln)
+		switch {
+		case strings.HasPrefix(ln, "package "):
+			return false
+		case strings.HasPrefix(ln, "//go:build"), strings.HasPrefix(ln, "// +build"):
+			for _, s := range strings.FieldsFunc(ln, func(r rune) bool { return !unicode.IsLetter(r) }) {
+				if s == "mage" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// mageTargets returns the targets defined in af
+// These are exported functions, and methods of types declared as `mg.Namespace`.
+func mageTargets(af *ast.File) []target {
+	namespaces := map[string]bool{}
+	for _, d := range af.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if sel, ok := ts.Type.(*ast.SelectorExpr); ok && sel.Sel.Name == "Namespace" {
+				namespaces[ts.Name.Name] = true
+			}
+		}
+	}
+
+	var targets []target
+	for _, d := range af.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || !fd.Name.IsExported() || !isMageFunc(fd.Type) {
+			continue
+		}
+		name := mageName(fd.Name.Name)
+		if fd.Recv != nil {
+			if len(fd.Recv.List) != 1 {
+				continue
+			}
+			id, ok := fd.Recv.List[0].Type.(*ast.Ident)
+			if !ok || !namespaces[id.Name] {
+				continue
+			}
+			name = mageName(id.Name) + ":" + name
+		}
+		desc := ""
+		if fd.Doc != nil {
+			desc = strings.TrimSpace(strings.SplitN(fd.Doc.Text(), "\n", 2)[0])
+		}
+		targets = append(targets, target{Name: name, Desc: desc})
+	}
+	return targets
+}
+
+// isMageFunc returns true if ft is the signature of a mage target
+// i.e. it optionally takes a context.Context and optionally returns an error
+func isMageFunc(ft *ast.FuncType) bool {
+	if p := ft.Params.List; len(p) > 1 || (len(p) == 1 && (len(p[0].Names) > 1 || !isSelector(p[0].Type, "context", "Context"))) {
+		return false
+	}
+	if ft.Results == nil {
+		return true
+	}
+	r := ft.Results.List
+	if len(r) != 1 || len(r[0].Names) > 1 {
+		return false
+	}
+	id, ok := r[0].Type.(*ast.Ident)
+	return ok && id.Name == "error"
+}
+
+func isSelector(x ast.Expr, pkg, name string) bool {
+	sel, ok := x.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && id.Name == pkg
+}
+
+// mageName returns the name used to invoke target nm e.g. `installDeps` for `InstallDeps`
+func mageName(nm string) string {
+	r, n := utf8.DecodeRuneInString(nm)
+	return string(unicode.ToLower(r)) + nm[n:]
+}
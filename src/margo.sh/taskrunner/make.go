@@ -0,0 +1,92 @@
+package taskrunner
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"margo.sh/mg"
+	"strings"
+)
+
+// Makefile adds UserCmds for the targets in the closest Makefile
+//
+// A target's description is taken from a `## description` comment that follows it on the same line,
+// or the comments immediately preceding it.
+type Makefile struct {
+	mg.ReducerType
+
+	// Cmd is the command to run, it defaults to `make`
+	Cmd string
+}
+
+func (mk *Makefile) RCond(mx *mg.Ctx) bool {
+	return mx.ActionIs(mg.QueryUserCmds{}, mg.RunCmd{})
+}
+
+func (mk *Makefile) Reduce(mx *mg.Ctx) *mg.State {
+	cmd := mk.Cmd
+	if cmd == "" {
+		cmd = "make"
+	}
+
+	switch mx.Action.(type) {
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(runBuiltin(".make", "Make", cmd))
+	case mg.QueryUserCmds:
+		fn, ok := locate(mx, "GNUmakefile", "makefile", "Makefile")
+		if !ok {
+			return mx.State
+		}
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return mx.State
+		}
+		return mx.AddUserCmds(userCmds(".make", cmd, fn, parseMakefile(src))...)
+	}
+	return mx.State
+}
+
+// parseMakefile returns the list of explicit targets in the Makefile src
+//
+// Special targets like `.PHONY`, pattern rules and targets containing variables are ignored.
+func parseMakefile(src []byte) []target {
+	var targets []target
+	seen := map[string]bool{}
+	comment := []string{}
+	sc := bufio.NewScanner(bytes.NewReader(src))
+	for sc.Scan() {
+		ln := sc.Text()
+		switch {
+		case strings.HasPrefix(ln, "\t"):
+			comment = comment[:0]
+			continue
+		case strings.HasPrefix(ln, "#"):
+			comment = append(comment, strings.TrimSpace(strings.TrimLeft(ln, "#")))
+			continue
+		}
+
+		rule, desc := ln, ""
+		if i := strings.Index(ln, "##"); i >= 0 {
+			rule, desc = ln[:i], strings.TrimSpace(ln[i+2:])
+		} else if i := strings.IndexByte(ln, '#'); i >= 0 {
+			rule = ln[:i]
+		}
+		if desc == "" {
+			desc = strings.Join(comment, " ")
+		}
+		comment = comment[:0]
+
+		i := strings.IndexByte(rule, ':')
+		if i <= 0 || strings.ContainsAny(rule[:i], "=") || strings.HasPrefix(rule[i:], ":=") {
+			continue
+		}
+		for _, nm := range strings.Fields(rule[:i]) {
+			if seen[nm] || strings.HasPrefix(nm, ".") || strings.ContainsAny(nm, "%$") {
+				continue
+			}
+			seen[nm] = true
+			targets = append(targets, target{Name: nm, Desc: desc})
+		}
+	}
+	return targets
+}
@@ -0,0 +1,122 @@
+package taskrunner
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"margo.sh/mg"
+	"strings"
+)
+
+// Taskfile adds UserCmds for the tasks in the closest Taskfile.yml (https://taskfile.dev)
+//
+// Tasks with `internal: true` are ignored.
+type Taskfile struct {
+	mg.ReducerType
+
+	// Cmd is the command to run, it defaults to `task`
+	Cmd string
+}
+
+func (tf *Taskfile) RCond(mx *mg.Ctx) bool {
+	return mx.ActionIs(mg.QueryUserCmds{}, mg.RunCmd{})
+}
+
+func (tf *Taskfile) Reduce(mx *mg.Ctx) *mg.State {
+	cmd := tf.Cmd
+	if cmd == "" {
+		cmd = "task"
+	}
+
+	switch mx.Action.(type) {
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(runBuiltin(".task", "Task", cmd))
+	case mg.QueryUserCmds:
+		fn, ok := locate(mx, "Taskfile.yml", "Taskfile.yaml", "taskfile.yml", "taskfile.yaml")
+		if !ok {
+			return mx.State
+		}
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return mx.State
+		}
+		return mx.AddUserCmds(userCmds(".task", cmd, fn, parseTaskfile(src))...)
+	}
+	return mx.State
+}
+
+// parseTaskfile returns the list of tasks in the Taskfile src
+//
+// It only understands the subset of YAML needed to find the keys of the top-level `tasks` map,
+// and the `desc` and `internal` keys of each task.
+func parseTaskfile(src []byte) []target {
+	type Line struct {
+		indent int
+		text   string
+		key    string
+		val    string
+	}
+	var lines []Line
+	sc := bufio.NewScanner(bytes.NewReader(src))
+	for sc.Scan() {
+		s := sc.Text()
+		t := strings.TrimSpace(s)
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		ln := Line{indent: len(s) - len(strings.TrimLeft(s, " \t")), text: t}
+		if i := strings.Index(t, ":"); i > 0 && !strings.HasPrefix(t, "-") {
+			ln.key = yamlUnquote(t[:i])
+			ln.val = strings.TrimSpace(t[i+1:])
+		}
+		lines = append(lines, ln)
+	}
+
+	var targets []target
+	inTasks := false
+	taskIndent, propIndent := -1, -1
+	var cur *target
+	internal := false
+	end := func() {
+		if cur != nil && !internal {
+			targets = append(targets, *cur)
+		}
+		cur, internal = nil, false
+	}
+	for i, ln := range lines {
+		switch {
+		case ln.indent == 0:
+			end()
+			inTasks = ln.key == "tasks"
+		case !inTasks:
+		case taskIndent < 0 || ln.indent == taskIndent:
+			end()
+			taskIndent, propIndent = ln.indent, -1
+			if ln.key != "" {
+				cur = &target{Name: ln.key}
+			}
+		case cur == nil:
+		case propIndent < 0 || ln.indent == propIndent:
+			propIndent = ln.indent
+			switch ln.key {
+			case "desc":
+				cur.Desc = yamlUnquote(ln.val)
+				if (ln.val == "|" || ln.val == ">") && i+1 < len(lines) {
+					cur.Desc = lines[i+1].text
+				}
+			case "internal":
+				internal = ln.val == "true"
+			}
+		}
+	}
+	end()
+	return targets
+}
+
+func yamlUnquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
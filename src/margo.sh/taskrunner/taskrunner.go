@@ -0,0 +1,91 @@
+// Package taskrunner adds UserCmds for the targets of task runners like make, task and mage.
+//
+// The closest Makefile, Taskfile.yml or magefile.go is found via the VFS
+// and its targets are offered in QueryUserCmds.
+// The targets are run through a builtin command that streams the output through mg.IssueOut
+// so errors in the output are reported as issues.
+package taskrunner
+
+import (
+	"fmt"
+	"margo.sh/mg"
+	"path/filepath"
+	"sort"
+)
+
+// target is a target of a task runner
+type target struct {
+	Name string
+	Desc string
+}
+
+// locate returns the path of the closest file named one of names, in the view's directory or one of its parents.
+// If multiple files are found in the same directory, the first name in names is preferred.
+func locate(mx *mg.Ctx, names ...string) (fn string, ok bool) {
+	nd := mx.VFS.Poke(mx.View.Dir())
+	for _, nm := range names {
+		c, _, err := nd.Locate(nm)
+		if err != nil {
+			continue
+		}
+		if p := c.Path(); fn == "" || len(filepath.Dir(p)) > len(filepath.Dir(fn)) {
+			fn = p
+		}
+	}
+	return fn, fn != ""
+}
+
+// userCmds returns a UserCmd to run each target in l, using the builtin named builtin
+func userCmds(builtin, cmd, fn string, l []target) mg.UserCmdList {
+	cmds := make(mg.UserCmdList, 0, len(l))
+	for _, t := range l {
+		desc := t.Desc
+		if desc == "" {
+			desc = fmt.Sprintf("%s %s in %s", cmd, t.Name, fn)
+		}
+		cmds = append(cmds, mg.UserCmd{
+			Title: cmd + " " + t.Name,
+			Desc:  desc,
+			Name:  builtin,
+			Args:  []string{t.Name},
+			Dir:   filepath.Dir(fn),
+		})
+	}
+	sort.Sort(cmds)
+	return cmds
+}
+
+// runBuiltin returns the builtin command name that runs cmd
+// reporting any errors in its output as issues labeled label
+func runBuiltin(name, label, cmd string) mg.BuiltinCmd {
+	return mg.BuiltinCmd{
+		Name: name,
+		Desc: fmt.Sprintf("Run `%s` with the specified args, reporting errors in its output as issues", cmd),
+		Run: func(cx *mg.CmdCtx) *mg.State {
+			go run(cx, label, cmd)
+			return cx.State
+		},
+	}
+}
+
+type issueKey struct{ Label string }
+
+func run(cx *mg.CmdCtx, label, cmd string) {
+	defer cx.Output.Close()
+
+	dir := cx.Wd(cx.View)
+	iw := &mg.IssueOut{
+		Base:     mg.Issue{Label: label},
+		Patterns: mg.CommonPatterns(),
+		Dir:      dir,
+	}
+	cx.Copy(func(x *mg.CmdCtx) {
+		x.Name = cmd
+		x.Output = mg.OutputStreams{cx.Output, iw}
+	}).RunProc()
+
+	cx.Store.Dispatch(mg.StoreIssues{
+		IssueKey: mg.IssueKey{Key: issueKey{label}, Dir: dir},
+		Issues:   iw.Issues(),
+	})
+}
@@ -0,0 +1,132 @@
+package taskrunner
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestParseMakefile(t *testing.T) {
+	src := []byte(`
+GO := go
+VERSION = 1.0: x
+
+.PHONY: build test
+
+# Build the binary
+build: deps ## Build the binary
+	$(GO) build
+
+# Run the tests
+# with the race detector
+test:
+	$(GO) test -race ./...
+
+deps install::
+	$(GO) mod download
+
+%.o: %.c
+	cc -c $<
+
+$(BIN): build
+`)
+	exp := []target{
+		{Name: "build", Desc: "Build the binary"},
+		{Name: "test", Desc: "Run the tests with the race detector"},
+		{Name: "deps"},
+		{Name: "install"},
+	}
+	if got := parseMakefile(src); !reflect.DeepEqual(got, exp) {
+		t.Errorf("parseMakefile() = %#v, expected %#v", got, exp)
+	}
+}
+
+func TestParseTaskfile(t *testing.T) {
+	src := []byte(`
+version: '3'
+
+vars:
+  GREETING: hello
+
+tasks:
+  build:
+    desc: "Build the app"
+    cmds:
+      - go build -v ./...
+
+  # tidy the module
+  tidy: go mod tidy
+
+  helper:
+    internal: true
+    cmds:
+      - echo help
+
+  lint:
+    desc: |
+      Lint all the things
+      and more
+    deps: [build]
+
+includes:
+  docs: ./docs
+`)
+	exp := []target{
+		{Name: "build", Desc: "Build the app"},
+		{Name: "tidy"},
+		{Name: "lint", Desc: "Lint all the things"},
+	}
+	if got := parseTaskfile(src); !reflect.DeepEqual(got, exp) {
+		t.Errorf("parseTaskfile() = %#v, expected %#v", got, exp)
+	}
+}
+
+func TestMageTargets(t *testing.T) {
+	src := `//go:build mage
+// +build mage
+
+package main
+
+import (
+	"context"
+
+	"github.com/magefile/mage/mg"
+)
+
+// Build builds the binary.
+// It runs go build.
+func Build() error { return nil }
+
+// InstallDeps installs the dependencies
+func InstallDeps(ctx context.Context) {}
+
+func Release(version string) error { return nil }
+
+func helper() {}
+
+type Docker mg.Namespace
+
+// Push pushes the image
+func (Docker) Push() error { return nil }
+`
+	if !hasMageTag([]byte(src)) {
+		t.Fatalf("hasMageTag() returned false")
+	}
+	if hasMageTag([]byte("package main\n// +build mage\n")) {
+		t.Fatalf("hasMageTag() returned true for a tag after the package clause")
+	}
+
+	af, err := parser.ParseFile(token.NewFileSet(), "magefile.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("cannot parse magefile: %s", err)
+	}
+	exp := []target{
+		{Name: "build", Desc: "Build builds the binary."},
+		{Name: "installDeps", Desc: "InstallDeps installs the dependencies"},
+		{Name: "docker:push", Desc: "Push pushes the image"},
+	}
+	if got := mageTargets(af); !reflect.DeepEqual(got, exp) {
+		t.Errorf("mageTargets() = %#v, expected %#v", got, exp)
+	}
+}